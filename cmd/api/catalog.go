@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/config"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/spf13/viper"
+)
+
+// runCatalogCommand runs the import or export subcommand and returns the exit
+// code. The format defaults to the extension of the file, csv otherwise.
+//
+//	api import -file products.csv [-format csv|jsonl] [-dry-run]
+//	api export -file products.jsonl [-format csv|jsonl]
+func runCatalogCommand(db *sql.DB, viper *viper.Viper, command string, args []string) int {
+
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	file := flags.String("file", "-", "file to read or write, - for stdin or stdout")
+	format := flags.String("format", "", "csv or jsonl")
+	dryRun := flags.Bool("dry-run", false, "validate the rows without importing them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *format == "" {
+		*format = services.FormatCSV
+		if ext := strings.TrimPrefix(filepath.Ext(*file), "."); ext == services.FormatJSONL || ext == "ndjson" {
+			*format = services.FormatJSONL
+		}
+	}
+
+	catalog := services.NewCatalog(repositories.NewProductRepository(db, nil), repositories.NewCategoryRepository(db, nil), repositories.NewAttributeRepository(db), config.NewRedisClient(viper))
+	ctx := context.Background()
+
+	switch command {
+	case "import":
+		var r io.Reader = os.Stdin
+		if *file != "-" {
+			f, err := os.Open(*file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			r = f
+		}
+
+		report, err := catalog.Import(ctx, r, *format, *dryRun)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if report.Failed > 0 {
+			return 1
+		}
+		return 0
+	case "export":
+		var w io.Writer = os.Stdout
+		if *file != "-" {
+			f, err := os.Create(*file)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if err := catalog.Export(ctx, w, *format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, use import or export\n", command)
+		return 2
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"os"
+	// embeds the zone database of the report timezones, the alpine image has none
+	_ "time/tzdata"
+
 	"github.com/aldotp/OnlineStore/internal/config"
 	"github.com/aldotp/OnlineStore/internal/route"
 )
@@ -12,7 +16,17 @@ func main() {
 		panic(err)
 	}
 
-	config := config.NewBoostrapConfig(db, viper)
+	// the import and export subcommands run once instead of serving the API
+	if len(os.Args) > 1 {
+		os.Exit(runCatalogCommand(db, viper, os.Args[1], os.Args[2:]))
+	}
+
+	replicas, err := config.NewReplicaDBs(viper)
+	if err != nil {
+		panic(err)
+	}
+
+	config := config.NewBoostrapConfig(db, replicas, viper)
 	r := route.NewRouter(config)
 	r.Run()
 }
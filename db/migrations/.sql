@@ -5,31 +5,162 @@ CREATE TABLE IF NOT EXISTS `users` (
     username VARCHAR(255) NOT NULL UNIQUE,
     password VARCHAR(255) NOT NULL,
     email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'customer',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS `categories` (
     id INT AUTO_INCREMENT PRIMARY KEY,
+    parent_id INT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    name VARCHAR(255) NOT NULL UNIQUE
+    deleted_at TIMESTAMP NULL,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    INDEX (deleted_at),
+    FOREIGN KEY (parent_id) REFERENCES categories(id)
+);
+
+-- closure table of the category tree, one row per ancestor of each category
+-- including the category itself at depth 0
+CREATE TABLE IF NOT EXISTS `category_paths` (
+    ancestor_id INT NOT NULL,
+    descendant_id INT NOT NULL,
+    depth INT NOT NULL,
+    PRIMARY KEY (ancestor_id, descendant_id),
+    INDEX (descendant_id),
+    FOREIGN KEY (ancestor_id) REFERENCES categories(id),
+    FOREIGN KEY (descendant_id) REFERENCES categories(id)
 );
 
 CREATE TABLE IF NOT EXISTS `products` (
     id INT AUTO_INCREMENT PRIMARY KEY,
+    sku VARCHAR(100) NULL UNIQUE,
     name VARCHAR(255) NOT NULL,
     description TEXT,
     price DECIMAL(10, 2) NOT NULL,
     category_id INT,
+    weight DECIMAL(10, 3) NOT NULL DEFAULT 0,
+    length DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    width DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    height DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    stock INT NULL,
+    -- draft, published or unpublished, publish_at and unpublish_at schedule
+    -- the next changes and are cleared once applied
+    status VARCHAR(20) NOT NULL DEFAULT 'published',
+    publish_at TIMESTAMP NULL,
+    unpublish_at TIMESTAMP NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- deleted products stay referenced by orders, carts and wishlists
+    deleted_at TIMESTAMP NULL,
+    INDEX (deleted_at),
+    INDEX (publish_at),
+    INDEX (unpublish_at),
     FOREIGN KEY (category_id) REFERENCES categories(id)
 );
 
+CREATE TABLE IF NOT EXISTS `product_options` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    option_values TEXT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    UNIQUE (product_id, name),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE IF NOT EXISTS `product_variants` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    sku VARCHAR(100) NOT NULL UNIQUE,
+    price DECIMAL(10, 2) NULL,
+    stock INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE IF NOT EXISTS `product_variant_options` (
+    variant_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    value VARCHAR(100) NOT NULL,
+    PRIMARY KEY (variant_id, name),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id)
+);
+
+CREATE TABLE IF NOT EXISTS `product_images` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    size BIGINT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX (product_id, position),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE IF NOT EXISTS `category_attributes` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    category_id INT NOT NULL,
+    code VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    filterable BOOLEAN NOT NULL DEFAULT FALSE,
+    options TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (category_id, code),
+    INDEX (code),
+    FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+
+CREATE TABLE IF NOT EXISTS `product_attributes` (
+    product_id INT NOT NULL,
+    attribute_id INT NOT NULL,
+    value VARCHAR(255) NOT NULL,
+    PRIMARY KEY (product_id, attribute_id),
+    INDEX (attribute_id, value),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (attribute_id) REFERENCES category_attributes(id)
+);
+
+-- one row per price a product had, source is manual or schedule
+CREATE TABLE IF NOT EXISTS `product_price_history` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    schedule_id INT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_product_price_history_product (product_id, changed_at),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+-- scheduled price changes, regular_price is the price replaced when the
+-- schedule started and is put back at ends_at
+CREATE TABLE IF NOT EXISTS `price_schedules` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    regular_price DECIMAL(10, 2) NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_price_schedules_status (status, starts_at),
+    FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
 CREATE TABLE IF NOT EXISTS `carts` (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT,
+    token VARCHAR(64) NULL UNIQUE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id)
@@ -39,41 +170,288 @@ CREATE TABLE IF NOT EXISTS `cart_items` (
     id INT AUTO_INCREMENT PRIMARY KEY,
     cart_id INT,
     product_id INT,
+    variant_id INT NULL,
     quantity INT,
+    price DECIMAL(10, 2) NOT NULL DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (cart_id) REFERENCES carts(id),
-    FOREIGN KEY (product_id) REFERENCES products(id)
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id)
+);
+
+CREATE TABLE IF NOT EXISTS `shipping_methods` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    base_rate DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    rate_per_kg DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    free_threshold DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    countries VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS `orders` (
     id INT AUTO_INCREMENT PRIMARY KEY,
     user_id INT,
     total_amount DECIMAL(10, 2) NOT NULL,
+    shipping_method_id INT,
+    shipping_cost DECIMAL(10, 2) NOT NULL DEFAULT 0,
 	status VARCHAR(255) DEFAULT 'PENDING',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id)
+    INDEX (created_at),
+    INDEX (status),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (shipping_method_id) REFERENCES shipping_methods(id)
 );
 
 CREATE TABLE IF NOT EXISTS `order_details` (
     id INT AUTO_INCREMENT PRIMARY KEY,
     order_id INT,
     product_id INT,
+    variant_id INT NULL,
     quantity INT,
     price DECIMAL(10, 2) NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id)
+);
+
+CREATE TABLE IF NOT EXISTS `order_notes` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    author_id INT NULL,
+    note TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX (order_id),
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (author_id) REFERENCES users(id)
+);
+
+-- daily rollups of the orders by local day of each report timezone
+CREATE TABLE IF NOT EXISTS `sales_daily` (
+    timezone VARCHAR(64) NOT NULL,
+    day DATE NOT NULL,
+    orders INT NOT NULL DEFAULT 0,
+    revenue DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    units INT NOT NULL DEFAULT 0,
+    new_customers INT NOT NULL DEFAULT 0,
+    returning_customers INT NOT NULL DEFAULT 0,
+    final BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (timezone, day)
+);
+
+CREATE TABLE IF NOT EXISTS `sales_daily_products` (
+    timezone VARCHAR(64) NOT NULL,
+    day DATE NOT NULL,
+    product_id INT NOT NULL,
+    units INT NOT NULL DEFAULT 0,
+    revenue DECIMAL(14, 2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (timezone, day, product_id),
     FOREIGN KEY (product_id) REFERENCES products(id)
 );
 
+CREATE TABLE IF NOT EXISTS `addresses` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    recipient_name VARCHAR(255) NOT NULL,
+    phone VARCHAR(50) NOT NULL DEFAULT '',
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    state VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code VARCHAR(20) NOT NULL,
+    country VARCHAR(100) NOT NULL,
+    is_default_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+    is_default_billing BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS `order_addresses` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL UNIQUE,
+    recipient_name VARCHAR(255) NOT NULL,
+    phone VARCHAR(50) NOT NULL DEFAULT '',
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL,
+    state VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code VARCHAR(20) NOT NULL,
+    country VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE IF NOT EXISTS `shipments` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    carrier_code VARCHAR(50) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    shipped_at TIMESTAMP NULL,
+    delivered_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_shipments_tracking (carrier_code, tracking_number),
+    FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE IF NOT EXISTS `shipment_items` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    shipment_id INT NOT NULL,
+    order_detail_id INT NOT NULL,
+    quantity INT NOT NULL,
+    FOREIGN KEY (shipment_id) REFERENCES shipments(id),
+    FOREIGN KEY (order_detail_id) REFERENCES order_details(id)
+);
+
+CREATE TABLE IF NOT EXISTS `shipment_events` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    shipment_id INT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (shipment_id) REFERENCES shipments(id)
+);
+
+CREATE TABLE IF NOT EXISTS `returns` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    order_id INT NOT NULL,
+    user_id INT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    reason TEXT,
+    approved_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    refunded_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    received_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS `return_items` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    return_id INT NOT NULL,
+    order_detail_id INT NOT NULL,
+    product_id INT NOT NULL,
+    quantity INT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    FOREIGN KEY (return_id) REFERENCES returns(id),
+    FOREIGN KEY (order_detail_id) REFERENCES order_details(id)
+);
+
+CREATE TABLE IF NOT EXISTS `refunds` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    return_id INT NOT NULL,
+    order_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (return_id) REFERENCES returns(id),
+    FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE IF NOT EXISTS `return_history` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    return_id INT NOT NULL,
+    order_id INT NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    note TEXT,
+    amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    actor_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (return_id) REFERENCES returns(id),
+    FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE IF NOT EXISTS `abandoned_carts` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    cart_id INT NOT NULL,
+    user_id INT NULL,
+    item_count INT NOT NULL,
+    value DECIMAL(10, 2) NOT NULL,
+    last_activity_at TIMESTAMP NOT NULL,
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    notified_at TIMESTAMP NULL,
+    UNIQUE KEY uq_abandoned_carts_activity (cart_id, last_activity_at),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS `wishlists` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    share_token VARCHAR(64) NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_wishlists_user_name (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS `wishlist_items` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    wishlist_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT NULL,
+    -- variant_id with 0 for none, NULL values are never equal in unique keys
+    variant_key INT AS (COALESCE(variant_id, 0)) STORED,
+    quantity INT NOT NULL DEFAULT 1,
+    price DECIMAL(10, 2) NOT NULL,
+    in_stock BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_wishlist_items_product (wishlist_id, product_id, variant_key),
+    FOREIGN KEY (wishlist_id) REFERENCES wishlists(id),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (variant_id) REFERENCES product_variants(id)
+);
+
+CREATE TABLE IF NOT EXISTS `reviews` (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    product_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating TINYINT NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    verified BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_reviews_user_product (user_id, product_id),
+    INDEX idx_reviews_product_status (product_id, status),
+    FOREIGN KEY (product_id) REFERENCES products(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
 INSERT INTO categories (id, created_at, updated_at, name)
 VALUES (1, '2024-04-01 21:04:10', '2024-04-01 21:04:10', 'food'),
        (2, '2024-04-01 21:04:15', '2024-04-01 21:04:15', 'drink'),
        (3, '2024-04-02 03:36:59', '2024-04-02 03:36:59', 'clothes');
 
+INSERT INTO category_paths (ancestor_id, descendant_id, depth)
+SELECT id, id, 0 FROM categories;
+
 INSERT INTO products (id, name, description, price, category_id, created_at, updated_at)
 VALUES (1, 'Coca cola', 'This is an example product description.', 5000.00, 2, '2024-04-01 22:57:36', '2024-04-01 22:57:36'),
        (2, 'Fanta', 'This is an example product description.', 5000.00, 2, '2024-04-01 23:00:11', '2024-04-01 23:00:11'),
        (3, 'Sprite', 'This is an example product description.', 6000.00, 2, '2024-04-01 23:02:07', '2024-04-01 23:02:07');
+
+INSERT INTO product_price_history (product_id, price, source, changed_at)
+SELECT id, price, 'manual', created_at FROM products;
+
+INSERT INTO shipping_methods (id, code, name, type, base_rate, rate_per_kg, free_threshold, countries, active)
+VALUES (1, 'flat', 'Flat Rate', 'flat_rate', 10000.00, 0, 0, '', TRUE),
+       (2, 'weight', 'Weight Based', 'weight_based', 5000.00, 4000.00, 0, '', TRUE),
+       (3, 'free', 'Free Shipping', 'free_over_threshold', 15000.00, 0, 100000.00, '', TRUE),
+       (4, 'pickup', 'Local Pickup', 'local_pickup', 0, 0, 0, 'Indonesia', TRUE);
@@ -2,12 +2,16 @@ package config
 
 import (
 	"database/sql"
+	"strings"
+	"time"
 
+	"github.com/aldotp/OnlineStore/internal/storage"
 	"github.com/spf13/viper"
 )
 
 type BootstrapConfig struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Replicas []*sql.DB
 	Config
 	Viper *viper.Viper
 }
@@ -16,16 +20,103 @@ type Config struct {
 	WebPort string
 	Host    string
 	JWTKey  string
+
+	CarrierWebhookSecret string
+	CarrierBatchCodes    []string
+	CartMergeStrategy    string
+
+	CartItemTTL        time.Duration
+	CartAbandonAfter   time.Duration
+	CartWorkerInterval time.Duration
+
+	WishlistWorkerInterval time.Duration
+
+	PurgeAfter          time.Duration
+	PurgeWorkerInterval time.Duration
+
+	PublishWorkerInterval time.Duration
+	PriceWorkerInterval   time.Duration
+
+	Currency                  string
+	OrderExportDir            string
+	OrderExportFormat         string
+	OrderExportWorkerInterval time.Duration
+
+	ReportTimezones      []string
+	ReportWorkerInterval time.Duration
+
+	DBPoolWorkerInterval time.Duration
+
+	ReplicaPinAfterWrite  time.Duration
+	ReplicaMaxLag         time.Duration
+	ReplicaWorkerInterval time.Duration
+
+	Storage      storage.Config
+	ImageMaxSize int64
 }
 
-func NewBoostrapConfig(DB *sql.DB, viper *viper.Viper) *BootstrapConfig {
+func NewBoostrapConfig(DB *sql.DB, replicas []*sql.DB, viper *viper.Viper) *BootstrapConfig {
 	return &BootstrapConfig{
-		Viper: viper,
-		DB:    DB,
+		Viper:    viper,
+		DB:       DB,
+		Replicas: replicas,
 		Config: Config{
 			WebPort: viper.GetString("PORT"),
 			Host:    viper.GetString("HOST"),
 			JWTKey:  viper.GetString("JWT_KEY"),
+
+			CarrierWebhookSecret: viper.GetString("CARRIER_WEBHOOK_SECRET"),
+			CarrierBatchCodes:    splitList(viper.GetString("CARRIER_BATCH_CODES")),
+			CartMergeStrategy:    viper.GetString("CART_MERGE_STRATEGY"),
+
+			CartItemTTL:        viper.GetDuration("CART_ITEM_TTL"),
+			CartAbandonAfter:   viper.GetDuration("CART_ABANDON_AFTER"),
+			CartWorkerInterval: viper.GetDuration("CART_WORKER_INTERVAL"),
+
+			WishlistWorkerInterval: viper.GetDuration("WISHLIST_WORKER_INTERVAL"),
+
+			PurgeAfter:          viper.GetDuration("PURGE_AFTER"),
+			PurgeWorkerInterval: viper.GetDuration("PURGE_WORKER_INTERVAL"),
+
+			PublishWorkerInterval: viper.GetDuration("PUBLISH_WORKER_INTERVAL"),
+			PriceWorkerInterval:   viper.GetDuration("PRICE_WORKER_INTERVAL"),
+
+			Currency:                  viper.GetString("CURRENCY"),
+			OrderExportDir:            viper.GetString("ORDER_EXPORT_DIR"),
+			OrderExportFormat:         viper.GetString("ORDER_EXPORT_FORMAT"),
+			OrderExportWorkerInterval: viper.GetDuration("ORDER_EXPORT_WORKER_INTERVAL"),
+
+			ReportTimezones:      splitList(viper.GetString("REPORT_TIMEZONES")),
+			ReportWorkerInterval: viper.GetDuration("REPORT_WORKER_INTERVAL"),
+
+			DBPoolWorkerInterval: viper.GetDuration("DB_POOL_WORKER_INTERVAL"),
+
+			ReplicaPinAfterWrite:  viper.GetDuration("DB_REPLICA_PIN_AFTER_WRITE"),
+			ReplicaMaxLag:         viper.GetDuration("DB_REPLICA_MAX_LAG"),
+			ReplicaWorkerInterval: viper.GetDuration("DB_REPLICA_WORKER_INTERVAL"),
+
+			Storage: storage.Config{
+				Driver:      viper.GetString("MEDIA_STORAGE"),
+				BaseURL:     viper.GetString("MEDIA_BASE_URL"),
+				LocalDir:    viper.GetString("MEDIA_LOCAL_DIR"),
+				S3Endpoint:  viper.GetString("S3_ENDPOINT"),
+				S3Region:    viper.GetString("S3_REGION"),
+				S3Bucket:    viper.GetString("S3_BUCKET"),
+				S3AccessKey: viper.GetString("S3_ACCESS_KEY"),
+				S3SecretKey: viper.GetString("S3_SECRET_KEY"),
+			},
+			ImageMaxSize: viper.GetInt64("IMAGE_MAX_SIZE"),
 		},
 	}
 }
+
+// splitList splits a comma separated setting, dropping the empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
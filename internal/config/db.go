@@ -29,6 +29,7 @@ func NewDB(viper *viper.Viper) (*sql.DB, error) {
 			counts++
 		} else {
 			log.Println("Connected to MySQL!")
+			configurePool(db, viper)
 			return db, nil
 		}
 
@@ -44,6 +45,47 @@ func NewDB(viper *viper.Viper) (*sql.DB, error) {
 
 }
 
+// NewReplicaDBs opens the pools of the read replicas of DB_REPLICA_DSNS, a comma
+// separated list of go-sql-driver/mysql DSNs, with the limits of the primary.
+// They are not pinged, replica.Router checks their health.
+func NewReplicaDBs(viper *viper.Viper) ([]*sql.DB, error) {
+
+	var dbs []*sql.DB
+	for i, dsn := range splitList(viper.GetString("DB_REPLICA_DSNS")) {
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DSN of replica-%d: %w", i+1, err)
+		}
+
+		configurePool(db, viper)
+		dbs = append(dbs, db)
+	}
+
+	return dbs, nil
+}
+
+// configurePool applies the pool limits of the DB_MAX_OPEN_CONNS,
+// DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME settings.
+// The database/sql defaults are kept for the settings left unset.
+func configurePool(db *sql.DB, viper *viper.Viper) {
+
+	if viper.IsSet("DB_MAX_OPEN_CONNS") {
+		db.SetMaxOpenConns(viper.GetInt("DB_MAX_OPEN_CONNS"))
+	}
+
+	if viper.IsSet("DB_MAX_IDLE_CONNS") {
+		db.SetMaxIdleConns(viper.GetInt("DB_MAX_IDLE_CONNS"))
+	}
+
+	if viper.IsSet("DB_CONN_MAX_LIFETIME") {
+		db.SetConnMaxLifetime(viper.GetDuration("DB_CONN_MAX_LIFETIME"))
+	}
+
+	if viper.IsSet("DB_CONN_MAX_IDLE_TIME") {
+		db.SetConnMaxIdleTime(viper.GetDuration("DB_CONN_MAX_IDLE_TIME"))
+	}
+}
+
 func openDB(dsn string) (*sql.DB, error) {
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"log"
+)
+
+// poolVars publishes the statistics of the connection pools by name, in the
+// db_pools expvar.
+var poolVars = expvar.NewMap("db_pools")
+
+// PoolMonitor reports the saturation of a connection pool, which is saturated
+// when queries wait for a connection.
+type PoolMonitor struct {
+	name string
+	db   *sql.DB
+	last sql.DBStats
+}
+
+// NewPoolMonitor publishes the statistics of the pool under name.
+func NewPoolMonitor(name string, db *sql.DB) *PoolMonitor {
+
+	poolVars.Set(name, expvar.Func(func() any {
+		return db.Stats()
+	}))
+
+	return &PoolMonitor{
+		name: name,
+		db:   db,
+		last: db.Stats(),
+	}
+}
+
+// Check logs the queries that waited for a connection since the last check.
+func (m *PoolMonitor) Check(ctx context.Context) error {
+
+	stats := m.db.Stats()
+	if waits := stats.WaitCount - m.last.WaitCount; waits > 0 {
+		log.Printf("db pool %s saturated: %d queries waited %s for a connection, %d of %d connections in use", m.name, waits, stats.WaitDuration-m.last.WaitDuration, stats.InUse, stats.MaxOpenConnections)
+	}
+
+	m.last = stats
+	return nil
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// AbandonedCart records a cart whose items were untouched since LastActivityAt
+// without an order being placed. UserID is 0 for guest carts.
+type AbandonedCart struct {
+	ID             int        `json:"id"`
+	CartID         int        `json:"cart_id"`
+	UserID         int        `json:"user_id"`
+	ItemCount      int        `json:"item_count"`
+	Value          float64    `json:"value"`
+	LastActivityAt time.Time  `json:"last_activity_at"`
+	DetectedAt     time.Time  `json:"detected_at"`
+	NotifiedAt     *time.Time `json:"notified_at"`
+}
@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+type Address struct {
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	Label             string    `json:"label"`
+	RecipientName     string    `json:"recipient_name"`
+	Phone             string    `json:"phone"`
+	Line1             string    `json:"line1"`
+	Line2             string    `json:"line2"`
+	City              string    `json:"city"`
+	State             string    `json:"state"`
+	PostalCode        string    `json:"postal_code"`
+	Country           string    `json:"country"`
+	IsDefaultShipping bool      `json:"is_default_shipping"`
+	IsDefaultBilling  bool      `json:"is_default_billing"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// OrderAddress is an immutable copy of an address taken at checkout time.
+type OrderAddress struct {
+	ID            int       `json:"id"`
+	OrderID       int       `json:"order_id"`
+	RecipientName string    `json:"recipient_name"`
+	Phone         string    `json:"phone"`
+	Line1         string    `json:"line1"`
+	Line2         string    `json:"line2"`
+	City          string    `json:"city"`
+	State         string    `json:"state"`
+	PostalCode    string    `json:"postal_code"`
+	Country       string    `json:"country"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,64 @@
+package entity
+
+import "time"
+
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeEnum    = "enum"
+)
+
+// Attribute is a typed product property defined on a category. It applies to
+// the products of the category and of all its subcategories. Options lists
+// the allowed values of enum attributes.
+type Attribute struct {
+	ID         int       `json:"id"`
+	CategoryID int       `json:"category_id"`
+	Code       string    `json:"code"`
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	Required   bool      `json:"required"`
+	Filterable bool      `json:"filterable"`
+	Options    []string  `json:"options,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ProductAttribute is the value of an attribute on a product, stored in its
+// canonical string form.
+type ProductAttribute struct {
+	ProductID   int    `json:"product_id"`
+	AttributeID int    `json:"attribute_id"`
+	Code        string `json:"code"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+}
+
+// ProductFilter selects products by category (including subcategories), price
+// range and attribute values. Products match an attribute when they have any
+// of its values. Drafts and unpublished products are only selected with
+// IncludeHidden.
+type ProductFilter struct {
+	CategoryID int
+	MinPrice   *float64
+	MaxPrice   *float64
+	Attributes map[string][]string
+	// AttributeIDs is the attribute each code of Attributes resolves to, as
+	// codes are only unique within a category tree.
+	AttributeIDs  map[string]int
+	IncludeHidden bool
+}
+
+// Facet counts the products of a result set by value of a filterable attribute.
+type Facet struct {
+	AttributeID int          `json:"attribute_id"`
+	Code        string       `json:"code"`
+	Name        string       `json:"name"`
+	Values      []FacetValue `json:"values"`
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
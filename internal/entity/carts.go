@@ -2,19 +2,47 @@ package entity
 
 import "time"
 
+// Cart belongs to a user, or to a guest identified by Token when UserID is 0.
 type Cart struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"user_id"`
+	Token     string    `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// CartItem keeps the product price seen when the item was added in Price.
+// PriceChanged and ProductDeleted are computed when the cart is read. VariantID
+// is 0 for products without variants.
 type CartItem struct {
-	ID        int       `json:"id"`
-	CartID    int       `json:"cart_id"`
-	ProductID int       `json:"product_id"`
-	Quantity  int       `json:"quantity"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Product   Product   `json:"product"`
+	ID             int             `json:"id"`
+	CartID         int             `json:"cart_id"`
+	ProductID      int             `json:"product_id"`
+	VariantID      int             `json:"variant_id"`
+	Quantity       int             `json:"quantity"`
+	Price          float64         `json:"price"`
+	PriceChanged   bool            `json:"price_changed"`
+	ProductDeleted bool            `json:"product_deleted"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Product        Product         `json:"product"`
+	Variant        *ProductVariant `json:"variant,omitempty"`
+}
+
+// CartLine identifies an item of a cart, a product can be in the cart once per variant.
+type CartLine struct {
+	ProductID int
+	VariantID int
+}
+
+func (c *CartItem) Line() CartLine {
+	return CartLine{ProductID: c.ProductID, VariantID: c.VariantID}
+}
+
+// UnitPrice returns the current price of the product or its variant.
+func (c *CartItem) UnitPrice() float64 {
+	if c.Variant != nil {
+		return c.Variant.PriceOf(&c.Product)
+	}
+	return c.Product.Price
 }
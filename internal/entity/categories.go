@@ -2,10 +2,15 @@ package entity
 
 import "time"
 
+// Category is a node of the category tree, ParentID is nil for root categories.
+// Deleted categories keep their place in the tree until they are purged.
 type Category struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Products  []Product `json:"products,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	ParentID  *int        `json:"parent_id"`
+	Products  []Product   `json:"products,omitempty"`
+	Children  []*Category `json:"children,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	DeletedAt *time.Time  `json:"deleted_at,omitempty"`
 }
@@ -3,11 +3,14 @@ package entity
 import "time"
 
 type OrderDetail struct {
-	ID        int       `json:"id"`
-	OrderID   int       `json:"order_id"`
-	ProductID int       `json:"product_id"`
-	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
+	ID        int     `json:"id"`
+	OrderID   int     `json:"order_id"`
+	ProductID int     `json:"product_id"`
+	VariantID int     `json:"variant_id"`
+	Quantity  int     `json:"quantity"`
+	Price     float64 `json:"price"`
+	// SKU is the SKU sold, of the variant when there is one.
+	SKU       string    `json:"sku,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Product   *Product  `json:"product"`
@@ -2,12 +2,56 @@ package entity
 
 import "time"
 
+const (
+	OrderStatusPending          = "PENDING"
+	OrderStatusPaid             = "paid"
+	OrderStatusPartiallyShipped = "partially_shipped"
+	OrderStatusShipped          = "shipped"
+	OrderStatusDelivered        = "delivered"
+	OrderStatusCancelled        = "cancelled"
+)
+
+// Order totals are in the store currency. TotalAmount includes the shipping
+// cost, the store charges no tax and gives no discount.
 type Order struct {
-	ID           int            `json:"id"`
-	UserID       int            `json:"user_id"`
-	Status       string         `json:"status"`
-	TotalAmount  float64        `json:"total_amount"`
-	OrderDetails []*OrderDetail `json:"order_details"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	ID               int            `json:"id"`
+	UserID           int            `json:"user_id"`
+	Status           string         `json:"status"`
+	TotalAmount      float64        `json:"total_amount"`
+	ShippingMethodID int            `json:"shipping_method_id"`
+	ShippingCost     float64        `json:"shipping_cost"`
+	OrderDetails     []*OrderDetail `json:"order_details"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+// OrderSummary is an order of a list with its customer and number of lines.
+type OrderSummary struct {
+	Order
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	ItemCount int    `json:"item_count"`
+}
+
+// OrderFilter selects the orders of a list, the zero values match every order.
+// From is inclusive and To exclusive. Page starts at 1.
+type OrderFilter struct {
+	UserID   int
+	Status   string
+	From     *time.Time
+	To       *time.Time
+	MinTotal *float64
+	MaxTotal *float64
+	Page     int
+	PerPage  int
+}
+
+// OrderNote is an internal note of the staff on an order.
+type OrderNote struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	AuthorID  int       `json:"author_id"`
+	Author    string    `json:"author"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+const (
+	PriceSourceManual   = "manual"
+	PriceSourceSchedule = "schedule"
+)
+
+// PriceChange is an entry of the price history of a product, recorded every
+// time its price changes. ScheduleID is set for the changes made by a schedule.
+type PriceChange struct {
+	ID         int       `json:"id"`
+	ProductID  int       `json:"product_id"`
+	Price      float64   `json:"price"`
+	Source     string    `json:"source"`
+	ScheduleID *int      `json:"schedule_id,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+const (
+	PriceSchedulePending   = "pending"
+	PriceScheduleActive    = "active"
+	PriceScheduleCompleted = "completed"
+	PriceScheduleCancelled = "cancelled"
+)
+
+// PriceSchedule sets the price of a product from StartsAt, and puts back the
+// price it replaced, RegularPrice, at EndsAt. Schedules without EndsAt change
+// the price for good.
+type PriceSchedule struct {
+	ID           int        `json:"id"`
+	ProductID    int        `json:"product_id"`
+	Price        float64    `json:"price"`
+	RegularPrice *float64   `json:"regular_price"`
+	StartsAt     time.Time  `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// ProductImage is an uploaded image of a product. Key locates the original in
+// the media storage, the thumbnails are stored next to it.
+type ProductImage struct {
+	ID          int       `json:"id"`
+	ProductID   int       `json:"product_id"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Position    int       `json:"position"`
+	CreatedAt   time.Time `json:"created_at"`
+}
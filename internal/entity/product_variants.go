@@ -0,0 +1,37 @@
+package entity
+
+import "time"
+
+// ProductOption is a dimension a product varies by, e.g. size with the values S, M and L.
+type ProductOption struct {
+	ID        int      `json:"id"`
+	ProductID int      `json:"product_id"`
+	Name      string   `json:"name"`
+	Values    []string `json:"values"`
+	Position  int      `json:"position"`
+}
+
+// ProductVariant is a purchasable combination of option values. Price overrides
+// the product price when set, Stock is not tracked when nil.
+type ProductVariant struct {
+	ID        int               `json:"id"`
+	ProductID int               `json:"product_id"`
+	SKU       string            `json:"sku"`
+	Price     *float64          `json:"price"`
+	Stock     *int              `json:"stock"`
+	Options   map[string]string `json:"options"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// PriceOf returns the price of the variant of product.
+func (v *ProductVariant) PriceOf(product *Product) float64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return product.Price
+}
+
+func (v *ProductVariant) InStock() bool {
+	return v.Stock == nil || *v.Stock > 0
+}
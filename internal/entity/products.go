@@ -2,12 +2,53 @@ package entity
 
 import "time"
 
+const (
+	ProductDraft       = "draft"
+	ProductPublished   = "published"
+	ProductUnpublished = "unpublished"
+)
+
+// Product is shown in the catalog once published. PublishAt and UnpublishAt
+// schedule the next state changes and are cleared when they are applied. SKU is
+// optional and identifies the product in imports.
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price"`
-	CategoryID  int       `json:"category_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	SKU         string     `json:"sku"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Price       float64    `json:"price"`
+	CategoryID  int        `json:"category_id"`
+	Weight      float64    `json:"weight"`
+	Length      float64    `json:"length"`
+	Width       float64    `json:"width"`
+	Height      float64    `json:"height"`
+	Stock       *int       `json:"stock"`
+	Status      string     `json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// InStock reports whether the product can be ordered. Products without tracked stock always can.
+func (p *Product) InStock() bool {
+	return p.Stock == nil || *p.Stock > 0
+}
+
+// Visible reports whether customers see the product at the given time.
+func (p *Product) Visible(now time.Time) bool {
+	return p.DeletedAt == nil && ProductVisible(p.Status, p.PublishAt, p.UnpublishAt, now)
+}
+
+// ProductVisible applies the publishing schedule without waiting for the
+// scheduler to change the status: a product is visible when it is published or
+// its publication time has passed, and its unpublication time has not.
+func ProductVisible(status string, publishAt, unpublishAt *time.Time, now time.Time) bool {
+
+	if unpublishAt != nil && !unpublishAt.After(now) {
+		return false
+	}
+
+	return status == ProductPublished || (publishAt != nil && !publishAt.After(now))
 }
@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// SalesDay is the daily rollup of the orders placed on Day in Timezone.
+// Revenue sums the order totals less the refunds of their returns. A day is Final once it has ended, open days
+// are computed again until then.
+type SalesDay struct {
+	Timezone           string    `json:"timezone"`
+	Day                time.Time `json:"day"`
+	Orders             int       `json:"orders"`
+	Revenue            float64   `json:"revenue"`
+	Units              int       `json:"units"`
+	NewCustomers       int       `json:"new_customers"`
+	ReturningCustomers int       `json:"returning_customers"`
+	Final              bool      `json:"final"`
+}
+
+// ProductSales is the daily rollup of the units of a product sold and their
+// revenue, the quantity times the price paid.
+type ProductSales struct {
+	ProductID int     `json:"product_id"`
+	Units     int     `json:"units"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// TopSeller ranks a product or a category in a report.
+type TopSeller struct {
+	ID      int     `json:"id"`
+	Name    string  `json:"name"`
+	Units   int     `json:"units"`
+	Revenue float64 `json:"revenue"`
+}
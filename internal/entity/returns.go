@@ -0,0 +1,59 @@
+package entity
+
+import "time"
+
+const (
+	ReturnStatusRequested         = "requested"
+	ReturnStatusApproved          = "approved"
+	ReturnStatusRejected          = "rejected"
+	ReturnStatusReceived          = "received"
+	ReturnStatusPartiallyRefunded = "partially_refunded"
+	ReturnStatusRefunded          = "refunded"
+)
+
+// Return is a customer request to send back items of a delivered order.
+type Return struct {
+	ID             int             `json:"id"`
+	OrderID        int             `json:"order_id"`
+	UserID         int             `json:"user_id"`
+	Status         string          `json:"status"`
+	Reason         string          `json:"reason"`
+	ApprovedAmount float64         `json:"approved_amount"`
+	RefundedAmount float64         `json:"refunded_amount"`
+	ReceivedAt     *time.Time      `json:"received_at"`
+	Items          []ReturnItem    `json:"items"`
+	Refunds        []Refund        `json:"refunds,omitempty"`
+	History        []ReturnHistory `json:"history,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type ReturnItem struct {
+	ID            int     `json:"id"`
+	ReturnID      int     `json:"return_id"`
+	OrderDetailID int     `json:"order_detail_id"`
+	ProductID     int     `json:"product_id"`
+	Quantity      int     `json:"quantity"`
+	Price         float64 `json:"price"`
+}
+
+type Refund struct {
+	ID        int       `json:"id"`
+	ReturnID  int       `json:"return_id"`
+	OrderID   int       `json:"order_id"`
+	Amount    float64   `json:"amount"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReturnHistory is the audit trail of a return, stored against its order.
+type ReturnHistory struct {
+	ID        int       `json:"id"`
+	ReturnID  int       `json:"return_id"`
+	OrderID   int       `json:"order_id"`
+	Action    string    `json:"action"`
+	Note      string    `json:"note"`
+	Amount    float64   `json:"amount"`
+	ActorID   int       `json:"actor_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package entity
+
+import "time"
+
+const (
+	ShipmentStatusShipped        = "shipped"
+	ShipmentStatusInTransit      = "in_transit"
+	ShipmentStatusOutForDelivery = "out_for_delivery"
+	ShipmentStatusDelivered      = "delivered"
+	ShipmentStatusException      = "exception"
+)
+
+type Shipment struct {
+	ID             int             `json:"id"`
+	OrderID        int             `json:"order_id"`
+	CarrierCode    string          `json:"carrier_code"`
+	TrackingNumber string          `json:"tracking_number"`
+	Status         string          `json:"status"`
+	ShippedAt      time.Time       `json:"shipped_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	Items          []ShipmentItem  `json:"items"`
+	Events         []ShipmentEvent `json:"events,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// ShipmentItem is the quantity of an order line contained in a shipment.
+type ShipmentItem struct {
+	ID            int `json:"id"`
+	ShipmentID    int `json:"shipment_id"`
+	OrderDetailID int `json:"order_detail_id"`
+	Quantity      int `json:"quantity"`
+}
+
+// ShipmentEvent is a status update reported by the carrier.
+type ShipmentEvent struct {
+	ID          int       `json:"id"`
+	ShipmentID  int       `json:"shipment_id"`
+	Status      string    `json:"status"`
+	Description string    `json:"description"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+const (
+	ShippingTypeFlatRate          = "flat_rate"
+	ShippingTypeWeightBased       = "weight_based"
+	ShippingTypeFreeOverThreshold = "free_over_threshold"
+	ShippingTypeLocalPickup       = "local_pickup"
+)
+
+// ShippingMethod describes how a delivery is priced. Countries is a comma
+// separated list of country names the method is offered for, empty means everywhere.
+type ShippingMethod struct {
+	ID            int       `json:"id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	BaseRate      float64   `json:"base_rate"`
+	RatePerKg     float64   `json:"rate_per_kg"`
+	FreeThreshold float64   `json:"free_threshold"`
+	Countries     string    `json:"countries"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// Wishlist is a named list of products of a user. It can be read by anyone with
+// ShareToken when it is public.
+type Wishlist struct {
+	ID         int             `json:"id"`
+	UserID     int             `json:"user_id"`
+	Name       string          `json:"name"`
+	ShareToken string          `json:"share_token,omitempty"`
+	Items      []*WishlistItem `json:"items,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// WishlistItem keeps the price and availability last reported to the user, they
+// are compared with the product, or with the variant when VariantID is set, to
+// notify price drops and restocks.
+type WishlistItem struct {
+	ID         int             `json:"id"`
+	WishlistID int             `json:"wishlist_id"`
+	ProductID  int             `json:"product_id"`
+	VariantID  int             `json:"variant_id,omitempty"`
+	Quantity   int             `json:"quantity"`
+	Price      float64         `json:"price"`
+	InStock    bool            `json:"in_stock"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+	Product    Product         `json:"product"`
+	Variant    *ProductVariant `json:"variant,omitempty"`
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type AddressHandler struct {
+	addressSvc services.AddressService
+}
+
+func NewAddressHandler(addressSvc services.AddressService) *AddressHandler {
+	return &AddressHandler{
+		addressSvc: addressSvc,
+	}
+}
+
+func (a *AddressHandler) GetAddresses(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	response, err := a.addressSvc.GetAddresses(ctx, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}, w, http.StatusInternalServerError)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (a *AddressHandler) GetAddressByID(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := a.addressSvc.GetAddressByID(ctx, id, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}, w, http.StatusNotFound)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (a *AddressHandler) StoreAddress(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	var request model.AddressRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := a.addressSvc.StoreAddress(ctx, request, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusCreated, helper.Response{
+		Code:    http.StatusCreated,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (a *AddressHandler) UpdateAddress(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.AddressRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.AddressID = id
+
+	err = a.addressSvc.UpdateAddress(ctx, request, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Update Address",
+	})
+}
+
+func (a *AddressHandler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	err = a.addressSvc.DeleteAddress(ctx, model.DeleteAddressRequest{AddressID: id}, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Delete Address",
+	})
+}
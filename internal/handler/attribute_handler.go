@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type AttributeHandler struct {
+	attributeSvc services.AttributeService
+}
+
+func NewAttributeHandler(attributeSvc services.AttributeService) *AttributeHandler {
+	return &AttributeHandler{
+		attributeSvc: attributeSvc,
+	}
+}
+
+func (h *AttributeHandler) GetAttributes(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid category id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.attributeSvc.GetAttributes(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *AttributeHandler) StoreAttribute(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusCreated, h.attributeSvc.StoreAttribute)
+}
+
+func (h *AttributeHandler) UpdateAttribute(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusOK, h.attributeSvc.UpdateAttribute)
+}
+
+// write decodes the attribute of the category in the path and passes it to action.
+func (h *AttributeHandler) write(w http.ResponseWriter, r *http.Request, status int, action func(context.Context, model.AttributeRequest) (*entity.Attribute, error)) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	categoryID, attributeID, err := attributePath(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.AttributeRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.CategoryID = categoryID
+	request.AttributeID = attributeID
+
+	response, err := action(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, status, helper.Response{
+		Code:    status,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *AttributeHandler) DeleteAttribute(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	categoryID, attributeID, err := attributePath(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.attributeSvc.DeleteAttribute(ctx, categoryID, attributeID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Delete Attribute",
+	})
+}
+
+// attributePath reads the ids of /category/{id}/attribute/{attribute_id} routes,
+// the attribute id is 0 on /category/{id}/attribute.
+func attributePath(r *http.Request) (int, int, error) {
+
+	vars := mux.Vars(r)
+
+	categoryID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if vars["attribute_id"] == "" {
+		return categoryID, 0, nil
+	}
+
+	attributeID, err := strconv.Atoi(vars["attribute_id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return categoryID, attributeID, nil
+}
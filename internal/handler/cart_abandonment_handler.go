@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/services"
+)
+
+type CartAbandonmentHandler struct {
+	abandonmentSvc services.CartAbandonmentService
+}
+
+func NewCartAbandonmentHandler(abandonmentSvc services.CartAbandonmentService) *CartAbandonmentHandler {
+	return &CartAbandonmentHandler{
+		abandonmentSvc: abandonmentSvc,
+	}
+}
+
+// Stats accepts the inclusive dates from and to (YYYY-MM-DD) and defaults to the last 30 days.
+func (h *CartAbandonmentHandler) Stats(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	from, to, err := dateRange(r, 30)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.abandonmentSvc.Stats(ctx, from, to)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -57,10 +58,7 @@ func (c *CartHandler) AddToCart(w http.ResponseWriter, r *http.Request) {
 
 	_, err = c.cartSvc.AddToCart(ctx, request, userCtx.ID)
 	if err != nil {
-		helper.ErrorJSON(helper.Response{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		}, w, http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
 
@@ -128,8 +126,18 @@ func (c *CartHandler) DeleteProductFromCart(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	variantID, err := variantIDQuery(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid variant id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
 	request := model.DeleteProductRequest{
 		ProductID: productID,
+		VariantID: variantID,
 	}
 
 	err = c.cartSvc.RemoveFromCart(ctx, request, userCtx.ID)
@@ -215,11 +223,165 @@ func (c *CartHandler) ModifyCart(w http.ResponseWriter, r *http.Request) {
 	request.ProductID = productID
 
 	err = c.cartSvc.ModifyCart(ctx, request, userCtx.ID)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Modify Cart Success",
+	})
+}
+
+func (c *CartHandler) GuestAddToCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var request model.CartItemsRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "cannot modify cart",
-		}, w, http.StatusInternalServerError)
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	_, token, err := c.cartSvc.AddToGuestCart(ctx, request, helper.GetCartToken(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	helper.SetCartToken(w, token)
+	helper.WriteJSON(w, http.StatusCreated, helper.Response{
+		Code:    http.StatusCreated,
+		Message: "Success",
+		Status:  "Product added to cart successfully",
+		Data:    map[string]string{"cart_token": token},
+	})
+}
+
+func (c *CartHandler) GuestCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	response, err := c.cartSvc.ViewGuestCart(ctx, helper.GetCartToken(r))
+	if err != nil {
+		status := http.StatusInternalServerError
+		var invalid *services.InvalidRequestError
+		if errors.As(err, &invalid) {
+			status = http.StatusNotFound
+		}
+
+		helper.ErrorJSON(helper.Response{
+			Code:    status,
+			Message: err.Error(),
+		}, w, status)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Status:  "Success",
+		Message: "List of products in the shopping cart",
+		Data:    response,
+	})
+}
+
+func (c *CartHandler) GuestDeleteProductFromCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	pathParam := mux.Vars(r)["id"]
+	productID, err := strconv.Atoi(pathParam)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	variantID, err := variantIDQuery(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid variant id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request := model.DeleteProductRequest{
+		ProductID: productID,
+		VariantID: variantID,
+	}
+
+	err = c.cartSvc.RemoveFromGuestCart(ctx, request, helper.GetCartToken(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Delete Product from Cart Success",
+	})
+}
+
+func (c *CartHandler) GuestEmptyCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	err := c.cartSvc.EmptyGuestCart(ctx, helper.GetCartToken(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Empty Cart Success",
+	})
+}
+
+func (c *CartHandler) GuestModifyCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	pathParam := mux.Vars(r)["id"]
+	productID, err := strconv.Atoi(pathParam)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.ModifyCartRequest
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = productID
+
+	err = c.cartSvc.ModifyGuestCart(ctx, request, helper.GetCartToken(r))
+	if err != nil {
+		writeRequestError(w, err)
 		return
 	}
 
@@ -228,3 +390,132 @@ func (c *CartHandler) ModifyCart(w http.ResponseWriter, r *http.Request) {
 		Message: "Modify Cart Success",
 	})
 }
+
+func (c *CartHandler) BatchCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	var request model.CartBatchRequest
+
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := c.cartSvc.BatchCart(ctx, request, userCtx.ID)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	writeCartBatch(w, response)
+}
+
+func (c *CartHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid order id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := c.cartSvc.Reorder(ctx, id, userCtx.ID)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	writeCartBatch(w, response)
+}
+
+func (c *CartHandler) GuestBatchCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	var request model.CartBatchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, token, err := c.cartSvc.BatchGuestCart(ctx, request, helper.GetCartToken(r))
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	helper.SetCartToken(w, token)
+	writeCartBatch(w, response)
+}
+
+// writeRequestError answers 400 with the errors of invalid requests and 500
+// with the internal ones.
+func writeRequestError(w http.ResponseWriter, err error) {
+
+	status := http.StatusInternalServerError
+	var invalid *services.InvalidRequestError
+	if errors.As(err, &invalid) {
+		status = http.StatusBadRequest
+	}
+
+	helper.ErrorJSON(helper.Response{
+		Code:    status,
+		Message: err.Error(),
+	}, w, status)
+}
+
+// writeCartBatch answers 422 with the per-line results when the operations were not applied.
+func writeCartBatch(w http.ResponseWriter, response *model.CartBatchResponse) {
+
+	if !response.Applied {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnprocessableEntity,
+			Message: "cart operations were not applied",
+			Data:    response,
+		}, w, http.StatusUnprocessableEntity)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
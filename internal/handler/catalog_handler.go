@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/services"
+)
+
+// fileTimeout bounds the imports and exports, which run over whole files.
+const fileTimeout = 5 * time.Minute
+
+type CatalogHandler struct {
+	catalogSvc services.CatalogService
+}
+
+func NewCatalogHandler(catalogSvc services.CatalogService) *CatalogHandler {
+	return &CatalogHandler{
+		catalogSvc: catalogSvc,
+	}
+}
+
+// catalogFormat returns the format query parameter, or jsonl for a JSON
+// content type and csv otherwise.
+func catalogFormat(r *http.Request, contentType string) string {
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		return strings.ToLower(format)
+	}
+
+	if strings.Contains(contentType, "json") {
+		return services.FormatJSONL
+	}
+
+	return services.FormatCSV
+}
+
+// ImportProducts imports the CSV or JSON Lines file sent as the request body.
+// With dry_run=true the rows are only validated.
+func (h *CatalogHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			helper.ErrorJSON(helper.Response{
+				Code:    http.StatusBadRequest,
+				Message: "invalid dry_run",
+			}, w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.catalogSvc.Import(ctx, r.Body, catalogFormat(r, r.Header.Get("Content-Type")), dryRun)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    report,
+	})
+}
+
+// ExportProducts streams the products as a CSV or JSON Lines attachment.
+func (h *CatalogHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+
+	format := catalogFormat(r, "")
+
+	contentType := "text/csv"
+	switch format {
+	case services.FormatCSV:
+	case services.FormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "format must be csv or jsonl",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=products."+format)
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the file short
+	if err := h.catalogSvc.Export(ctx, w, format); err != nil {
+		log.Printf("cannot export products: %v", err)
+	}
+}
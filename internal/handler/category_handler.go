@@ -177,9 +177,9 @@ func (p *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request)
 	err = p.categorySvc.DeleteCategoryByID(ctx, id)
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "cannot delete category",
-		}, w, http.StatusInternalServerError)
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
 		return
 	}
 
@@ -243,3 +243,153 @@ func (p *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request)
 	})
 
 }
+
+func (p *CategoryHandler) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tree, err := p.categorySvc.GetCategoryTree(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}, w, http.StatusInternalServerError)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    tree,
+	})
+}
+
+func (p *CategoryHandler) GetBreadcrumbs(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	breadcrumbs, err := p.categorySvc.GetBreadcrumbs(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}, w, http.StatusNotFound)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    breadcrumbs,
+	})
+}
+
+func (p *CategoryHandler) MoveCategory(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.MoveCategoryRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.CategoryID = id
+
+	category, err := p.categorySvc.MoveCategory(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Move Category",
+		Data:    category,
+	})
+}
+
+func (p *CategoryHandler) GetDeletedCategories(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	categories, err := p.categorySvc.GetDeletedCategories(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}, w, http.StatusInternalServerError)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    categories,
+	})
+}
+
+func (p *CategoryHandler) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	category, err := p.categorySvc.RestoreCategory(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Restore Category",
+		Data:    category,
+	})
+}
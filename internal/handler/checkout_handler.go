@@ -2,11 +2,16 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
 	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
 )
 
 type CheckoutHandler struct {
@@ -33,12 +38,21 @@ func (h *CheckoutHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	response, err := h.checkoutSvc.Checkout(ctx, userCtx.ID)
-	if err != nil {
+	var request model.CheckoutRequest
+
+	// the body is optional, without it the default shipping address is used
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && err != io.EOF {
 		helper.ErrorJSON(helper.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "cannot checkout",
-		}, w, http.StatusInternalServerError)
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.checkoutSvc.Checkout(ctx, request, userCtx.ID)
+	if err != nil {
+		writeRequestError(w, err)
 		return
 	}
 
@@ -50,9 +64,11 @@ func (h *CheckoutHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// CheckoutHistory lists the orders of the user, filtered like the admin order
+// list.
 func (h *CheckoutHandler) CheckoutHistory(w http.ResponseWriter, r *http.Request) {
 
-	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	userCtx, err := helper.GetUserCtx(ctx)
@@ -64,12 +80,21 @@ func (h *CheckoutHandler) CheckoutHistory(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	response, err := h.checkoutSvc.History(ctx, userCtx.ID)
+	filter, err := orderFilter(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.checkoutSvc.History(ctx, userCtx.ID, filter)
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
-			Code:    http.StatusInternalServerError,
-			Message: "cannot get checkout history",
-		}, w, http.StatusInternalServerError)
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
 		return
 	}
 
@@ -80,3 +105,44 @@ func (h *CheckoutHandler) CheckoutHistory(w http.ResponseWriter, r *http.Request
 		Data:    response,
 	})
 }
+
+// GetOrder returns an order of the user.
+func (h *CheckoutHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid order id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.checkoutSvc.GetOrder(ctx, userCtx.ID, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}, w, http.StatusNotFound)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Status:  "Success",
+		Message: "Order",
+		Data:    response,
+	})
+}
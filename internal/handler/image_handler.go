@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+// maxImagesPerUpload bounds the number of files of one upload request.
+const maxImagesPerUpload = 10
+
+type ImageHandler struct {
+	imageSvc services.ImageService
+	maxSize  int64
+}
+
+func NewImageHandler(imageSvc services.ImageService, maxSize int64) *ImageHandler {
+	return &ImageHandler{
+		imageSvc: imageSvc,
+		maxSize:  maxSize,
+	}
+}
+
+// UploadImages stores the files of the multipart "image" fields as images of the product.
+func (h *ImageHandler) UploadImages(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "expected a multipart/form-data body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var images []*model.ProductImage
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			h.uploadFailed(ctx, w, id, images, http.StatusBadRequest, "invalid multipart body")
+			return
+		}
+
+		if part.FormName() != "image" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		if len(images) == maxImagesPerUpload {
+			h.uploadFailed(ctx, w, id, images, http.StatusBadRequest, "too many images, upload at most "+strconv.Itoa(maxImagesPerUpload)+" at once")
+			return
+		}
+
+		data, err := readLimited(part, h.maxSize)
+		part.Close()
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			h.uploadFailed(ctx, w, id, images, status, part.FileName()+": "+err.Error())
+			return
+		}
+
+		image, err := h.imageSvc.UploadImage(ctx, id, data)
+		if err != nil {
+			h.uploadFailed(ctx, w, id, images, http.StatusBadRequest, part.FileName()+": "+err.Error())
+			return
+		}
+
+		images = append(images, image)
+	}
+
+	if len(images) == 0 {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "no image uploaded, send the files in the image field",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusCreated, helper.Response{
+		Code:    http.StatusCreated,
+		Message: "Success",
+		Data:    images,
+	})
+}
+
+// uploadFailed removes the images stored by the upload before the failing file,
+// so that a failed upload stores nothing, and writes the error. The images that
+// cannot be removed are returned with it.
+func (h *ImageHandler) uploadFailed(ctx context.Context, w http.ResponseWriter, productID int, images []*model.ProductImage, status int, message string) {
+
+	// the upload may have failed on its deadline, the removal gets its own
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	var kept []*model.ProductImage
+	for _, image := range images {
+		if err := h.imageSvc.DeleteImage(ctx, productID, image.ID); err != nil {
+			kept = append(kept, image)
+		}
+	}
+
+	if len(kept) > 0 {
+		message += ", the images already stored could not be removed"
+	}
+
+	helper.ErrorJSON(helper.Response{
+		Code:    status,
+		Message: message,
+		Data:    kept,
+	}, w, status)
+}
+
+func (h *ImageHandler) ReorderImages(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.ReorderImagesRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = id
+
+	response, err := h.imageSvc.ReorderImages(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *ImageHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	imageID, err := strconv.Atoi(vars["image_id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid image id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.imageSvc.DeleteImage(ctx, productID, imageID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Delete Image",
+	})
+}
+
+var errTooLarge = errors.New("file is too large")
+
+// readLimited reads r completely, failing with errTooLarge after limit bytes.
+// A limit of 0 or less disables the check.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, errTooLarge
+	}
+
+	return data, nil
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/services"
+)
+
+type OrderExportHandler struct {
+	exportSvc services.OrderExportService
+}
+
+func NewOrderExportHandler(exportSvc services.OrderExportService) *OrderExportHandler {
+	return &OrderExportHandler{
+		exportSvc: exportSvc,
+	}
+}
+
+// dateRange reads the inclusive dates from and to (YYYY-MM-DD) and returns the
+// range up to the end of to, the last days until today by default.
+func dateRange(r *http.Request, days int) (time.Time, time.Time, error) {
+
+	to := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	from := to.AddDate(0, 0, -days)
+
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return from, to, errors.New("invalid from date")
+		}
+	}
+
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return from, to, errors.New("invalid to date")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	return from, to, nil
+}
+
+// ExportOrders streams the orders placed from from until to (YYYY-MM-DD,
+// yesterday and today by default) as a CSV, JSON Lines or XLSX attachment.
+func (h *OrderExportHandler) ExportOrders(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), fileTimeout)
+	defer cancel()
+
+	from, to, err := dateRange(r, 2)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	if !to.After(from) {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "to must be after from",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.FormatCSV
+	}
+
+	var contentType string
+	switch format {
+	case services.FormatCSV:
+		contentType = "text/csv"
+	case services.FormatJSONL:
+		contentType = "application/x-ndjson"
+	case services.FormatXLSX:
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "format must be csv, jsonl or xlsx",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	filename := fmt.Sprintf("orders-%s-%s.%s", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the file short
+	if err := h.exportSvc.Export(ctx, w, format, from, to); err != nil {
+		log.Printf("cannot export orders: %v", err)
+	}
+}
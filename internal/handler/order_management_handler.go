@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type OrderManagementHandler struct {
+	orderSvc services.OrderManagementService
+}
+
+func NewOrderManagementHandler(orderSvc services.OrderManagementService) *OrderManagementHandler {
+	return &OrderManagementHandler{
+		orderSvc: orderSvc,
+	}
+}
+
+// orderFilter reads the status, the inclusive dates from and to (YYYY-MM-DD),
+// min_total, max_total, page and per_page filters of an order list.
+func orderFilter(r *http.Request) (entity.OrderFilter, error) {
+
+	query := r.URL.Query()
+	filter := entity.OrderFilter{Status: query.Get("status")}
+
+	if value := query.Get("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date")
+		}
+		filter.From = &from
+	}
+
+	if value := query.Get("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	var err error
+	if filter.MinTotal, err = floatQuery(query, "min_total"); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxTotal, err = floatQuery(query, "max_total"); err != nil {
+		return filter, err
+	}
+
+	if filter.Page, err = intQuery(query, "page"); err != nil {
+		return filter, err
+	}
+
+	if filter.PerPage, err = intQuery(query, "per_page"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// intQuery returns the integer query parameter, 0 when it is not set.
+func intQuery(query url.Values, name string) (int, error) {
+
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+
+	return n, nil
+}
+
+// ListOrders lists the orders of every customer, user_id selects one.
+func (h *OrderManagementHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	filter, err := orderFilter(r)
+	if err == nil {
+		filter.UserID, err = intQuery(r.URL.Query(), "user_id")
+	}
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderSvc.ListOrders(ctx, filter)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *OrderManagementHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid order id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.orderSvc.GetOrder(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}, w, http.StatusNotFound)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *OrderManagementHandler) AddNote(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid order id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.OrderNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+	request.OrderID = id
+
+	note, err := h.orderSvc.AddNote(ctx, userCtx.ID, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusCreated, helper.Response{
+		Code:    http.StatusCreated,
+		Message: "Success",
+		Data:    note,
+	})
+}
+
+// ChangeStatus moves the order_ids to status, the orders that cannot be moved
+// are listed in the response.
+func (h *OrderManagementHandler) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	var request model.OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.orderSvc.ChangeStatus(ctx, userCtx.ID, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    result,
+	})
+}
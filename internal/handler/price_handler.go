@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type PriceHandler struct {
+	priceSvc services.PriceService
+}
+
+func NewPriceHandler(priceSvc services.PriceService) *PriceHandler {
+	return &PriceHandler{
+		priceSvc: priceSvc,
+	}
+}
+
+func (h *PriceHandler) GetTimeline(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	timeline, err := h.priceSvc.GetTimeline(ctx, id, helper.IsAdmin(ctx))
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}, w, http.StatusNotFound)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    timeline,
+	})
+}
+
+func (h *PriceHandler) SchedulePrice(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.PriceScheduleRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = id
+
+	schedule, err := h.priceSvc.SchedulePrice(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusCreated, helper.Response{
+		Code:    http.StatusCreated,
+		Message: "Success",
+		Data:    schedule,
+	})
+}
+
+func (h *PriceHandler) CancelSchedule(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	scheduleID, err := strconv.Atoi(vars["schedule_id"])
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid schedule id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.priceSvc.CancelSchedule(ctx, productID, scheduleID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Cancel Price Schedule",
+	})
+}
@@ -3,10 +3,14 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aldotp/OnlineStore/internal/entity"
 	"github.com/aldotp/OnlineStore/internal/helper"
 	"github.com/aldotp/OnlineStore/internal/model"
 	"github.com/aldotp/OnlineStore/internal/services"
@@ -38,7 +42,19 @@ func (p *ProductHandler) GetProductsByCategory(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	response, err := p.productSvc.GetProductByCategoryID(ctx, categoryID)
+	includeDescendants := false
+	if value := r.URL.Query().Get("include_descendants"); value != "" {
+		includeDescendants, err = strconv.ParseBool(value)
+		if err != nil {
+			helper.ErrorJSON(helper.Response{
+				Code:    http.StatusBadRequest,
+				Message: "invalid include_descendants",
+			}, w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	response, err := p.productSvc.GetProductByCategoryID(ctx, categoryID, includeDescendants, helper.IsAdmin(ctx))
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
 			Code:    http.StatusBadRequest,
@@ -206,7 +222,7 @@ func (p *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := p.productSvc.GetProducts(ctx)
+	response, err := p.productSvc.GetProducts(ctx, helper.IsAdmin(ctx))
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
 			Code:    http.StatusBadRequest,
@@ -223,6 +239,94 @@ func (p *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// SearchProducts filters products by category_id (including subcategories),
+// min_price, max_price and attr.<code> parameters holding comma separated values.
+func (p *ProductHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	filter, err := productFilter(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := p.productSvc.SearchProducts(ctx, filter)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func productFilter(r *http.Request) (entity.ProductFilter, error) {
+
+	filter := entity.ProductFilter{Attributes: map[string][]string{}, IncludeHidden: helper.IsAdmin(r.Context())}
+	query := r.URL.Query()
+
+	if value := query.Get("category_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid category_id")
+		}
+		filter.CategoryID = id
+	}
+
+	var err error
+	if filter.MinPrice, err = floatQuery(query, "min_price"); err != nil {
+		return filter, err
+	}
+
+	if filter.MaxPrice, err = floatQuery(query, "max_price"); err != nil {
+		return filter, err
+	}
+
+	for name, values := range query {
+		code, ok := strings.CutPrefix(name, "attr.")
+		if !ok {
+			continue
+		}
+
+		for _, value := range values {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					filter.Attributes[code] = append(filter.Attributes[code], part)
+				}
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// floatQuery reads an optional number parameter, nil when it is absent.
+func floatQuery(query url.Values, name string) (*float64, error) {
+
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+
+	return &f, nil
+}
+
 func (p *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
@@ -248,7 +352,7 @@ func (p *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	response, err := p.productSvc.GetProductByID(ctx, id)
+	response, err := p.productSvc.GetProductByID(ctx, id, helper.IsAdmin(ctx))
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
 			Code:    http.StatusBadRequest,
@@ -263,3 +367,100 @@ func (p *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request)
 		Data:    response,
 	})
 }
+
+func (p *ProductHandler) GetDeletedProducts(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	products, err := p.productSvc.GetDeletedProducts(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}, w, http.StatusInternalServerError)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    products,
+	})
+}
+
+func (p *ProductHandler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	product, err := p.productSvc.RestoreProduct(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Restore Product",
+		Data:    product,
+	})
+}
+
+func (p *ProductHandler) SetPublishing(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.PublishingRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = id
+
+	product, err := p.productSvc.SetPublishing(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Update Publishing",
+		Data:    product,
+	})
+}
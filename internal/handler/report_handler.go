@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+)
+
+type ReportHandler struct {
+	reportSvc services.ReportService
+}
+
+func NewReportHandler(reportSvc services.ReportService) *ReportHandler {
+	return &ReportHandler{
+		reportSvc: reportSvc,
+	}
+}
+
+// reportRequest reads the inclusive dates from and to (the last 30 days by
+// default), timezone, interval, sort and limit.
+func reportRequest(r *http.Request) (model.ReportRequest, error) {
+
+	from, to, err := dateRange(r, 30)
+	if err != nil {
+		return model.ReportRequest{}, err
+	}
+
+	query := r.URL.Query()
+	request := model.ReportRequest{
+		From:     from,
+		To:       to,
+		Timezone: query.Get("timezone"),
+		Interval: query.Get("interval"),
+		Sort:     query.Get("sort"),
+	}
+
+	if value := query.Get("limit"); value != "" {
+		request.Limit, err = strconv.Atoi(value)
+		if err != nil {
+			return request, errors.New("invalid limit")
+		}
+	}
+
+	return request, nil
+}
+
+func (h *ReportHandler) Sales(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(ctx context.Context, request model.ReportRequest) (any, error) {
+		return h.reportSvc.Sales(ctx, request)
+	})
+}
+
+func (h *ReportHandler) TopProducts(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(ctx context.Context, request model.ReportRequest) (any, error) {
+		return h.reportSvc.TopProducts(ctx, request)
+	})
+}
+
+func (h *ReportHandler) TopCategories(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(ctx context.Context, request model.ReportRequest) (any, error) {
+		return h.reportSvc.TopCategories(ctx, request)
+	})
+}
+
+func (h *ReportHandler) report(w http.ResponseWriter, r *http.Request, run func(context.Context, model.ReportRequest) (any, error)) {
+
+	// days missing from the rollups are computed on the fly
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	request, err := reportRequest(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := run(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
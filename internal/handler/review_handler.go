@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type ReviewHandler struct {
+	reviewSvc services.ReviewService
+}
+
+func NewReviewHandler(reviewSvc services.ReviewService) *ReviewHandler {
+	return &ReviewHandler{
+		reviewSvc: reviewSvc,
+	}
+}
+
+func (h *ReviewHandler) GetProductReviews(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := h.reviewSvc.GetProductReviews(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}, w, http.StatusInternalServerError)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *ReviewHandler) StoreReview(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusCreated, h.reviewSvc.StoreReview)
+}
+
+func (h *ReviewHandler) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusOK, h.reviewSvc.UpdateReview)
+}
+
+// write decodes the review of the product in the path and passes it to action.
+func (h *ReviewHandler) write(w http.ResponseWriter, r *http.Request, status int, action func(context.Context, model.ReviewRequest, int) (*entity.Review, error)) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.ReviewRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = id
+
+	response, err := action(ctx, request, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, status, helper.Response{
+		Code:    status,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *ReviewHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.reviewSvc.DeleteReview(ctx, id, userCtx.ID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Delete Review",
+	})
+}
+
+func (h *ReviewHandler) GetReviews(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	response, err := h.reviewSvc.GetReviews(ctx, r.URL.Query().Get("status"))
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}, w, http.StatusInternalServerError)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *ReviewHandler) ApproveReview(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, h.reviewSvc.Approve)
+}
+
+func (h *ReviewHandler) RejectReview(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, h.reviewSvc.Reject)
+}
+
+func (h *ReviewHandler) moderate(w http.ResponseWriter, r *http.Request, action func(context.Context, int) (*entity.Review, error)) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := action(ctx, id)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
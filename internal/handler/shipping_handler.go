@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+)
+
+type ShippingHandler struct {
+	shippingSvc services.ShippingService
+}
+
+func NewShippingHandler(shippingSvc services.ShippingService) *ShippingHandler {
+	return &ShippingHandler{
+		shippingSvc: shippingSvc,
+	}
+}
+
+func (s *ShippingHandler) Quote(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userCtx, err := helper.GetUserCtx(ctx)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusUnauthorized,
+			Message: "unauthorized",
+		}, w, http.StatusUnauthorized)
+		return
+	}
+
+	var request model.ShippingQuoteRequest
+
+	// the body is optional, without it the default shipping address is used
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && err != io.EOF {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.shippingSvc.Quote(ctx, request, userCtx.ID)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
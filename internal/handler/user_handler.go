@@ -36,6 +36,10 @@ func (u *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if request.CartToken == "" {
+		request.CartToken = helper.GetCartToken(r)
+	}
+
 	loginResponse, err := u.UserService.LoginUser(ctx, request)
 	if err != nil {
 		helper.ErrorJSON(helper.Response{
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/helper"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/gorilla/mux"
+)
+
+type VariantHandler struct {
+	variantSvc services.VariantService
+}
+
+func NewVariantHandler(variantSvc services.VariantService) *VariantHandler {
+	return &VariantHandler{
+		variantSvc: variantSvc,
+	}
+}
+
+func (h *VariantHandler) SetOptions(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	paramID := mux.Vars(r)["id"]
+
+	id, err := strconv.Atoi(paramID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid product id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.ProductOptionsRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = id
+
+	response, err := h.variantSvc.SetOptions(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *VariantHandler) StoreVariant(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusCreated, h.variantSvc.StoreVariant)
+}
+
+func (h *VariantHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, http.StatusOK, h.variantSvc.UpdateVariant)
+}
+
+// write decodes the variant of the product in the path and passes it to action.
+func (h *VariantHandler) write(w http.ResponseWriter, r *http.Request, status int, action func(context.Context, model.VariantRequest) (*entity.ProductVariant, error)) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	productID, variantID, err := variantPath(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	var request model.VariantRequest
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid json body",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	request.ProductID = productID
+	request.VariantID = variantID
+
+	response, err := action(ctx, request)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, status, helper.Response{
+		Code:    status,
+		Message: "Success",
+		Data:    response,
+	})
+}
+
+func (h *VariantHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	productID, variantID, err := variantPath(r)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: "invalid id",
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	err = h.variantSvc.DeleteVariant(ctx, productID, variantID)
+	if err != nil {
+		helper.ErrorJSON(helper.Response{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}, w, http.StatusBadRequest)
+		return
+	}
+
+	helper.WriteJSON(w, http.StatusOK, helper.Response{
+		Code:    http.StatusOK,
+		Message: "Success Delete Variant",
+	})
+}
+
+// variantPath reads the ids of /product/{id}/variant/{variant_id} routes, the
+// variant id is 0 on /product/{id}/variant.
+func variantPath(r *http.Request) (int, int, error) {
+
+	vars := mux.Vars(r)
+
+	productID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if vars["variant_id"] == "" {
+		return productID, 0, nil
+	}
+
+	variantID, err := strconv.Atoi(vars["variant_id"])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return productID, variantID, nil
+}
+
+// variantIDQuery reads the optional variant_id query parameter.
+func variantIDQuery(r *http.Request) (int, error) {
+
+	value := r.URL.Query().Get("variant_id")
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(value)
+}
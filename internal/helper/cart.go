@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	CartTokenHeader = "X-Cart-Token"
+	CartTokenCookie = "cart_token"
+)
+
+// GetCartToken returns the guest cart token from the X-Cart-Token header or the cart_token cookie.
+func GetCartToken(r *http.Request) string {
+	if token := r.Header.Get(CartTokenHeader); token != "" {
+		return token
+	}
+
+	cookie, err := r.Cookie(CartTokenCookie)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+// SetCartToken hands the guest cart token back to the client as header and cookie.
+func SetCartToken(w http.ResponseWriter, token string) {
+	w.Header().Set(CartTokenHeader, token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     CartTokenCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(30 * 24 * time.Hour),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
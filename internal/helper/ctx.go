@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/aldotp/OnlineStore/internal/entity"
 	"github.com/aldotp/OnlineStore/internal/middleware"
 	"github.com/aldotp/OnlineStore/internal/model"
 )
@@ -16,5 +17,12 @@ func GetUserCtx(ctx context.Context) (*model.UserCtx, error) {
 	return &model.UserCtx{
 		ID:       claims.ID,
 		Username: claims.Username,
+		Role:     claims.Role,
 	}, nil
 }
+
+// IsAdmin reports whether the authenticated user has the admin role.
+func IsAdmin(ctx context.Context) bool {
+	claims, ok := ctx.Value("claims").(*middleware.Claims)
+	return ok && claims.Role == entity.RoleAdmin
+}
@@ -17,6 +17,7 @@ import (
 type Claims struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
 	jwt.StandardClaims
 }
 
@@ -38,6 +39,7 @@ func (j *JWT) GenerateJWT(user *entity.User) (string, string, error) {
 	claims := &Claims{
 		ID:       user.ID,
 		Username: user.Username,
+		Role:     user.Role,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
@@ -95,3 +97,17 @@ func (j *JWT) AuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AdminMiddleware only lets requests through when the authenticated user has the admin role.
+// It must be used after AuthMiddleware.
+func (j *JWT) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value("claims").(*Claims)
+		if !ok || claims.Role != entity.RoleAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
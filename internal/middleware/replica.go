@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/aldotp/OnlineStore/internal/replica"
+)
+
+// Pinning sends the reads of a user to the primary database while they write
+// and for a while after, see replica.Router. It must be used after
+// AuthMiddleware.
+func Pinning(router *replica.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value("claims").(*Claims)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			write := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+			if write || router.Pinned(claims.ID) {
+				r = r.WithContext(replica.WithPrimary(r.Context()))
+			}
+
+			next.ServeHTTP(w, r)
+
+			if write {
+				router.Pin(claims.ID)
+			}
+		})
+	}
+}
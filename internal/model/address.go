@@ -0,0 +1,20 @@
+package model
+
+type AddressRequest struct {
+	AddressID         int    `json:"address_id"`
+	Label             string `json:"label"`
+	RecipientName     string `json:"recipient_name"`
+	Phone             string `json:"phone"`
+	Line1             string `json:"line1"`
+	Line2             string `json:"line2"`
+	City              string `json:"city"`
+	State             string `json:"state"`
+	PostalCode        string `json:"postal_code"`
+	Country           string `json:"country"`
+	IsDefaultShipping *bool  `json:"is_default_shipping"`
+	IsDefaultBilling  *bool  `json:"is_default_billing"`
+}
+
+type DeleteAddressRequest struct {
+	AddressID int `json:"address_id"`
+}
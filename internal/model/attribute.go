@@ -0,0 +1,21 @@
+package model
+
+import "github.com/aldotp/OnlineStore/internal/entity"
+
+// AttributeRequest defines an attribute of a category. Code and Type cannot be
+// changed once the attribute exists.
+type AttributeRequest struct {
+	CategoryID  int      `json:"category_id"`
+	AttributeID int      `json:"attribute_id"`
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Filterable  bool     `json:"filterable"`
+	Options     []string `json:"options"`
+}
+
+type ProductSearchResponse struct {
+	Products []ProductResponse `json:"products"`
+	Facets   []entity.Facet    `json:"facets"`
+}
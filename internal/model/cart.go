@@ -1,17 +1,26 @@
 package model
 
-import "github.com/aldotp/OnlineStore/internal/entity"
+import (
+	"time"
 
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+// CartItemsRequest requires a VariantID for products sold by variant.
 type CartItemsRequest struct {
 	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
 	Quantity  int `json:"quantity"`
 }
 
+// ViewCartResponse reports with HasChanges that an item's price changed or its
+// product was deleted since it was added.
 type ViewCartResponse struct {
 	CartItems    []*entity.CartItem `json:"cart_items"`
 	Total        int                `json:"total"`
 	TotalProduct int                `json:"total_product"`
 	TotalPrice   float64            `json:"total_price"`
+	HasChanges   bool               `json:"has_changes"`
 }
 
 type RemoveCartItemRequest struct {
@@ -19,13 +28,73 @@ type RemoveCartItemRequest struct {
 }
 
 type CheckoutResponse struct {
-	CartItems    []*entity.CartItem `json:"cart_items"`
-	Total        int                `json:"total"`
-	TotalProduct int                `json:"total_product"`
-	TotalPrice   float64            `json:"total_price"`
+	OrderID         int                  `json:"order_id"`
+	CartItems       []*entity.CartItem   `json:"cart_items"`
+	Total           int                  `json:"total"`
+	TotalProduct    int                  `json:"total_product"`
+	TotalPrice      float64              `json:"total_price"`
+	ShippingMethod  string               `json:"shipping_method"`
+	ShippingCost    float64              `json:"shipping_cost"`
+	ShippingAddress *entity.OrderAddress `json:"shipping_address"`
 }
 
 type ModifyCartRequest struct {
 	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
 	Quantity  int `json:"quantity"`
 }
+
+// CartAbandonmentStats covers the carts abandoned between From and To. A cart is
+// recovered when its user placed an order after it was detected.
+type CartAbandonmentStats struct {
+	From            time.Time `json:"from"`
+	To              time.Time `json:"to"`
+	AbandonedCarts  int       `json:"abandoned_carts"`
+	AbandonedValue  float64   `json:"abandoned_value"`
+	RecoveredCarts  int       `json:"recovered_carts"`
+	Orders          int       `json:"orders"`
+	AbandonmentRate float64   `json:"abandonment_rate"`
+}
+
+// Cart batch operations.
+const (
+	CartOperationAdd    = "add"
+	CartOperationSet    = "set"
+	CartOperationRemove = "remove"
+
+	CartOperationOK      = "ok"
+	CartOperationFailed  = "failed"
+	CartOperationSkipped = "skipped"
+)
+
+// CartOperation adds to, sets (0 removes) or removes the quantity of a product.
+type CartOperation struct {
+	Op        string `json:"op"`
+	ProductID int    `json:"product_id"`
+	VariantID int    `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+type CartBatchRequest struct {
+	Operations []CartOperation `json:"operations"`
+}
+
+// CartOperationResult reports the outcome of one line, Quantity is the resulting
+// quantity of the product in the cart.
+type CartOperationResult struct {
+	Index     int    `json:"index"`
+	Op        string `json:"op"`
+	ProductID int    `json:"product_id"`
+	VariantID int    `json:"variant_id"`
+	Quantity  int    `json:"quantity"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CartBatchResponse reports with Applied whether the operations were saved. They
+// are saved only when every line succeeded.
+type CartBatchResponse struct {
+	Applied bool                  `json:"applied"`
+	Results []CartOperationResult `json:"results"`
+	Cart    *ViewCartResponse     `json:"cart,omitempty"`
+}
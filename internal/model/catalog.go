@@ -0,0 +1,40 @@
+package model
+
+// ImportRow is one product of an import file. Products are matched by SKU, the
+// category of an existing product cannot change.
+type ImportRow struct {
+	SKU         string  `json:"sku"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	CategoryID  int     `json:"category_id"`
+	Weight      float64 `json:"weight"`
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Stock       *int    `json:"stock"`
+	// Status defaults to published.
+	Status string `json:"status"`
+	// Attributes holds the attribute values by code, validated like the ones of
+	// a stored product. An update without attributes keeps the stored ones.
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// ImportRowError reports why a row was not imported. Row is the line of the
+// file, counting the CSV header.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport sums up an import. Nothing is written on a dry run, Created and
+// Updated then count the rows that would be.
+type ImportReport struct {
+	DryRun  bool             `json:"dry_run"`
+	Rows    int              `json:"rows"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Failed  int              `json:"failed"`
+	Errors  []ImportRowError `json:"errors"`
+}
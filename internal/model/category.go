@@ -2,8 +2,10 @@ package model
 
 import "github.com/aldotp/OnlineStore/internal/entity"
 
+// CategoryRequest creates a root category when ParentID is nil.
 type CategoryRequest struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	ParentID *int   `json:"parent_id"`
 }
 
 type ProductByCategoryResponse struct {
@@ -16,3 +18,9 @@ type UpdateCategoryRequest struct {
 	CategoryID int    `json:"category_id"`
 	Name       string `json:"name"`
 }
+
+// MoveCategoryRequest moves a category to the root when ParentID is nil.
+type MoveCategoryRequest struct {
+	CategoryID int  `json:"category_id"`
+	ParentID   *int `json:"parent_id"`
+}
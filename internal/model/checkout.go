@@ -1,19 +1,50 @@
 package model
 
+import "github.com/aldotp/OnlineStore/internal/entity"
+
+// CheckoutRequest selects the shipping address of the order, either from the
+// address book or inline. When both are empty the default shipping address is used.
+// ConfirmedPrices holds the prices the customer accepted for the items whose
+// price changed since they were added, checkout is refused when the price of
+// such an item is not the confirmed one.
+type CheckoutRequest struct {
+	AddressID        int              `json:"address_id"`
+	ShippingAddress  *AddressRequest  `json:"shipping_address"`
+	ShippingMethodID int              `json:"shipping_method_id"`
+	ConfirmedPrices  []ConfirmedPrice `json:"confirmed_prices"`
+}
+
+// ConfirmedPrice is the unit price of a cart line accepted by the customer.
+type ConfirmedPrice struct {
+	ProductID int     `json:"product_id"`
+	VariantID int     `json:"variant_id"`
+	Price     float64 `json:"price"`
+}
+
 type CheckoutHistoryResponse struct {
-	ID           int            `json:"id"`
-	UserID       int            `json:"user_id"`
-	Status       string         `json:"status"`
-	TotalPrice   float64        `json:"total_price"`
-	TotalProduct int            `json:"total_product"`
-	CreatedAt    string         `json:"created_at"`
-	UpdatedAt    string         `json:"updated_at"`
-	OrderDetails []*OrderDetail `json:"order_details"`
+	ID               int                  `json:"id"`
+	UserID           int                  `json:"user_id"`
+	Status           string               `json:"status"`
+	TotalPrice       float64              `json:"total_price"`
+	ShippingMethodID int                  `json:"shipping_method_id"`
+	ShippingCost     float64              `json:"shipping_cost"`
+	TotalProduct     int                  `json:"total_product"`
+	CreatedAt        string               `json:"created_at"`
+	UpdatedAt        string               `json:"updated_at"`
+	OrderDetails     []*OrderDetail       `json:"order_details"`
+	ShippingAddress  *entity.OrderAddress `json:"shipping_address"`
+}
+
+// CheckoutHistoryListResponse is a page of the orders of a customer.
+type CheckoutHistoryListResponse struct {
+	Orders     []CheckoutHistoryResponse `json:"orders"`
+	Pagination Pagination                `json:"pagination"`
 }
 
 type OrderDetail struct {
 	ID          int     `json:"id"`
 	ProductID   int     `json:"product_id"`
+	VariantID   int     `json:"variant_id,omitempty"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Quantity    int     `json:"quantity"`
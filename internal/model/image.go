@@ -0,0 +1,17 @@
+package model
+
+// ProductImage is an image of a product with the URLs of its thumbnails by size name.
+type ProductImage struct {
+	ID         int               `json:"id"`
+	URL        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	Position   int               `json:"position"`
+}
+
+// ReorderImagesRequest lists every image of the product in the new display order.
+type ReorderImagesRequest struct {
+	ProductID int   `json:"product_id"`
+	ImageIDs  []int `json:"image_ids"`
+}
@@ -0,0 +1,14 @@
+package model
+
+const (
+	NotificationAbandonedCart = "abandoned_cart"
+	NotificationPriceDrop     = "price_drop"
+	NotificationBackInStock   = "back_in_stock"
+)
+
+// Notification is an event sent to a user. UserID is 0 when the event concerns a guest.
+type Notification struct {
+	Type   string      `json:"type"`
+	UserID int         `json:"user_id"`
+	Data   interface{} `json:"data"`
+}
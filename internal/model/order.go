@@ -0,0 +1,91 @@
+package model
+
+import (
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+// Pagination describes the page of a list, Page starts at 1.
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+type OrderListResponse struct {
+	Orders []entity.OrderSummary `json:"orders"`
+	Pagination
+}
+
+type OrderCustomer struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// OrderResponse is an order with its lines. Customer and Notes are only
+// returned to admins.
+type OrderResponse struct {
+	ID               int                  `json:"id"`
+	UserID           int                  `json:"user_id"`
+	Status           string               `json:"status"`
+	TotalAmount      float64              `json:"total_amount"`
+	ShippingMethodID int                  `json:"shipping_method_id"`
+	ShippingCost     float64              `json:"shipping_cost"`
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
+	Customer         *OrderCustomer       `json:"customer,omitempty"`
+	ShippingAddress  *entity.OrderAddress `json:"shipping_address"`
+	Items            []*OrderDetail       `json:"items"`
+	Notes            []entity.OrderNote   `json:"notes,omitempty"`
+}
+
+type OrderNoteRequest struct {
+	OrderID int    `json:"order_id"`
+	Note    string `json:"note"`
+}
+
+// OrderStatusRequest moves the orders to Status, Note is added to the note
+// recording the change.
+type OrderStatusRequest struct {
+	OrderIDs []int  `json:"order_ids"`
+	Status   string `json:"status"`
+	Note     string `json:"note"`
+}
+
+// OrderStatusResult lists the orders moved and the ones that could not be.
+type OrderStatusResult struct {
+	Updated []int                `json:"updated"`
+	Failed  []OrderStatusFailure `json:"failed"`
+}
+
+type OrderStatusFailure struct {
+	OrderID int    `json:"order_id"`
+	Message string `json:"message"`
+}
+
+// OrderExport is an order of the accounting feed. Amounts are in Currency,
+// Subtotal sums the line totals before shipping.
+type OrderExport struct {
+	ID           int               `json:"id"`
+	UserID       int               `json:"user_id"`
+	Status       string            `json:"status"`
+	Currency     string            `json:"currency"`
+	Subtotal     float64           `json:"subtotal"`
+	ShippingCost float64           `json:"shipping_cost"`
+	TotalAmount  float64           `json:"total_amount"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Items        []OrderExportItem `json:"items"`
+}
+
+type OrderExportItem struct {
+	ProductID int     `json:"product_id"`
+	VariantID int     `json:"variant_id,omitempty"`
+	SKU       string  `json:"sku"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unit_price"`
+	LineTotal float64 `json:"line_total"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+// PriceScheduleRequest schedules Price from StartsAt, until EndsAt when set.
+type PriceScheduleRequest struct {
+	ProductID int        `json:"product_id"`
+	Price     float64    `json:"price"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+}
+
+// PriceTimeline is the price history of a product with its scheduled changes.
+type PriceTimeline struct {
+	ProductID int                     `json:"product_id"`
+	Price     float64                 `json:"price"`
+	WasPrice  *float64                `json:"was_price,omitempty"`
+	History   []entity.PriceChange    `json:"history"`
+	Schedules []*entity.PriceSchedule `json:"schedules"`
+}
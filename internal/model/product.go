@@ -1,14 +1,35 @@
 package model
 
+import (
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+// ProductRequest carries the weight in kilograms and the dimensions in centimeters.
+// Status defaults to published, or to draft when PublishAt is set.
 type ProductRequest struct {
+	SKU         string  `json:"sku"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	CategoryID  int     `json:"category_id"`
+	Weight      float64 `json:"weight"`
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Stock       *int    `json:"stock"`
+	// Attributes holds the values of the attributes of the category by code.
+	Attributes  map[string]any `json:"attributes"`
+	Status      string         `json:"status"`
+	PublishAt   *time.Time     `json:"publish_at"`
+	UnpublishAt *time.Time     `json:"unpublish_at"`
 }
 
+// DeleteProductRequest limits the removal of a product from the cart to one variant when VariantID is set.
 type DeleteProductRequest struct {
 	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
 }
 
 type UpdateProductRequest struct {
@@ -16,14 +37,53 @@ type UpdateProductRequest struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	Weight      float64 `json:"weight"`
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Stock       *int    `json:"stock"`
+	// Attributes replaces all attribute values when set.
+	Attributes map[string]any `json:"attributes"`
 }
 
 type ProductResponse struct {
 	ID          int     `json:"id"`
+	SKU         string  `json:"sku,omitempty"`
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
 	CategoryID  int     `json:"category_id"`
-	CreatedAt   string  `json:"created_at"`
-	UpdatedAt   string  `json:"updated_at"`
+	Weight      float64 `json:"weight"`
+	Length      float64 `json:"length"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Stock       *int    `json:"stock"`
+	// WasPrice is the regular price while a scheduled sale lowers Price until
+	// SaleEndsAt.
+	WasPrice   *float64   `json:"was_price,omitempty"`
+	SaleEndsAt *time.Time `json:"sale_ends_at,omitempty"`
+	// Status, PublishAt and UnpublishAt are the publishing state of the product.
+	Status      string     `json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
+	// AverageRating and ReviewCount cover the approved reviews.
+	AverageRating float64        `json:"average_rating"`
+	ReviewCount   int            `json:"review_count"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	// Images are in display order.
+	Images []ProductImage `json:"images"`
+	// Options and Variants are the variant matrix of a single product.
+	Options   []entity.ProductOption   `json:"options,omitempty"`
+	Variants  []*entity.ProductVariant `json:"variants,omitempty"`
+	CreatedAt string                   `json:"created_at"`
+	UpdatedAt string                   `json:"updated_at"`
+}
+
+// PublishingRequest replaces the status and the publishing schedule of a
+// product. UnpublishAt must be after PublishAt when both are set.
+type PublishingRequest struct {
+	ProductID   int        `json:"product_id"`
+	Status      string     `json:"status"`
+	PublishAt   *time.Time `json:"publish_at"`
+	UnpublishAt *time.Time `json:"unpublish_at"`
 }
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+// ReportRequest selects the days from From until To in Timezone. Interval
+// groups the sales by day, week or month, Sort ranks the top sellers by
+// revenue or units.
+type ReportRequest struct {
+	From     time.Time
+	To       time.Time
+	Timezone string
+	Interval string
+	Sort     string
+	Limit    int
+}
+
+// SalesTotals sums the orders of a period. Revenue sums the order totals and
+// AverageOrderValue divides it by the orders.
+type SalesTotals struct {
+	Orders             int     `json:"orders"`
+	Revenue            float64 `json:"revenue"`
+	AverageOrderValue  float64 `json:"average_order_value"`
+	Units              int     `json:"units"`
+	NewCustomers       int     `json:"new_customers"`
+	ReturningCustomers int     `json:"returning_customers"`
+}
+
+// SalesBucket is the day, week (from Monday) or month starting on Start.
+type SalesBucket struct {
+	Start string `json:"start"`
+	SalesTotals
+}
+
+type SalesReport struct {
+	Timezone string `json:"timezone"`
+	Interval string `json:"interval"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	SalesTotals
+	Buckets []SalesBucket `json:"buckets"`
+}
+
+type TopSellersReport struct {
+	Timezone string             `json:"timezone"`
+	From     string             `json:"from"`
+	To       string             `json:"to"`
+	Sort     string             `json:"sort"`
+	Items    []entity.TopSeller `json:"items"`
+}
@@ -0,0 +1,21 @@
+package model
+
+type ReturnItemRequest struct {
+	OrderDetailID int `json:"order_detail_id"`
+	Quantity      int `json:"quantity"`
+}
+
+type ReturnRequest struct {
+	OrderID int                 `json:"order_id"`
+	Reason  string              `json:"reason"`
+	Items   []ReturnItemRequest `json:"items"`
+}
+
+// ReturnDecisionRequest is used by admins to act on a return. Amount defaults to
+// the value of the returned items on approval and to the outstanding amount on refund.
+type ReturnDecisionRequest struct {
+	ReturnID int     `json:"return_id"`
+	Note     string  `json:"note"`
+	Amount   float64 `json:"amount"`
+	Restock  bool    `json:"restock"`
+}
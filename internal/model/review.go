@@ -0,0 +1,8 @@
+package model
+
+type ReviewRequest struct {
+	ProductID int    `json:"product_id"`
+	Rating    int    `json:"rating"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type ShipmentItemRequest struct {
+	OrderDetailID int `json:"order_detail_id"`
+	Quantity      int `json:"quantity"`
+}
+
+// ShipmentRequest creates a shipment for an order. When Items is empty every
+// quantity that has not been shipped yet is included.
+type ShipmentRequest struct {
+	OrderID        int                   `json:"order_id"`
+	CarrierCode    string                `json:"carrier_code"`
+	TrackingNumber string                `json:"tracking_number"`
+	Items          []ShipmentItemRequest `json:"items"`
+}
+
+// CarrierStatusUpdate is the normalized form of a carrier webhook event.
+type CarrierStatusUpdate struct {
+	TrackingNumber string    `json:"tracking_number"`
+	Status         string    `json:"status"`
+	Description    string    `json:"description"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
@@ -0,0 +1,21 @@
+package model
+
+type ShippingQuoteRequest struct {
+	AddressID       int             `json:"address_id"`
+	ShippingAddress *AddressRequest `json:"shipping_address"`
+}
+
+type ShippingQuote struct {
+	MethodID int     `json:"method_id"`
+	Code     string  `json:"code"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Price    float64 `json:"price"`
+	Total    float64 `json:"total"`
+}
+
+type ShippingQuoteResponse struct {
+	Subtotal    float64         `json:"subtotal"`
+	TotalWeight float64         `json:"total_weight"`
+	Methods     []ShippingQuote `json:"methods"`
+}
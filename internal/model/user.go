@@ -10,11 +10,13 @@ type RegisterRequest struct {
 type UserCtx struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
 }
 
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	CartToken string `json:"cart_token"`
 }
 
 type RegisterResponse struct {
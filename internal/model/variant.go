@@ -0,0 +1,22 @@
+package model
+
+type ProductOptionRequest struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+type ProductOptionsRequest struct {
+	ProductID int                    `json:"product_id"`
+	Options   []ProductOptionRequest `json:"options"`
+}
+
+// VariantRequest carries one value for each option of the product. A nil Price
+// uses the product price, a nil Stock leaves the stock untracked.
+type VariantRequest struct {
+	ProductID int               `json:"product_id"`
+	VariantID int               `json:"variant_id"`
+	SKU       string            `json:"sku"`
+	Price     *float64          `json:"price"`
+	Stock     *int              `json:"stock"`
+	Options   map[string]string `json:"options"`
+}
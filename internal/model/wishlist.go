@@ -0,0 +1,35 @@
+package model
+
+type WishlistRequest struct {
+	WishlistID int    `json:"wishlist_id"`
+	Name       string `json:"name"`
+	Public     bool   `json:"public"`
+}
+
+// WishlistItemRequest picks the variant of the wishlist item with VariantID, or
+// the variant to move to the cart of an item saved without one.
+type WishlistItemRequest struct {
+	WishlistID int `json:"wishlist_id"`
+	ProductID  int `json:"product_id"`
+	VariantID  int `json:"variant_id"`
+	Quantity   int `json:"quantity"`
+}
+
+// SaveForLaterRequest moves a cart item to a wishlist, the "Saved for later"
+// list of the user when WishlistID is 0. VariantID selects the cart line of
+// products sold by variant.
+type SaveForLaterRequest struct {
+	ProductID  int `json:"product_id"`
+	VariantID  int `json:"variant_id"`
+	WishlistID int `json:"wishlist_id"`
+}
+
+// WishlistProductEvent is the data of price drop and back in stock notifications.
+type WishlistProductEvent struct {
+	WishlistID    int     `json:"wishlist_id"`
+	ProductID     int     `json:"product_id"`
+	VariantID     int     `json:"variant_id,omitempty"`
+	ProductName   string  `json:"product_name"`
+	PreviousPrice float64 `json:"previous_price"`
+	Price         float64 `json:"price"`
+}
@@ -0,0 +1,200 @@
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pingTimeout bounds the health check of a replica.
+const pingTimeout = 2 * time.Second
+
+type primaryKey struct{}
+
+// WithPrimary makes the reads done with the returned context go to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Router spreads the read-only queries over the healthy read replicas in turn.
+// The other queries use the primary, as do the reads of the users pinned to it
+// after a write, so that they see their own changes before the replicas catch
+// up.
+//
+// The pins are kept in the memory of the process. With several API instances
+// the requests of a user must stick to one instance, otherwise a read served by
+// another instance may still go to a replica right after a write.
+type Router struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	healthy  []atomic.Bool
+	next     atomic.Uint32
+	maxLag   time.Duration
+
+	pinFor time.Duration
+	mu     sync.Mutex
+	pins   map[int]time.Time
+}
+
+// New routes the reads to replicas once CheckHealth found them healthy. Users
+// are pinned to the primary for pinFor after a write, 0 disables the pinning.
+// Replicas lagging more than maxLag behind the primary are unhealthy, 0
+// disables the lag check.
+func New(primary *sql.DB, replicas []*sql.DB, pinFor time.Duration, maxLag time.Duration) *Router {
+	return &Router{
+		primary:  primary,
+		replicas: replicas,
+		healthy:  make([]atomic.Bool, len(replicas)),
+		maxLag:   maxLag,
+		pinFor:   pinFor,
+		pins:     make(map[int]time.Time),
+	}
+}
+
+func (r *Router) Primary() *sql.DB {
+	return r.primary
+}
+
+// Reader returns the database of a read-only query made with ctx, the next
+// healthy replica. It is the primary when ctx requires it or when no replica
+// is healthy.
+func (r *Router) Reader(ctx context.Context) *sql.DB {
+
+	if len(r.replicas) == 0 || ctx.Value(primaryKey{}) != nil {
+		return r.primary
+	}
+
+	start := int(r.next.Add(1))
+	for i := range r.replicas {
+		n := (start + i) % len(r.replicas)
+		if r.healthy[n].Load() {
+			return r.replicas[n]
+		}
+	}
+
+	return r.primary
+}
+
+// Pin sends the reads of the user to the primary for the pin duration.
+func (r *Router) Pin(userID int) {
+
+	if len(r.replicas) == 0 || r.pinFor <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.pins[userID] = time.Now().Add(r.pinFor)
+	r.mu.Unlock()
+}
+
+// Pinned tells whether the reads of the user go to the primary.
+func (r *Router) Pinned(userID int) bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.pins[userID]
+	if ok && !time.Now().Before(until) {
+		delete(r.pins, userID)
+		return false
+	}
+
+	return ok
+}
+
+// CheckHealth pings the replicas and checks their replication lag, the ones not
+// answering or lagging too far behind get no reads until they are healthy again.
+// It also forgets the expired pins.
+func (r *Router) CheckHealth(ctx context.Context) error {
+
+	for i, db := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := db.PingContext(pingCtx)
+		if err == nil && r.maxLag > 0 {
+			var lag time.Duration
+			lag, err = replicationLag(pingCtx, db)
+			if err == nil && lag > r.maxLag {
+				err = fmt.Errorf("replication lag %s exceeds %s", lag, r.maxLag)
+			}
+		}
+		cancel()
+
+		healthy := err == nil
+		if r.healthy[i].Swap(healthy) != healthy {
+			if healthy {
+				log.Printf("replica-%d is healthy", i+1)
+			} else {
+				log.Printf("replica-%d is unhealthy: %v", i+1, err)
+			}
+		}
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	for userID, until := range r.pins {
+		if !now.Before(until) {
+			delete(r.pins, userID)
+		}
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// replicationLag returns Seconds_Behind_Source of SHOW REPLICA STATUS. It fails
+// when the database does not replicate or the replication is stopped.
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("replication is not configured")
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" {
+			continue
+		}
+
+		// NULL when the replication threads are not running
+		if !values[i].Valid {
+			return 0, fmt.Errorf("replication is stopped")
+		}
+
+		seconds, err := strconv.Atoi(values[i].String)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Seconds_Behind_Source %q", values[i].String)
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return 0, fmt.Errorf("Seconds_Behind_Source is missing from the replica status")
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type AbandonedCartRepository struct {
+	db *sql.DB
+}
+
+func NewAbandonedCartRepository(db *sql.DB) *AbandonedCartRepository {
+	return &AbandonedCartRepository{db: db}
+}
+
+// FindAbandonedCarts returns the carts whose items were last updated before the
+// given time, that were not recorded since that activity and whose user has not
+// placed an order after it.
+func (a *AbandonedCartRepository) FindAbandonedCarts(ctx context.Context, before time.Time) ([]*entity.AbandonedCart, error) {
+
+	query := `SELECT t.cart_id, t.user_id, t.item_count, t.value, t.last_activity_at FROM (
+			SELECT c.id AS cart_id, COALESCE(c.user_id, 0) AS user_id, COUNT(ci.id) AS item_count,
+				COALESCE(SUM(ci.quantity * COALESCE(v.price, p.price, ci.price)), 0) AS value, MAX(ci.updated_at) AS last_activity_at
+			FROM carts c
+			JOIN cart_items ci ON ci.cart_id = c.id
+			LEFT JOIN products p ON p.id = ci.product_id
+			LEFT JOIN product_variants v ON v.id = ci.variant_id
+			GROUP BY c.id, c.user_id
+		) t
+		WHERE t.last_activity_at < ?
+		AND NOT EXISTS (SELECT 1 FROM abandoned_carts a WHERE a.cart_id = t.cart_id AND a.last_activity_at = t.last_activity_at)
+		AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = t.user_id AND o.created_at > t.last_activity_at)`
+
+	rows, err := a.db.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var carts []*entity.AbandonedCart
+	for rows.Next() {
+		var cart entity.AbandonedCart
+		if err := rows.Scan(&cart.CartID, &cart.UserID, &cart.ItemCount, &cart.Value, &cart.LastActivityAt); err != nil {
+			return nil, err
+		}
+
+		carts = append(carts, &cart)
+	}
+
+	return carts, rows.Err()
+}
+
+func (a *AbandonedCartRepository) StoreAbandonedCart(ctx context.Context, cart *entity.AbandonedCart) error {
+
+	var userID interface{}
+	if cart.UserID != 0 {
+		userID = cart.UserID
+	}
+
+	cart.DetectedAt = time.Now().UTC()
+	result, err := a.db.ExecContext(
+		ctx,
+		"INSERT INTO abandoned_carts (cart_id, user_id, item_count, value, last_activity_at, detected_at) VALUES (?, ?, ?, ?, ?, ?)",
+		cart.CartID,
+		userID,
+		cart.ItemCount,
+		cart.Value,
+		cart.LastActivityAt,
+		cart.DetectedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	cart.ID = int(id)
+	return nil
+}
+
+// FindUnnotifiedCarts returns the recorded abandoned carts whose notification
+// was not sent yet, as long as the cart was not touched and the user placed no
+// order since.
+func (a *AbandonedCartRepository) FindUnnotifiedCarts(ctx context.Context) ([]*entity.AbandonedCart, error) {
+
+	query := `SELECT a.id, a.cart_id, COALESCE(a.user_id, 0), a.item_count, a.value, a.last_activity_at, a.detected_at FROM abandoned_carts a
+		WHERE a.notified_at IS NULL
+		AND a.last_activity_at = (SELECT MAX(ci.updated_at) FROM cart_items ci WHERE ci.cart_id = a.cart_id)
+		AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = a.user_id AND o.created_at > a.last_activity_at)
+		ORDER BY a.id`
+
+	rows, err := a.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var carts []*entity.AbandonedCart
+	for rows.Next() {
+		var cart entity.AbandonedCart
+		if err := rows.Scan(&cart.ID, &cart.CartID, &cart.UserID, &cart.ItemCount, &cart.Value, &cart.LastActivityAt, &cart.DetectedAt); err != nil {
+			return nil, err
+		}
+
+		carts = append(carts, &cart)
+	}
+
+	return carts, rows.Err()
+}
+
+// MarkNotified records that the notification of the abandoned cart was sent.
+func (a *AbandonedCartRepository) MarkNotified(ctx context.Context, id int) error {
+
+	_, err := a.db.ExecContext(ctx, "UPDATE abandoned_carts SET notified_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+// GetAbandonmentStats counts the carts detected as abandoned and the orders
+// placed between from and to.
+func (a *AbandonedCartRepository) GetAbandonmentStats(ctx context.Context, from, to time.Time) (abandoned int, value float64, recovered int, orders int, err error) {
+
+	row := a.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*), COALESCE(SUM(a.value), 0),
+			COALESCE(SUM(EXISTS (SELECT 1 FROM orders o WHERE o.user_id = a.user_id AND o.created_at > a.detected_at)), 0)
+		FROM abandoned_carts a WHERE a.detected_at >= ? AND a.detected_at < ?`,
+		from,
+		to,
+	)
+	if err = row.Scan(&abandoned, &value, &recovered); err != nil {
+		return
+	}
+
+	row = a.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE created_at >= ? AND created_at < ?", from, to)
+	err = row.Scan(&orders)
+	return
+}
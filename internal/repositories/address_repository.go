@@ -0,0 +1,223 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type AddressRepository struct {
+	db *sql.DB
+}
+
+func NewAddressRepository(db *sql.DB) *AddressRepository {
+	return &AddressRepository{db: db}
+}
+
+const addressColumns = "id, user_id, label, recipient_name, phone, line1, line2, city, state, postal_code, country, is_default_shipping, is_default_billing, created_at, updated_at"
+
+func scanAddress(row interface{ Scan(...any) error }, address *entity.Address) error {
+	return row.Scan(&address.ID, &address.UserID, &address.Label, &address.RecipientName, &address.Phone, &address.Line1, &address.Line2, &address.City, &address.State, &address.PostalCode, &address.Country, &address.IsDefaultShipping, &address.IsDefaultBilling, &address.CreatedAt, &address.UpdatedAt)
+}
+
+func (a *AddressRepository) GetAddressesByUserID(ctx context.Context, userID int) ([]entity.Address, error) {
+
+	rows, err := a.db.QueryContext(ctx, "SELECT "+addressColumns+" FROM addresses WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var addresses []entity.Address
+	for rows.Next() {
+		var address entity.Address
+		if err := scanAddress(rows, &address); err != nil {
+			return nil, err
+		}
+
+		addresses = append(addresses, address)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+func (a *AddressRepository) GetAddressByID(ctx context.Context, id int) (*entity.Address, error) {
+
+	row := a.db.QueryRowContext(ctx, "SELECT "+addressColumns+" FROM addresses WHERE id = ?", id)
+	var address entity.Address
+	err := scanAddress(row, &address)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+func (a *AddressRepository) GetDefaultShippingAddress(ctx context.Context, userID int) (*entity.Address, error) {
+
+	row := a.db.QueryRowContext(ctx, "SELECT "+addressColumns+" FROM addresses WHERE user_id = ? AND is_default_shipping = TRUE", userID)
+	var address entity.Address
+	err := scanAddress(row, &address)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &address, nil
+}
+
+// StoreAddress inserts the address and, when it is flagged as a default,
+// clears the flag on the user's other addresses in the same transaction.
+func (a *AddressRepository) StoreAddress(ctx context.Context, address *entity.Address) (*entity.Address, error) {
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := clearDefaultAddresses(ctx, tx, address); err != nil {
+		return nil, err
+	}
+
+	tNow := time.Now().UTC()
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO addresses (user_id, label, recipient_name, phone, line1, line2, city, state, postal_code, country, is_default_shipping, is_default_billing, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		address.UserID, address.Label, address.RecipientName, address.Phone, address.Line1, address.Line2, address.City, address.State, address.PostalCode, address.Country, address.IsDefaultShipping, address.IsDefaultBilling, tNow, tNow,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	address.ID = int(id)
+	address.CreatedAt = tNow
+	address.UpdatedAt = tNow
+
+	return address, tx.Commit()
+}
+
+// UpdateAddress saves the address. A default flag set on it is cleared on the
+// user's other addresses, and a default flag it loses goes to the most recently
+// added of the user's other addresses.
+func (a *AddressRepository) UpdateAddress(ctx context.Context, address *entity.Address) error {
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var shipping, billing bool
+	err = tx.QueryRowContext(ctx, "SELECT is_default_shipping, is_default_billing FROM addresses WHERE id = ? AND user_id = ? FOR UPDATE", address.ID, address.UserID).Scan(&shipping, &billing)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := clearDefaultAddresses(ctx, tx, address); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE addresses SET label = ?, recipient_name = ?, phone = ?, line1 = ?, line2 = ?, city = ?, state = ?, postal_code = ?, country = ?, is_default_shipping = ?, is_default_billing = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+		address.Label, address.RecipientName, address.Phone, address.Line1, address.Line2, address.City, address.State, address.PostalCode, address.Country, address.IsDefaultShipping, address.IsDefaultBilling, time.Now().UTC(), address.ID, address.UserID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := promoteDefaultAddresses(ctx, tx, address.UserID, address.ID, shipping && !address.IsDefaultShipping, billing && !address.IsDefaultBilling); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAddress deletes the address. When it was a default, the most recently
+// added of the user's other addresses becomes the default in its place.
+func (a *AddressRepository) DeleteAddress(ctx context.Context, userID, id int) error {
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var shipping, billing bool
+	err = tx.QueryRowContext(ctx, "SELECT is_default_shipping, is_default_billing FROM addresses WHERE id = ? AND user_id = ? FOR UPDATE", id, userID).Scan(&shipping, &billing)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM addresses WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		return err
+	}
+
+	if err := promoteDefaultAddresses(ctx, tx, userID, id, shipping, billing); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// promoteDefaultAddresses makes the most recently added of the user's addresses
+// other than id the default shipping and/or billing address.
+func promoteDefaultAddresses(ctx context.Context, tx *sql.Tx, userID, id int, shipping, billing bool) error {
+
+	if shipping {
+		_, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default_shipping = TRUE, updated_at = ? WHERE user_id = ? AND id <> ? ORDER BY id DESC LIMIT 1", time.Now().UTC(), userID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if billing {
+		_, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default_billing = TRUE, updated_at = ? WHERE user_id = ? AND id <> ? ORDER BY id DESC LIMIT 1", time.Now().UTC(), userID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func clearDefaultAddresses(ctx context.Context, tx *sql.Tx, address *entity.Address) error {
+
+	if address.IsDefaultShipping {
+		_, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default_shipping = FALSE WHERE user_id = ? AND id <> ?", address.UserID, address.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if address.IsDefaultBilling {
+		_, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default_billing = FALSE WHERE user_id = ? AND id <> ?", address.UserID, address.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
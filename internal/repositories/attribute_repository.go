@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type AttributeRepository struct {
+	db *sql.DB
+}
+
+func NewAttributeRepository(db *sql.DB) *AttributeRepository {
+	return &AttributeRepository{db: db}
+}
+
+const attributeColumns = "a.id, a.category_id, a.code, a.name, a.type, a.required, a.filterable, a.options, a.created_at, a.updated_at"
+
+func scanAttribute(row interface{ Scan(...any) error }, attribute *entity.Attribute) error {
+
+	var options string
+	if err := row.Scan(&attribute.ID, &attribute.CategoryID, &attribute.Code, &attribute.Name, &attribute.Type, &attribute.Required, &attribute.Filterable, &options, &attribute.CreatedAt, &attribute.UpdatedAt); err != nil {
+		return err
+	}
+
+	if options == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(options), &attribute.Options)
+}
+
+func (a *AttributeRepository) getAttributes(ctx context.Context, query string, args ...any) ([]entity.Attribute, error) {
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attributes []entity.Attribute
+	for rows.Next() {
+		var attribute entity.Attribute
+		if err := scanAttribute(rows, &attribute); err != nil {
+			return nil, err
+		}
+
+		attributes = append(attributes, attribute)
+	}
+
+	return attributes, rows.Err()
+}
+
+// GetAttributesByCategoryID returns the attributes of the category, including
+// the ones inherited from its ancestors.
+func (a *AttributeRepository) GetAttributesByCategoryID(ctx context.Context, categoryID int) ([]entity.Attribute, error) {
+	return a.getAttributes(ctx, "SELECT "+attributeColumns+" FROM category_attributes a JOIN category_paths p ON p.ancestor_id = a.category_id WHERE p.descendant_id = ? ORDER BY p.depth DESC, a.id", categoryID)
+}
+
+// GetAttributesByCodesInTree returns the attributes with the given codes that
+// apply to the products of the category and its subcategories: the ones of the
+// category, its ancestors and its descendants. A categoryID of 0 stands for all
+// categories. Sibling categories may define the same code, so a code can have
+// several attributes.
+func (a *AttributeRepository) GetAttributesByCodesInTree(ctx context.Context, categoryID int, codes ...string) ([]entity.Attribute, error) {
+
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(codes))
+	for i, code := range codes {
+		args[i] = code
+	}
+
+	query := "SELECT " + attributeColumns + " FROM category_attributes a WHERE a.code IN (" + placeholders(len(args)) + ")"
+	if categoryID != 0 {
+		query += " AND a.category_id IN (SELECT ancestor_id FROM category_paths WHERE descendant_id = ? UNION SELECT descendant_id FROM category_paths WHERE ancestor_id = ?)"
+		args = append(args, categoryID, categoryID)
+	}
+
+	return a.getAttributes(ctx, query+" ORDER BY a.id", args...)
+}
+
+func (a *AttributeRepository) GetAttributeByID(ctx context.Context, id int) (*entity.Attribute, error) {
+
+	var attribute entity.Attribute
+	err := scanAttribute(a.db.QueryRowContext(ctx, "SELECT "+attributeColumns+" FROM category_attributes a WHERE a.id = ?", id), &attribute)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &attribute, nil
+}
+
+// CodeUsedInTree reports whether an ancestor, a descendant or the category itself
+// already defines an attribute with the code.
+func (a *AttributeRepository) CodeUsedInTree(ctx context.Context, categoryID int, code string) (bool, error) {
+
+	var used bool
+	err := a.db.QueryRowContext(ctx,
+		"SELECT EXISTS (SELECT 1 FROM category_attributes WHERE code = ? AND category_id IN "+
+			"(SELECT ancestor_id FROM category_paths WHERE descendant_id = ? UNION SELECT descendant_id FROM category_paths WHERE ancestor_id = ?))",
+		code, categoryID, categoryID).Scan(&used)
+	return used, err
+}
+
+func (a *AttributeRepository) StoreAttribute(ctx context.Context, attribute *entity.Attribute) (*entity.Attribute, error) {
+
+	options, err := json.Marshal(attribute.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	tNow := time.Now().UTC()
+	result, err := a.db.ExecContext(ctx, "INSERT INTO category_attributes (category_id, code, name, type, required, filterable, options, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		attribute.CategoryID, attribute.Code, attribute.Name, attribute.Type, attribute.Required, attribute.Filterable, string(options), tNow, tNow)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return a.GetAttributeByID(ctx, int(id))
+}
+
+func (a *AttributeRepository) UpdateAttribute(ctx context.Context, attribute *entity.Attribute) error {
+
+	options, err := json.Marshal(attribute.Options)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.db.ExecContext(ctx, "UPDATE category_attributes SET name = ?, required = ?, filterable = ?, options = ?, updated_at = ? WHERE id = ?",
+		attribute.Name, attribute.Required, attribute.Filterable, string(options), time.Now().UTC(), attribute.ID)
+	return err
+}
+
+// CountValuesNotIn counts the products whose value of the attribute is not one of values.
+func (a *AttributeRepository) CountValuesNotIn(ctx context.Context, attributeID int, values []string) (int, error) {
+
+	query := "SELECT COUNT(*) FROM product_attributes WHERE attribute_id = ?"
+	args := []any{attributeID}
+	if len(values) > 0 {
+		query += " AND value NOT IN (" + placeholders(len(values)) + ")"
+		for _, value := range values {
+			args = append(args, value)
+		}
+	}
+
+	var count int
+	err := a.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+// DeleteAttribute removes the attribute and its values on products.
+func (a *AttributeRepository) DeleteAttribute(ctx context.Context, id int) error {
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM product_attributes WHERE attribute_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM category_attributes WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetProductAttributes returns the attribute values of the products by product id.
+func (a *AttributeRepository) GetProductAttributes(ctx context.Context, productIDs ...int) (map[int][]entity.ProductAttribute, error) {
+
+	values := make(map[int][]entity.ProductAttribute)
+	if len(productIDs) == 0 {
+		return values, nil
+	}
+
+	args := make([]any, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := a.db.QueryContext(ctx, "SELECT pa.product_id, pa.attribute_id, a.code, a.type, pa.value FROM product_attributes pa JOIN category_attributes a ON a.id = pa.attribute_id WHERE pa.product_id IN ("+placeholders(len(args))+") ORDER BY pa.product_id, a.id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value entity.ProductAttribute
+		if err := rows.Scan(&value.ProductID, &value.AttributeID, &value.Code, &value.Type, &value.Value); err != nil {
+			return nil, err
+		}
+
+		values[value.ProductID] = append(values[value.ProductID], value)
+	}
+
+	return values, rows.Err()
+}
+
+// ReplaceProductAttributes replaces all attribute values of the product.
+func (a *AttributeRepository) ReplaceProductAttributes(ctx context.Context, productID int, values []entity.ProductAttribute) error {
+
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceProductAttributes(ctx, tx, productID, values); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceProductAttributes(ctx context.Context, db execer, productID int, values []entity.ProductAttribute) error {
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM product_attributes WHERE product_id = ?", productID); err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		_, err := db.ExecContext(ctx, "INSERT INTO product_attributes (product_id, attribute_id, value) VALUES (?, ?, ?)", productID, value.AttributeID, value.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetFacets counts the products matching filter by value of every filterable
+// attribute they have. Attributes sharing a code in sibling categories get a
+// facet each.
+func (a *AttributeRepository) GetFacets(ctx context.Context, filter entity.ProductFilter) ([]entity.Facet, error) {
+
+	where, args := productFilterSQL(filter)
+	rows, err := a.db.QueryContext(ctx,
+		"SELECT a.id, a.code, a.name, pa.value, COUNT(DISTINCT pa.product_id) FROM product_attributes pa "+
+			"JOIN category_attributes a ON a.id = pa.attribute_id "+
+			"WHERE a.filterable AND pa.product_id IN (SELECT p.id FROM products p WHERE "+where+") "+
+			"GROUP BY a.id, a.code, a.name, pa.value ORDER BY a.code, a.id, pa.value",
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var facets []entity.Facet
+	for rows.Next() {
+		var attributeID int
+		var code, name string
+		var value entity.FacetValue
+		if err := rows.Scan(&attributeID, &code, &name, &value.Value, &value.Count); err != nil {
+			return nil, err
+		}
+
+		if len(facets) == 0 || facets[len(facets)-1].AttributeID != attributeID {
+			facets = append(facets, entity.Facet{AttributeID: attributeID, Code: code, Name: name})
+		}
+
+		facet := &facets[len(facets)-1]
+		facet.Values = append(facet.Values, value)
+	}
+
+	return facets, rows.Err()
+}
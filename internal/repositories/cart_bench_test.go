@@ -0,0 +1,209 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// benchLines are the cart and order sizes of the benchmarks.
+var benchLines = []int{1, 50, 500}
+
+// benchRoundTrip is the simulated network round trip of every query, so that
+// the latency of a load grows with its number of queries as it would against a
+// database server.
+const benchRoundTrip = 100 * time.Microsecond
+
+// benchConnector opens connections to an in-memory database answering the cart
+// and order queries with lines rows, counting the queries it runs.
+type benchConnector struct {
+	lines   int
+	queries atomic.Int64
+}
+
+func (c *benchConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &benchConn{connector: c}, nil
+}
+
+func (c *benchConnector) Driver() driver.Driver {
+	return benchDriver{}
+}
+
+type benchDriver struct{}
+
+func (benchDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("open the database with sql.OpenDB")
+}
+
+type benchConn struct {
+	connector *benchConnector
+}
+
+func (c *benchConn) Prepare(query string) (driver.Stmt, error) {
+	return &benchStmt{conn: c, query: query}, nil
+}
+
+func (c *benchConn) Close() error {
+	return nil
+}
+
+func (c *benchConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *benchConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return c.query(query, values)
+}
+
+// query returns the rows of a cart item, product or order detail query.
+func (c *benchConn) query(query string, args []driver.Value) (driver.Rows, error) {
+
+	c.connector.queries.Add(1)
+	time.Sleep(benchRoundTrip)
+
+	now := time.Now()
+	rows := &benchRows{}
+
+	switch {
+	case strings.Contains(query, "FROM cart_items"):
+		rows.columns = make([]string, 8)
+		for i := 1; i <= c.connector.lines; i++ {
+			rows.values = append(rows.values, []driver.Value{int64(i), int64(1), int64(i), int64(0), int64(1), 10.0, now, now})
+		}
+	case strings.Contains(query, "FROM order_details"):
+		rows.columns = make([]string, 8+17)
+		for i := 1; i <= c.connector.lines; i++ {
+			detail := []driver.Value{int64(i), args[0], int64(i), int64(0), int64(1), 10.0, now, now}
+			rows.values = append(rows.values, append(detail, benchProduct(int64(i), now)...))
+		}
+	case strings.Contains(query, "FROM products"):
+		rows.columns = make([]string, 17)
+		for _, id := range args {
+			rows.values = append(rows.values, benchProduct(id.(int64), now))
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+
+	return rows, nil
+}
+
+// benchProduct returns the productColumns of a product.
+func benchProduct(id int64, now time.Time) []driver.Value {
+	return []driver.Value{id, fmt.Sprintf("SKU-%d", id), "Product", "Description", 10.0, int64(1), 1.0, 1.0, 1.0, 1.0, int64(100), "published", nil, nil, now, now, nil}
+}
+
+type benchStmt struct {
+	conn  *benchConn
+	query string
+}
+
+func (s *benchStmt) Close() error {
+	return nil
+}
+
+func (s *benchStmt) NumInput() int {
+	return -1
+}
+
+func (s *benchStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec is not supported")
+}
+
+func (s *benchStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.query(s.query, args)
+}
+
+type benchRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *benchRows) Columns() []string {
+	return r.columns
+}
+
+func (r *benchRows) Close() error {
+	return nil
+}
+
+func (r *benchRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// benchLoad runs the load made by newLoad for each size of benchLines,
+// reporting the queries it runs per call next to its latency.
+func benchLoad(b *testing.B, newLoad func(db *sql.DB) func(ctx context.Context) (int, error)) {
+	for _, lines := range benchLines {
+		b.Run(fmt.Sprintf("lines=%d", lines), func(b *testing.B) {
+			connector := &benchConnector{lines: lines}
+			db := sql.OpenDB(connector)
+			defer db.Close()
+
+			load := newLoad(db)
+			ctx := context.Background()
+			b.ResetTimer()
+			connector.queries.Store(0)
+
+			for i := 0; i < b.N; i++ {
+				loaded, err := load(ctx)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if loaded != lines {
+					b.Fatalf("loaded %d lines, want %d", loaded, lines)
+				}
+			}
+
+			b.ReportMetric(float64(connector.queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func BenchmarkGetCartItemsByCartID(b *testing.B) {
+	benchLoad(b, func(db *sql.DB) func(ctx context.Context) (int, error) {
+		repo := NewCartItemsRepository(db)
+		return func(ctx context.Context) (int, error) {
+			cartItems, err := repo.GetCartItemsByCartID(ctx, 1)
+			return len(cartItems), err
+		}
+	})
+}
+
+func BenchmarkGetCartItemsByUserID(b *testing.B) {
+	benchLoad(b, func(db *sql.DB) func(ctx context.Context) (int, error) {
+		repo := NewCartRepository(db)
+		return func(ctx context.Context) (int, error) {
+			cartItems, err := repo.GetCartItemsByUserID(ctx, 1)
+			return len(cartItems), err
+		}
+	})
+}
+
+func BenchmarkGetOrderDetailsByOrderID(b *testing.B) {
+	benchLoad(b, func(db *sql.DB) func(ctx context.Context) (int, error) {
+		repo := NewOrderDetailRepository(db, nil)
+		return func(ctx context.Context) (int, error) {
+			details, err := repo.GetOrderDetailsByOrderID(ctx, 1)
+			return len(details), err
+		}
+	})
+}
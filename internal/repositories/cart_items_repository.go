@@ -9,74 +9,95 @@ import (
 )
 
 type CartItemsRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
 func NewCartItemsRepository(db *sql.DB) *CartItemsRepository {
-	return &CartItemsRepository{db: db}
+	return &CartItemsRepository{db: db, stmts: newStmtCache(db)}
 }
 
-func (c *CartItemsRepository) StoreCartItems(ctx context.Context, cartItem *entity.CartItem) (*entity.CartItem, error) {
+const cartItemColumns = "id, cart_id, product_id, COALESCE(variant_id, 0), quantity, price, created_at, updated_at"
 
-	_, err := c.db.ExecContext(
-		ctx,
-		"INSERT INTO cart_items (cart_id, product_id, quantity, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		cartItem.CartID,
-		cartItem.ProductID,
-		cartItem.Quantity,
-		time.Now().UTC(),
-		time.Now().UTC(),
-	)
+func scanCartItem(row interface{ Scan(...any) error }, cartItem *entity.CartItem) error {
+	return row.Scan(&cartItem.ID, &cartItem.CartID, &cartItem.ProductID, &cartItem.VariantID, &cartItem.Quantity, &cartItem.Price, &cartItem.CreatedAt, &cartItem.UpdatedAt)
+}
+
+// getCartItems runs a query selecting cartItemColumns as a cached statement and
+// loads the products and variants of the items with one query each, whatever
+// the number of items.
+func getCartItems(ctx context.Context, stmts *stmtCache, query string, args ...any) ([]*entity.CartItem, error) {
+
+	rows, err := stmts.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	var insertedCartItem entity.CartItem
-	row := c.db.QueryRowContext(ctx, "SELECT id, cart_id, product_id, quantity, created_at, updated_at FROM cart_items WHERE cart_id = ? AND product_id = ?", cartItem.CartID, cartItem.ProductID)
-	if err := row.Scan(&insertedCartItem.ID, &insertedCartItem.CartID, &insertedCartItem.ProductID, &insertedCartItem.Quantity, &insertedCartItem.CreatedAt, &insertedCartItem.UpdatedAt); err != nil {
+	var cartItems []*entity.CartItem
+	for rows.Next() {
+		var cartItem entity.CartItem
+		if err := scanCartItem(rows, &cartItem); err != nil {
+			return nil, err
+		}
+
+		cartItems = append(cartItems, &cartItem)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	row = c.db.QueryRowContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products WHERE id = ?", insertedCartItem.ProductID)
-	var product entity.Product
-	if err := row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.CreatedAt, &product.UpdatedAt); err != nil {
+	if err := attachProducts(ctx, stmts.db, cartItems); err != nil {
 		return nil, err
 	}
 
-	insertedCartItem.Product = product
+	if err := attachVariants(ctx, stmts.db, cartItems); err != nil {
+		return nil, err
+	}
 
-	return &insertedCartItem, err
+	return cartItems, nil
 }
 
-func (c *CartItemsRepository) GetCartItemsByCartID(ctx context.Context, cartID int) ([]*entity.CartItem, error) {
+func (c *CartItemsRepository) StoreCartItems(ctx context.Context, cartItem *entity.CartItem) (*entity.CartItem, error) {
 
-	rows, err := c.db.QueryContext(ctx, "SELECT id, cart_id, product_id, quantity, created_at, updated_at FROM cart_items WHERE cart_id = ?", cartID)
+	_, err := c.db.ExecContext(
+		ctx,
+		"INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, price, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		cartItem.CartID,
+		cartItem.ProductID,
+		nullInt(cartItem.VariantID),
+		cartItem.Quantity,
+		cartItem.Price,
+		time.Now().UTC(),
+		time.Now().UTC(),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	cartItems, err := getCartItems(ctx, c.stmts, "SELECT "+cartItemColumns+" FROM cart_items WHERE cart_id = ? AND product_id = ? AND COALESCE(variant_id, 0) = ?", cartItem.CartID, cartItem.ProductID, cartItem.VariantID)
+	if err != nil {
+		return nil, err
+	}
 
-	var cartItems []*entity.CartItem
+	if len(cartItems) == 0 {
+		return nil, sql.ErrNoRows
+	}
 
-	for rows.Next() {
-		var cartItem entity.CartItem
-		err := rows.Scan(&cartItem.ID, &cartItem.CartID, &cartItem.ProductID, &cartItem.Quantity, &cartItem.CreatedAt, &cartItem.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
+	return cartItems[0], nil
+}
 
-		row := c.db.QueryRowContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products WHERE id = ?", cartItem.ProductID)
-		var product entity.Product
+func (c *CartItemsRepository) GetCartItemsByCartID(ctx context.Context, cartID int) ([]*entity.CartItem, error) {
+	return getCartItems(ctx, c.stmts, "SELECT "+cartItemColumns+" FROM cart_items WHERE cart_id = ?", cartID)
+}
 
-		err = row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.CreatedAt, &product.UpdatedAt)
-		if err != nil {
-			return nil,  err
-		}
+// DeleteCartItemsUpdatedBefore removes the cart items untouched since the given time.
+func (c *CartItemsRepository) DeleteCartItemsUpdatedBefore(ctx context.Context, before time.Time) (int64, error) {
 
-		cartItem.Product = product
-		cartItems = append(cartItems, &cartItem)
+	result, err := c.db.ExecContext(ctx, "DELETE FROM cart_items WHERE updated_at < ?", before)
+	if err != nil {
+		return 0, err
 	}
 
-	return cartItems, nil
+	return result.RowsAffected()
 }
@@ -9,12 +9,14 @@ import (
 )
 
 type CartRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
 }
 
 func NewCartRepository(db *sql.DB) *CartRepository {
 	return &CartRepository{
-		db: db,
+		db:    db,
+		stmts: newStmtCache(db),
 	}
 }
 
@@ -33,64 +35,137 @@ func (c *CartRepository) Store(ctx context.Context, cart *entity.Cart) error {
 	return err
 }
 
-func (c *CartRepository) GetCartByUserID(ctx context.Context, userID int) (*entity.Cart, error) {
+func (c *CartRepository) CreateGuestCart(ctx context.Context, token string) (*entity.Cart, error) {
 
-	row := c.db.QueryRowContext(ctx, "SELECT id, user_id, created_at, updated_at FROM carts WHERE user_id = ?", userID)
-	var cart entity.Cart
-	if err := row.Scan(&cart.ID, &cart.UserID, &cart.CreatedAt, &cart.UpdatedAt); err != nil {
+	tNow := time.Now().UTC()
+	result, err := c.db.ExecContext(ctx, "INSERT INTO carts (token, created_at, updated_at) VALUES (?, ?, ?)", token, tNow, tNow)
+	if err != nil {
 		return nil, err
 	}
 
-	return &cart, nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.Cart{
+		ID:        int(id),
+		Token:     token,
+		CreatedAt: tNow,
+		UpdatedAt: tNow,
+	}, nil
 }
 
-func (c *CartRepository) DeleteProductFromCart(ctx context.Context, cartID int, productID int) error {
+func (c *CartRepository) GetCartByToken(ctx context.Context, token string) (*entity.Cart, error) {
 
-	_, err := c.db.ExecContext(ctx, "DELETE FROM cart_items WHERE cart_id = ? AND product_id = ?", cartID, productID)
+	row := c.db.QueryRowContext(ctx, "SELECT id, COALESCE(user_id, 0), token, created_at, updated_at FROM carts WHERE token = ? AND user_id IS NULL", token)
+	var cart entity.Cart
+	err := row.Scan(&cart.ID, &cart.UserID, &cart.Token, &cart.CreatedAt, &cart.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return err
+	return &cart, nil
 }
 
-func (r *CartRepository) GetCartItemsByUserID(ctx context.Context, userID int) ([]*entity.CartItem, error) {
+// MergeCarts moves the items of the guest cart into the user cart and deletes the
+// guest cart. resolve decides the quantity when both carts contain the product.
+func (c *CartRepository) MergeCarts(ctx context.Context, guestCartID, userCartID int, resolve func(userQuantity, guestQuantity int) int) error {
 
-	query := `
-		SELECT id, product_id, quantity, created_at, updated_at FROM cart_items
-		WHERE cart_id IN (SELECT id FROM carts WHERE user_id = ?)
-	`
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := tx.QueryContext(ctx, "SELECT g.product_id, COALESCE(g.variant_id, 0), g.quantity, g.price, u.id, COALESCE(u.quantity, 0) FROM cart_items g LEFT JOIN cart_items u ON u.cart_id = ? AND u.product_id = g.product_id AND u.variant_id <=> g.variant_id WHERE g.cart_id = ?", userCartID, guestCartID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	type mergeLine struct {
+		productID     int
+		variantID     int
+		guestQuantity int
+		guestPrice    float64
+		userItemID    sql.NullInt64
+		userQuantity  int
 	}
-	defer rows.Close()
 
-	var cartItems []*entity.CartItem
+	var lines []mergeLine
 	for rows.Next() {
-		var cartItem entity.CartItem
-		if err := rows.Scan(&cartItem.ID, &cartItem.ProductID, &cartItem.Quantity, &cartItem.CreatedAt, &cartItem.UpdatedAt); err != nil {
-			return nil, err
+		var line mergeLine
+		if err := rows.Scan(&line.productID, &line.variantID, &line.guestQuantity, &line.guestPrice, &line.userItemID, &line.userQuantity); err != nil {
+			rows.Close()
+			return err
 		}
 
-		row := r.db.QueryRowContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products WHERE id = ?", cartItem.ProductID)
-
-		var product entity.Product
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-		if err := row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.CreatedAt, &product.UpdatedAt); err != nil {
-			return nil, err
+	tNow := time.Now().UTC()
+	for _, line := range lines {
+		if !line.userItemID.Valid {
+			_, err = tx.ExecContext(ctx, "INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, price, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)", userCartID, line.productID, nullInt(line.variantID), line.guestQuantity, line.guestPrice, tNow, tNow)
+		} else {
+			_, err = tx.ExecContext(ctx, "UPDATE cart_items SET quantity = ?, updated_at = ? WHERE id = ?", resolve(line.userQuantity, line.guestQuantity), tNow, line.userItemID.Int64)
+		}
+		if err != nil {
+			return err
 		}
+	}
 
-		cartItem.Product = product
+	_, err = tx.ExecContext(ctx, "DELETE FROM cart_items WHERE cart_id = ?", guestCartID)
+	if err != nil {
+		return err
+	}
 
-		cartItems = append(cartItems, &cartItem)
+	_, err = tx.ExecContext(ctx, "DELETE FROM carts WHERE id = ?", guestCartID)
+	if err != nil {
+		return err
 	}
-	if err := rows.Err(); err != nil {
+
+	return tx.Commit()
+}
+
+func (c *CartRepository) GetCartByUserID(ctx context.Context, userID int) (*entity.Cart, error) {
+
+	row := c.stmts.QueryRowContext(ctx, "SELECT id, user_id, created_at, updated_at FROM carts WHERE user_id = ?", userID)
+	var cart entity.Cart
+	if err := row.Scan(&cart.ID, &cart.UserID, &cart.CreatedAt, &cart.UpdatedAt); err != nil {
 		return nil, err
 	}
 
-	return cartItems, nil
+	return &cart, nil
+}
+
+// DeleteProductFromCart removes the product from the cart, only the given variant when variantID is not 0.
+func (c *CartRepository) DeleteProductFromCart(ctx context.Context, cartID int, productID int, variantID int) error {
+
+	query := "DELETE FROM cart_items WHERE cart_id = ? AND product_id = ?"
+	args := []any{cartID, productID}
+	if variantID != 0 {
+		query += " AND variant_id = ?"
+		args = append(args, variantID)
+	}
+
+	_, err := c.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (r *CartRepository) GetCartItemsByUserID(ctx context.Context, userID int) ([]*entity.CartItem, error) {
+	return getCartItems(ctx, r.stmts, "SELECT "+cartItemColumns+" FROM cart_items WHERE cart_id IN (SELECT id FROM carts WHERE user_id = ?)", userID)
 }
 
 func (r *CartRepository) ClearCart(ctx context.Context, userID int) error {
@@ -124,9 +199,25 @@ func (r *CartRepository) GetCartItemByUserIDAndProductID(ctx context.Context, us
 	return &cartItem, nil
 }
 
+func (r *CartRepository) GetCartItemByCartIDAndProductID(ctx context.Context, cartID, productID, variantID int) (*entity.CartItem, error) {
+
+	query := "SELECT id, cart_id, product_id, COALESCE(variant_id, 0), quantity, created_at, updated_at FROM cart_items WHERE cart_id = ? AND product_id = ? AND COALESCE(variant_id, 0) = ?"
+	row := r.stmts.QueryRowContext(ctx, query, cartID, productID, variantID)
+
+	var cartItem entity.CartItem
+	if err := row.Scan(&cartItem.ID, &cartItem.CartID, &cartItem.ProductID, &cartItem.VariantID, &cartItem.Quantity, &cartItem.CreatedAt, &cartItem.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &cartItem, nil
+}
+
 func (r *CartRepository) UpdateCartItem(ctx context.Context, item *entity.CartItem) error {
-	query := "UPDATE cart_items SET quantity = ? WHERE id = ?"
-	_, err := r.db.ExecContext(ctx, query, item.Quantity, item.ID)
+	query := "UPDATE cart_items SET quantity = ?, price = ?, updated_at = ? WHERE id = ?"
+	_, err := r.stmts.ExecContext(ctx, query, item.Quantity, item.Price, time.Now().UTC(), item.ID)
 	if err != nil {
 		return err
 	}
@@ -143,10 +234,10 @@ func (r *CartRepository) EmptyCart(ctx context.Context, cartID int) error {
 	return nil
 }
 
-func (r *CartRepository) ModifyCart(ctx context.Context, cartID int, productID int, quantity int) error {
+func (r *CartRepository) ModifyCart(ctx context.Context, cartID int, productID int, variantID int, quantity int) error {
 
 	if quantity == 0 {
-		_, err := r.db.ExecContext(ctx, "DELETE FROM cart_items WHERE cart_id = ? AND product_id = ?", cartID, productID)
+		_, err := r.db.ExecContext(ctx, "DELETE FROM cart_items WHERE cart_id = ? AND product_id = ? AND COALESCE(variant_id, 0) = ?", cartID, productID, variantID)
 		if err != nil {
 			return err
 		}
@@ -154,10 +245,71 @@ func (r *CartRepository) ModifyCart(ctx context.Context, cartID int, productID i
 		return nil
 	}
 
-	_, err := r.db.ExecContext(ctx, "UPDATE cart_items SET quantity = ? WHERE cart_id = ? AND product_id = ?", quantity, cartID, productID)
+	_, err := r.db.ExecContext(ctx, "UPDATE cart_items SET quantity = ?, updated_at = ? WHERE cart_id = ? AND product_id = ? AND COALESCE(variant_id, 0) = ?", quantity, time.Now().UTC(), cartID, productID, variantID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// DeleteEmptyGuestCarts removes the guest carts without items that were not updated since the given time.
+func (c *CartRepository) DeleteEmptyGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+
+	result, err := c.db.ExecContext(
+		ctx,
+		"DELETE FROM carts WHERE user_id IS NULL AND updated_at < ? AND NOT EXISTS (SELECT 1 FROM cart_items WHERE cart_items.cart_id = carts.id)",
+		before,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *CartRepository) BeginTransaction(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
+// GetCartItemsForUpdateWithTransaction returns the items of the cart by line
+// and locks them until the transaction ends.
+func (r *CartRepository) GetCartItemsForUpdateWithTransaction(ctx context.Context, tx *sql.Tx, cartID int) (map[entity.CartLine]*entity.CartItem, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT "+cartItemColumns+" FROM cart_items WHERE cart_id = ? FOR UPDATE", cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[entity.CartLine]*entity.CartItem)
+	for rows.Next() {
+		var item entity.CartItem
+		if err := scanCartItem(rows, &item); err != nil {
+			return nil, err
+		}
+
+		items[item.Line()] = &item
+	}
+
+	return items, rows.Err()
+}
+
+func (r *CartRepository) StoreCartItemWithTransaction(ctx context.Context, tx *sql.Tx, item *entity.CartItem) error {
+
+	tNow := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, "INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, price, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)", item.CartID, item.ProductID, nullInt(item.VariantID), item.Quantity, item.Price, tNow, tNow)
+	return err
+}
+
+func (r *CartRepository) UpdateCartItemWithTransaction(ctx context.Context, tx *sql.Tx, item *entity.CartItem) error {
+
+	_, err := tx.ExecContext(ctx, "UPDATE cart_items SET quantity = ?, price = ?, updated_at = ? WHERE id = ?", item.Quantity, item.Price, time.Now().UTC(), item.ID)
+	return err
+}
+
+func (r *CartRepository) DeleteCartItemWithTransaction(ctx context.Context, tx *sql.Tx, id int) error {
+
+	_, err := tx.ExecContext(ctx, "DELETE FROM cart_items WHERE id = ?", id)
+	return err
+}
@@ -3,24 +3,51 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/replica"
 )
 
+// CategoryRepository keeps the category tree in the category_paths closure
+// table, which holds a row for every ancestor of a category (including the
+// category itself at depth 0).
 type CategoryRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	reads *readStmts
 }
 
-func NewCategoryRepository(db *sql.DB) *CategoryRepository {
-	return &CategoryRepository{db: db}
+// NewCategoryRepository runs the category listings on the read replicas of
+// replicas, nil keeps them on db.
+func NewCategoryRepository(db *sql.DB, replicas *replica.Router) *CategoryRepository {
+	return &CategoryRepository{db: db, reads: newReadStmts(newStmtCache(db), replicas)}
 }
 
+const categoryColumns = "c.id, c.name, c.parent_id, c.created_at, c.updated_at, c.deleted_at"
+
+// categoryMoveLock is the named lock serializing the category moves, with the
+// seconds a move waits for it.
+const (
+	categoryMoveLock        = "category_move"
+	categoryMoveLockTimeout = 10
+)
+
+func scanCategory(row interface{ Scan(...any) error }, category *entity.Category) error {
+	return row.Scan(&category.ID, &category.Name, &category.ParentID, &category.CreatedAt, &category.UpdatedAt, &category.DeletedAt)
+}
+
+// GetCategoryByName also returns deleted categories, whose names stay taken
+// until they are purged.
 func (c *CategoryRepository) GetCategoryByName(ctx context.Context, name string) (*entity.Category, error) {
 
-	row := c.db.QueryRowContext(ctx, "SELECT id, name, created_at, updated_at FROM categories WHERE name = ?", name)
+	row := c.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.name = ?", name)
 	var category entity.Category
-	if err := row.Scan(&category.ID, &category.Name, &category.CreatedAt, &category.UpdatedAt); err != nil {
+	err := scanCategory(row, &category)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -28,11 +55,12 @@ func (c *CategoryRepository) GetCategoryByName(ctx context.Context, name string)
 
 }
 
+// GetCategoryByID returns the category unless it was deleted.
 func (c *CategoryRepository) GetCategoryByID(ctx context.Context, id int) (*entity.Category, error) {
 
-	row := c.db.QueryRowContext(ctx, "SELECT id, name, created_at, updated_at FROM categories WHERE id = ?", id)
+	row := c.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.id = ? AND c.deleted_at IS NULL", id)
 	var category entity.Category
-	err := row.Scan(&category.ID, &category.Name, &category.CreatedAt, &category.UpdatedAt)
+	err := scanCategory(row, &category)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -44,28 +72,47 @@ func (c *CategoryRepository) GetCategoryByID(ctx context.Context, id int) (*enti
 
 }
 
+// StoreCategory inserts the category below its parent, or as a root category.
 func (c *CategoryRepository) StoreCategory(ctx context.Context, category *entity.Category) (*entity.Category, error) {
 
-	_, err := c.db.ExecContext(ctx, "INSERT INTO categories (name, created_at, updated_at) VALUES (?, ?, ?)", category.Name, time.Now().UTC(), time.Now().UTC())
+	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	row := c.db.QueryRowContext(ctx, "SELECT id, name, created_at, updated_at FROM categories WHERE name = ?", category.Name)
+	result, err := tx.ExecContext(ctx, "INSERT INTO categories (name, parent_id, created_at, updated_at) VALUES (?, ?, ?, ?)", category.Name, category.ParentID, time.Now().UTC(), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
 
-	var insertedCategory entity.Category
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
 
-	if err := row.Scan(&insertedCategory.ID, &insertedCategory.Name, &insertedCategory.CreatedAt, &insertedCategory.UpdatedAt); err != nil {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO category_paths (ancestor_id, descendant_id, depth) VALUES (?, ?, 0)", id, id); err != nil {
 		return nil, err
 	}
 
-	return &insertedCategory, nil
+	if category.ParentID != nil {
+		_, err := tx.ExecContext(ctx, "INSERT INTO category_paths (ancestor_id, descendant_id, depth) SELECT ancestor_id, ?, depth + 1 FROM category_paths WHERE descendant_id = ?", id, *category.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return c.GetCategoryByID(ctx, int(id))
 
 }
 
 func (c *CategoryRepository) GetAllCategory(ctx context.Context) ([]entity.Category, error) {
 
-	rows, err := c.db.QueryContext(ctx, "SELECT id, name, created_at, updated_at FROM categories")
+	rows, err := c.reads.reader(ctx).QueryContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.deleted_at IS NULL ORDER BY c.id")
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +123,7 @@ func (c *CategoryRepository) GetAllCategory(ctx context.Context) ([]entity.Categ
 
 	for rows.Next() {
 		var category entity.Category
-		err := rows.Scan(&category.ID, &category.Name, &category.CreatedAt, &category.UpdatedAt)
+		err := scanCategory(rows, &category)
 		if err != nil {
 			return nil, err
 		}
@@ -88,6 +135,45 @@ func (c *CategoryRepository) GetAllCategory(ctx context.Context) ([]entity.Categ
 
 }
 
+// GetAncestors returns the ancestors of the category from the root down to the
+// category itself.
+func (c *CategoryRepository) GetAncestors(ctx context.Context, id int) ([]entity.Category, error) {
+
+	rows, err := c.reads.reader(ctx).QueryContext(ctx, "SELECT "+categoryColumns+" FROM category_paths p JOIN categories c ON c.id = p.ancestor_id JOIN categories d ON d.id = p.descendant_id WHERE p.descendant_id = ? AND d.deleted_at IS NULL ORDER BY p.depth DESC", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []entity.Category
+	for rows.Next() {
+		var category entity.Category
+		if err := scanCategory(rows, &category); err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// HasChildren reports whether categories that are not deleted are below the category.
+func (c *CategoryRepository) HasChildren(ctx context.Context, id int) (bool, error) {
+
+	var exists bool
+	err := c.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = ? AND deleted_at IS NULL)", id).Scan(&exists)
+	return exists, err
+}
+
+// HasProducts reports whether products that are not deleted are in the category.
+func (c *CategoryRepository) HasProducts(ctx context.Context, id int) (bool, error) {
+
+	var exists bool
+	err := c.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM products WHERE category_id = ? AND deleted_at IS NULL)", id).Scan(&exists)
+	return exists, err
+}
+
 func (c *CategoryRepository) UpdateCategory(ctx context.Context, category *entity.Category) error {
 
 	_, err := c.db.ExecContext(ctx, "UPDATE categories SET name = ?, updated_at = ? WHERE id = ?", category.Name, time.Now().UTC(), category.ID)
@@ -98,12 +184,238 @@ func (c *CategoryRepository) UpdateCategory(ctx context.Context, category *entit
 	return nil
 }
 
+// MoveCategory moves the category with its subtree below parentID, or to the
+// root when parentID is nil. It returns the reason of a refused move, empty
+// when the category was moved. A move is refused when the new parent is the
+// category itself or one of its descendants, when an attribute of the subtree
+// has the code of an attribute of its new ancestors, or when a product of the
+// subtree lacks a required attribute of its new ancestors.
+//
+// Moves run one at a time under the categoryMoveLock named lock: two moves of
+// different categories, each below the subtree of the other, would both pass
+// the cycle check otherwise.
+func (c *CategoryRepository) MoveCategory(ctx context.Context, id int, parentID *int) (string, error) {
+
+	// the named lock belongs to the connection, the transaction must use it
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", categoryMoveLock, categoryMoveLockTimeout).Scan(&acquired); err != nil {
+		return "", err
+	}
+	if acquired.Int64 != 1 {
+		return "", fmt.Errorf("cannot get the %s lock", categoryMoveLock)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "DO RELEASE_LOCK(?)", categoryMoveLock)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// keeps the category from being deleted meanwhile
+	var locked int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM categories WHERE id = ? FOR UPDATE", id).Scan(&locked); err != nil {
+		return "", err
+	}
+
+	if parentID != nil {
+		var cycle bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM category_paths WHERE ancestor_id = ? AND descendant_id = ?)", id, *parentID).Scan(&cycle)
+		if err != nil {
+			return "", err
+		}
+
+		if cycle {
+			return "a category cannot be moved below itself or one of its subcategories", nil
+		}
+	}
+
+	// detach the subtree from its current ancestors
+	_, err = tx.ExecContext(ctx,
+		"DELETE p FROM category_paths p "+
+			"JOIN category_paths d ON d.descendant_id = p.descendant_id AND d.ancestor_id = ? "+
+			"LEFT JOIN category_paths s ON s.ancestor_id = ? AND s.descendant_id = p.ancestor_id "+
+			"WHERE s.ancestor_id IS NULL",
+		id, id)
+	if err != nil {
+		return "", err
+	}
+
+	if parentID != nil {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO category_paths (ancestor_id, descendant_id, depth) "+
+				"SELECT a.ancestor_id, d.descendant_id, a.depth + d.depth + 1 FROM category_paths a "+
+				"JOIN category_paths d ON d.ancestor_id = ? WHERE a.descendant_id = ?",
+			id, *parentID)
+		if err != nil {
+			return "", err
+		}
+
+		// the attributes of the new ancestors now apply to the subtree
+		var code string
+		err = tx.QueryRowContext(ctx,
+			"SELECT s.code FROM category_attributes s "+
+				"JOIN category_paths d ON d.descendant_id = s.category_id AND d.ancestor_id = ? "+
+				"JOIN category_attributes a ON a.code = s.code "+
+				"JOIN category_paths u ON u.ancestor_id = a.category_id AND u.descendant_id = ? AND u.depth > 0 "+
+				"LIMIT 1",
+			id, id).Scan(&code)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+
+		if err == nil {
+			return fmt.Sprintf("attribute %s is defined both in the category tree and below the new parent", code), nil
+		}
+
+		err = tx.QueryRowContext(ctx,
+			"SELECT a.code FROM products p "+
+				"JOIN category_paths d ON d.descendant_id = p.category_id AND d.ancestor_id = ? "+
+				"JOIN category_paths u ON u.descendant_id = ? AND u.depth > 0 "+
+				"JOIN category_attributes a ON a.category_id = u.ancestor_id AND a.required "+
+				"WHERE p.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM product_attributes pa WHERE pa.product_id = p.id AND pa.attribute_id = a.id) "+
+				"LIMIT 1",
+			id, id).Scan(&code)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+
+		if err == nil {
+			return fmt.Sprintf("products of the category tree lack the required attribute %s of the new parent", code), nil
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE categories SET parent_id = ?, updated_at = ? WHERE id = ?", parentID, time.Now().UTC(), id); err != nil {
+		return "", err
+	}
+
+	return "", tx.Commit()
+}
+
+// DeleteCategoryByID soft deletes the category, which keeps its place in the tree.
 func (c *CategoryRepository) DeleteCategoryByID(ctx context.Context, id int) error {
 
-	_, err := c.db.ExecContext(ctx, "DELETE FROM categories WHERE id = ?", id)
+	_, err := c.db.ExecContext(ctx, "UPDATE categories SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), time.Now().UTC(), id)
+	return err
+}
+
+// GetDeletedCategories returns the soft deleted categories, most recently deleted first.
+func (c *CategoryRepository) GetDeletedCategories(ctx context.Context) ([]entity.Category, error) {
+
+	rows, err := c.db.QueryContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.deleted_at IS NOT NULL ORDER BY c.deleted_at DESC, c.id")
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	var categories []entity.Category
+	for rows.Next() {
+		var category entity.Category
+		if err := scanCategory(rows, &category); err != nil {
+			return nil, err
+		}
+
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// GetDeletedCategoryByID returns the category when it is soft deleted.
+func (c *CategoryRepository) GetDeletedCategoryByID(ctx context.Context, id int) (*entity.Category, error) {
+
+	row := c.db.QueryRowContext(ctx, "SELECT "+categoryColumns+" FROM categories c WHERE c.id = ? AND c.deleted_at IS NOT NULL", id)
+	var category entity.Category
+	err := scanCategory(row, &category)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+func (c *CategoryRepository) RestoreCategory(ctx context.Context, id int) error {
+
+	_, err := c.db.ExecContext(ctx, "UPDATE categories SET deleted_at = NULL, updated_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+// GetPurgeableCategoryIDs returns the categories deleted before the given time,
+// the deepest first so that subcategories are purged before their parent.
+func (c *CategoryRepository) GetPurgeableCategoryIDs(ctx context.Context, before time.Time) ([]int, error) {
+
+	rows, err := c.db.QueryContext(ctx, "SELECT c.id FROM categories c JOIN category_paths p ON p.descendant_id = c.id WHERE c.deleted_at < ? GROUP BY c.id ORDER BY MAX(p.depth) DESC, c.id", before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// PurgeCategory permanently removes a soft deleted category with its
+// attributes. It returns false without deleting when the category was restored
+// meanwhile or still has subcategories, products or attribute values, deleted
+// or not.
+func (c *CategoryRepository) PurgeCategory(ctx context.Context, id int) (bool, error) {
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM categories WHERE id = ? FOR UPDATE", id).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var used bool
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = ?) OR EXISTS (SELECT 1 FROM products WHERE category_id = ?) "+
+			"OR EXISTS (SELECT 1 FROM product_attributes pa JOIN category_attributes a ON a.id = pa.attribute_id WHERE a.category_id = ?)",
+		id, id, id,
+	).Scan(&used)
+	if err != nil {
+		return false, err
+	}
+
+	if !deleted || used {
+		return false, nil
+	}
+
+	for _, query := range []string{
+		"DELETE FROM category_attributes WHERE category_id = ?",
+		"DELETE FROM category_paths WHERE descendant_id = ?",
+		"DELETE FROM categories WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
 }
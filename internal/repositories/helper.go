@@ -0,0 +1,24 @@
+package repositories
+
+import "strings"
+
+// placeholders returns n comma separated "?" placeholders for IN clauses.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// nullString stores empty strings as NULL, e.g. for optional unique columns.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullInt stores 0 as NULL, e.g. for optional foreign keys.
+func nullInt(i int) any {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
@@ -6,53 +6,87 @@ import (
 	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/replica"
 )
 
 // orderDetailRepository implements the OrderDetailRepository interface.
 type OrderDetailRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
+	reads *readStmts
 }
 
 // NewOrderDetailRepository creates a new instance of orderDetailRepository.
-func NewOrderDetailRepository(db *sql.DB) *OrderDetailRepository {
+// The details of several orders are read from the read replicas of replicas,
+// nil keeps them on db.
+func NewOrderDetailRepository(db *sql.DB, replicas *replica.Router) *OrderDetailRepository {
+	stmts := newStmtCache(db)
 	return &OrderDetailRepository{
-		db: db,
+		db:    db,
+		stmts: stmts,
+		reads: newReadStmts(stmts, replicas),
 	}
 }
 
 func (repo *OrderDetailRepository) CreateOrderDetailWithTransaction(ctx context.Context, tx *sql.Tx, orderDetail *entity.OrderDetail) error {
-	query := "INSERT INTO order_details (order_id, product_id, quantity, price, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)"
-	_, err := tx.ExecContext(ctx, query, orderDetail.OrderID, orderDetail.ProductID, orderDetail.Quantity, orderDetail.Price, time.Now(), time.Now())
+	query := "INSERT INTO order_details (order_id, product_id, variant_id, quantity, price, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err := tx.ExecContext(ctx, query, orderDetail.OrderID, orderDetail.ProductID, nullInt(orderDetail.VariantID), orderDetail.Quantity, orderDetail.Price, time.Now(), time.Now())
 	return err
 }
 
+// GetOrderDetailsByOrderID returns the details of the order with their product.
 func (repo *OrderDetailRepository) GetOrderDetailsByOrderID(ctx context.Context, orderID int) ([]*entity.OrderDetail, error) {
 
-	rows, err := repo.db.QueryContext(ctx, "SELECT id, order_id, product_id, quantity, price, created_at, updated_at FROM order_details WHERE order_id = ?", orderID)
+	// the query of a single order has a fixed text and is cached
+	details, err := getOrderDetails(ctx, repo.stmts, []int{orderID})
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
+	return details[orderID], nil
+}
 
-	var orderDetails []*entity.OrderDetail
+// GetOrderDetailsByOrderIDs returns the details of the orders by order id, with
+// their product, in one query.
+func (repo *OrderDetailRepository) GetOrderDetailsByOrderIDs(ctx context.Context, orderIDs ...int) (map[int][]*entity.OrderDetail, error) {
+	return getOrderDetails(ctx, repo.reads.reader(ctx).db, orderIDs)
+}
 
-	for rows.Next() {
-		var orderDetail entity.OrderDetail
-		if err := rows.Scan(&orderDetail.ID, &orderDetail.OrderID, &orderDetail.ProductID, &orderDetail.Quantity, &orderDetail.Price, &orderDetail.CreatedAt, &orderDetail.UpdatedAt); err != nil {
-			return nil, err
-		}
+func getOrderDetails(ctx context.Context, db queryer, orderIDs []int) (map[int][]*entity.OrderDetail, error) {
+
+	details := make(map[int][]*entity.OrderDetail, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return details, nil
+	}
+
+	args := make([]any, len(orderIDs))
+	for i, id := range orderIDs {
+		args[i] = id
+	}
+
+	query := "SELECT d.id, d.order_id, d.product_id, COALESCE(d.variant_id, 0), d.quantity, d.price, d.created_at, d.updated_at, " + productColumns + `
+		FROM order_details d
+		JOIN products p ON p.id = d.product_id
+		WHERE d.order_id IN (` + placeholders(len(orderIDs)) + `)
+		ORDER BY d.order_id, d.id`
 
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var detail entity.OrderDetail
 		var product entity.Product
-		row := repo.db.QueryRowContext(ctx, "SELECT id, name, description, price, created_at, updated_at FROM products WHERE id = ?", orderDetail.ProductID)
-		if err := row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CreatedAt, &product.UpdatedAt); err != nil {
+		fields := append([]any{&detail.ID, &detail.OrderID, &detail.ProductID, &detail.VariantID, &detail.Quantity, &detail.Price, &detail.CreatedAt, &detail.UpdatedAt}, productFields(&product)...)
+		if err := rows.Scan(fields...); err != nil {
 			return nil, err
 		}
 
-		orderDetail.Product = &product
-		orderDetails = append(orderDetails, &orderDetail)
+		detail.Product = &product
+		details[detail.OrderID] = append(details[detail.OrderID], &detail)
 	}
 
-	return orderDetails, nil
-
+	return details, rows.Err()
 }
@@ -3,27 +3,47 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/replica"
 )
 
+// orderColumns are the columns read by scanOrder, from the orders table as o.
+const orderColumns = "o.id, COALESCE(o.user_id, 0), o.total_amount, COALESCE(o.shipping_method_id, 0), o.shipping_cost, COALESCE(o.status, ''), o.created_at, o.updated_at"
+
+// orderFields returns the destinations of orderColumns.
+func orderFields(order *entity.Order) []any {
+	return []any{&order.ID, &order.UserID, &order.TotalAmount, &order.ShippingMethodID, &order.ShippingCost, &order.Status, &order.CreatedAt, &order.UpdatedAt}
+}
+
+func scanOrder(row interface{ Scan(...any) error }, order *entity.Order) error {
+	return row.Scan(orderFields(order)...)
+}
+
 // orderRepository implements the OrderRepository interface.
 type OrderRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
+	reads *readStmts
 }
 
-// NewOrderRepository creates a new instance of orderRepository.
-func NewOrderRepository(db *sql.DB) *OrderRepository {
+// NewOrderRepository creates a new instance of orderRepository. The order lists
+// run on the read replicas of replicas, nil keeps them on db.
+func NewOrderRepository(db *sql.DB, replicas *replica.Router) *OrderRepository {
+	stmts := newStmtCache(db)
 	return &OrderRepository{
-		db: db,
+		db:    db,
+		stmts: stmts,
+		reads: newReadStmts(stmts, replicas),
 	}
 }
 
 func (r *OrderRepository) CreateOrder(ctx context.Context, order *entity.Order) (*entity.Order, error) {
 
 	tNow := time.Now().UTC()
-	result, err := r.db.ExecContext(ctx, "INSERT INTO orders (user_id, total_amount, created_at, updated_at) VALUES (?, ?, ?, ?)", order.UserID, order.TotalAmount, tNow, tNow)
+	result, err := r.db.ExecContext(ctx, "INSERT INTO orders (user_id, total_amount, shipping_method_id, shipping_cost, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", order.UserID, order.TotalAmount, order.ShippingMethodID, order.ShippingCost, tNow, tNow)
 	if err != nil {
 		return nil, err
 	}
@@ -43,8 +63,8 @@ func (repo *OrderRepository) CreateOrderWithTransaction(ctx context.Context, tx
 
 	createdAt := time.Now().UTC()
 	updatedAt := time.Now().UTC()
-	query := "INSERT INTO orders (user_id, total_amount, created_at, updated_at) VALUES (?, ?, ?, ?)"
-	result, err := tx.ExecContext(ctx, query, order.UserID, order.TotalAmount, createdAt, updatedAt)
+	query := "INSERT INTO orders (user_id, total_amount, shipping_method_id, shipping_cost, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := tx.ExecContext(ctx, query, order.UserID, order.TotalAmount, order.ShippingMethodID, order.ShippingCost, createdAt, updatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -74,25 +94,328 @@ func (r *OrderRepository) UpdateOrderStatusWithTransaction(ctx context.Context,
 
 }
 
-func (r *OrderRepository) GetOrdersByUserID(ctx context.Context, userID int) ([]entity.Order, error) {
+func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE orders SET status = ?, updated_at = ? WHERE id = ?", status, time.Now().UTC(), orderID)
+	return err
+}
+
+func (r *OrderRepository) GetOrderByID(ctx context.Context, id int) (*entity.Order, error) {
+
+	row := r.stmts.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders o WHERE o.id = ?", id)
+	var order entity.Order
+	err := scanOrder(row, &order)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// GetOrderForUpdateWithTransaction returns the order locked until the end of tx.
+func (r *OrderRepository) GetOrderForUpdateWithTransaction(ctx context.Context, tx *sql.Tx, id int) (*entity.Order, error) {
 
-	rows, err := r.db.QueryContext(ctx, "SELECT id, user_id, total_amount, status, created_at, updated_at FROM orders WHERE user_id = ?", userID)
+	row := tx.QueryRowContext(ctx, "SELECT "+orderColumns+" FROM orders o WHERE o.id = ? FOR UPDATE", id)
+	var order entity.Order
+	err := scanOrder(row, &order)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	return &order, nil
+}
+
+// ListOrders returns a page of the orders matching filter, newest first, with
+// the number of orders matching.
+func (r *OrderRepository) ListOrders(ctx context.Context, filter entity.OrderFilter) ([]entity.OrderSummary, int, error) {
+
+	var conditions []string
+	var args []any
+
+	if filter.UserID != 0 {
+		conditions = append(conditions, "o.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	if filter.Status != "" {
+		conditions = append(conditions, "o.status = ?")
+		args = append(args, filter.Status)
+	}
+
+	if filter.From != nil {
+		conditions = append(conditions, "o.created_at >= ?")
+		args = append(args, *filter.From)
+	}
+
+	if filter.To != nil {
+		conditions = append(conditions, "o.created_at < ?")
+		args = append(args, *filter.To)
+	}
+
+	if filter.MinTotal != nil {
+		conditions = append(conditions, "o.total_amount >= ?")
+		args = append(args, *filter.MinTotal)
+	}
+
+	if filter.MaxTotal != nil {
+		conditions = append(conditions, "o.total_amount <= ?")
+		args = append(args, *filter.MaxTotal)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	// the count and the page are read from the same database
+	db := r.reads.reader(ctx).db
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders o"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + orderColumns + `, COALESCE(u.username, ''), COALESCE(u.email, ''), (SELECT COUNT(*) FROM order_details d WHERE d.order_id = o.id)
+		FROM orders o
+		LEFT JOIN users u ON u.id = o.user_id` + where + `
+		ORDER BY o.created_at DESC, o.id DESC
+		LIMIT ? OFFSET ?`
+
+	rows, err := db.QueryContext(ctx, query, append(args, filter.PerPage, (filter.Page-1)*filter.PerPage)...)
+	if err != nil {
+		return nil, 0, err
+	}
 	defer rows.Close()
 
-	var orders []entity.Order
+	orders := []entity.OrderSummary{}
+	for rows.Next() {
+		var order entity.OrderSummary
+		if err := rows.Scan(append(orderFields(&order.Order), &order.Username, &order.Email, &order.ItemCount)...); err != nil {
+			return nil, 0, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, total, rows.Err()
+}
+
+// UpdateOrderStatusFromWithTransaction moves the order from the status from to
+// to. It returns false when the order is no longer in the status from.
+func (r *OrderRepository) UpdateOrderStatusFromWithTransaction(ctx context.Context, tx *sql.Tx, orderID int, from, to string) (bool, error) {
+
+	result, err := tx.ExecContext(ctx, "UPDATE orders SET status = ?, updated_at = ? WHERE id = ? AND status = ?", to, time.Now().UTC(), orderID, from)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// RestockOrderWithTransaction puts the items of the order back in stock, for
+// the products and variants whose stock is tracked.
+func (r *OrderRepository) RestockOrderWithTransaction(ctx context.Context, tx *sql.Tx, orderID int) error {
+
+	_, err := tx.ExecContext(
+		ctx,
+		`UPDATE products p
+		JOIN (SELECT product_id, SUM(quantity) AS quantity FROM order_details WHERE order_id = ? AND variant_id IS NULL GROUP BY product_id) d ON d.product_id = p.id
+		SET p.stock = p.stock + d.quantity
+		WHERE p.stock IS NOT NULL`,
+		orderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE product_variants v
+		JOIN (SELECT variant_id, SUM(quantity) AS quantity FROM order_details WHERE order_id = ? AND variant_id IS NOT NULL GROUP BY variant_id) d ON d.variant_id = v.id
+		SET v.stock = v.stock + d.quantity
+		WHERE v.stock IS NOT NULL`,
+		orderID,
+	)
+	return err
+}
+
+// StoreOrderNote stores a note on an order, in tx when it is not nil.
+func (r *OrderRepository) StoreOrderNote(ctx context.Context, tx *sql.Tx, note *entity.OrderNote) error {
+
+	var db execer = r.db
+	if tx != nil {
+		db = tx
+	}
+
+	note.CreatedAt = time.Now().UTC()
+	result, err := db.ExecContext(ctx, "INSERT INTO order_notes (order_id, author_id, note, created_at) VALUES (?, ?, ?, ?)", note.OrderID, nullInt(note.AuthorID), note.Note, note.CreatedAt)
+	if err != nil {
+		return err
+	}
 
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	note.ID = int(id)
+	return nil
+}
+
+// GetOrderNotes returns the notes of the order, oldest first.
+func (r *OrderRepository) GetOrderNotes(ctx context.Context, orderID int) ([]entity.OrderNote, error) {
+
+	rows, err := r.db.QueryContext(ctx, "SELECT n.id, n.order_id, COALESCE(n.author_id, 0), COALESCE(u.username, ''), n.note, n.created_at FROM order_notes n LEFT JOIN users u ON u.id = n.author_id WHERE n.order_id = ? ORDER BY n.id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []entity.OrderNote{}
 	for rows.Next() {
-		var order entity.Order
-		err := rows.Scan(&order.ID, &order.UserID, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+		var note entity.OrderNote
+		if err := rows.Scan(&note.ID, &note.OrderID, &note.AuthorID, &note.Author, &note.Note, &note.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
+// ExportOrders passes the orders placed from from until to with their details
+// to fn by id, reading them one at a time. The details carry the name of their
+// product and the SKU sold.
+func (r *OrderRepository) ExportOrders(ctx context.Context, from, to time.Time, fn func(*entity.Order) error) error {
+
+	query := `SELECT ` + orderColumns + `,
+			d.id, COALESCE(d.product_id, 0), COALESCE(d.variant_id, 0), COALESCE(d.quantity, 0), COALESCE(d.price, 0), COALESCE(v.sku, p.sku, ''), COALESCE(p.name, '')
+		FROM orders o
+		LEFT JOIN order_details d ON d.order_id = o.id
+		LEFT JOIN products p ON p.id = d.product_id
+		LEFT JOIN product_variants v ON v.id = d.variant_id
+		WHERE o.created_at >= ? AND o.created_at < ?
+		ORDER BY o.id, d.id`
+
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var order *entity.Order
+	for rows.Next() {
+		var current entity.Order
+		var detailID sql.NullInt64
+		detail := &entity.OrderDetail{Product: &entity.Product{}}
+		err := rows.Scan(append(orderFields(&current), &detailID, &detail.ProductID, &detail.VariantID, &detail.Quantity, &detail.Price, &detail.SKU, &detail.Product.Name)...)
 		if err != nil {
+			return err
+		}
+
+		if order == nil || order.ID != current.ID {
+			if order != nil {
+				if err := fn(order); err != nil {
+					return err
+				}
+			}
+			order = &current
+		}
+
+		// orders without details come with a single row of NULL details
+		if detailID.Valid {
+			detail.ID = int(detailID.Int64)
+			detail.OrderID = order.ID
+			detail.Product.ID = detail.ProductID
+			order.OrderDetails = append(order.OrderDetails, detail)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if order != nil {
+		return fn(order)
+	}
+
+	return nil
+}
+
+// CreateOrderAddressWithTransaction stores the shipping address snapshot of an order.
+func (r *OrderRepository) CreateOrderAddressWithTransaction(ctx context.Context, tx *sql.Tx, address *entity.OrderAddress) error {
+
+	createdAt := time.Now().UTC()
+	query := "INSERT INTO order_addresses (order_id, recipient_name, phone, line1, line2, city, state, postal_code, country, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := tx.ExecContext(ctx, query, address.OrderID, address.RecipientName, address.Phone, address.Line1, address.Line2, address.City, address.State, address.PostalCode, address.Country, createdAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	address.ID = int(id)
+	address.CreatedAt = createdAt
+
+	return nil
+}
+
+// GetOrderAddressesByOrderIDs returns the shipping addresses of the orders by
+// order id, in one query.
+func (r *OrderRepository) GetOrderAddressesByOrderIDs(ctx context.Context, orderIDs ...int) (map[int]*entity.OrderAddress, error) {
+
+	addresses := make(map[int]*entity.OrderAddress, len(orderIDs))
+	if len(orderIDs) == 0 {
+		return addresses, nil
+	}
+
+	args := make([]any, len(orderIDs))
+	for i, id := range orderIDs {
+		args[i] = id
+	}
+
+	rows, err := r.reads.reader(ctx).db.QueryContext(ctx, "SELECT id, order_id, recipient_name, phone, line1, line2, city, state, postal_code, country, created_at FROM order_addresses WHERE order_id IN ("+placeholders(len(orderIDs))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var address entity.OrderAddress
+		if err := rows.Scan(&address.ID, &address.OrderID, &address.RecipientName, &address.Phone, &address.Line1, &address.Line2, &address.City, &address.State, &address.PostalCode, &address.Country, &address.CreatedAt); err != nil {
 			return nil, err
 		}
 
-		orders = append(orders, order)
+		addresses[address.OrderID] = &address
+	}
+
+	return addresses, rows.Err()
+}
+
+func (r *OrderRepository) GetOrderAddressByOrderID(ctx context.Context, orderID int) (*entity.OrderAddress, error) {
+
+	row := r.stmts.QueryRowContext(ctx, "SELECT id, order_id, recipient_name, phone, line1, line2, city, state, postal_code, country, created_at FROM order_addresses WHERE order_id = ?", orderID)
+	var address entity.OrderAddress
+	err := row.Scan(&address.ID, &address.OrderID, &address.RecipientName, &address.Phone, &address.Line1, &address.Line2, &address.City, &address.State, &address.PostalCode, &address.Country, &address.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return orders, nil
+	return &address, nil
 }
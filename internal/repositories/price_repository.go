@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type PriceRepository struct {
+	db *sql.DB
+}
+
+func NewPriceRepository(db *sql.DB) *PriceRepository {
+	return &PriceRepository{db: db}
+}
+
+const priceScheduleColumns = "id, product_id, price, regular_price, starts_at, ends_at, status, created_at, updated_at"
+
+func scanPriceSchedule(row interface{ Scan(...any) error }, schedule *entity.PriceSchedule) error {
+	return row.Scan(&schedule.ID, &schedule.ProductID, &schedule.Price, &schedule.RegularPrice, &schedule.StartsAt, &schedule.EndsAt, &schedule.Status, &schedule.CreatedAt, &schedule.UpdatedAt)
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// storePriceChange records a new price of the product in its history.
+func storePriceChange(ctx context.Context, db execer, productID int, price float64, source string, scheduleID *int, changedAt time.Time) error {
+
+	_, err := db.ExecContext(ctx, "INSERT INTO product_price_history (product_id, price, source, schedule_id, changed_at) VALUES (?, ?, ?, ?, ?)", productID, price, source, scheduleID, changedAt)
+	return err
+}
+
+// GetPriceHistory returns the price changes of the product, oldest first.
+func (p *PriceRepository) GetPriceHistory(ctx context.Context, productID int) ([]entity.PriceChange, error) {
+
+	rows, err := p.db.QueryContext(ctx, "SELECT id, product_id, price, source, schedule_id, changed_at FROM product_price_history WHERE product_id = ? ORDER BY changed_at, id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []entity.PriceChange
+	for rows.Next() {
+		var change entity.PriceChange
+		if err := rows.Scan(&change.ID, &change.ProductID, &change.Price, &change.Source, &change.ScheduleID, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+// GetSchedules returns the price schedules of the product by start time.
+func (p *PriceRepository) GetSchedules(ctx context.Context, productID int) ([]*entity.PriceSchedule, error) {
+	return getPriceSchedules(ctx, p.db, "SELECT "+priceScheduleColumns+" FROM price_schedules WHERE product_id = ? ORDER BY starts_at, id", productID)
+}
+
+func (p *PriceRepository) GetScheduleByID(ctx context.Context, id int) (*entity.PriceSchedule, error) {
+
+	row := p.db.QueryRowContext(ctx, "SELECT "+priceScheduleColumns+" FROM price_schedules WHERE id = ?", id)
+	var schedule entity.PriceSchedule
+	err := scanPriceSchedule(row, &schedule)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// GetActiveSchedules returns the running schedules of the products by product id.
+func (p *PriceRepository) GetActiveSchedules(ctx context.Context, productIDs ...int) (map[int]*entity.PriceSchedule, error) {
+
+	active := make(map[int]*entity.PriceSchedule, len(productIDs))
+	if len(productIDs) == 0 {
+		return active, nil
+	}
+
+	args := []any{entity.PriceScheduleActive}
+	for _, id := range productIDs {
+		args = append(args, id)
+	}
+
+	schedules, err := getPriceSchedules(ctx, p.db, "SELECT "+priceScheduleColumns+" FROM price_schedules WHERE status = ? AND product_id IN ("+placeholders(len(productIDs))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schedule := range schedules {
+		active[schedule.ProductID] = schedule
+	}
+
+	return active, nil
+}
+
+// StoreSchedule adds a pending schedule. It returns false without storing it
+// when it overlaps a pending or active schedule of the product.
+func (p *PriceRepository) StoreSchedule(ctx context.Context, schedule *entity.PriceSchedule) (bool, error) {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// the product row serializes the overlap checks of concurrent requests
+	var locked int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM products WHERE id = ? FOR UPDATE", schedule.ProductID).Scan(&locked); err != nil {
+		return false, err
+	}
+
+	var overlaps bool
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM price_schedules WHERE product_id = ? AND status IN (?, ?) AND (ends_at IS NULL OR ends_at > ?) AND (? IS NULL OR starts_at < ?))",
+		schedule.ProductID, entity.PriceSchedulePending, entity.PriceScheduleActive, schedule.StartsAt, schedule.EndsAt, schedule.EndsAt,
+	).Scan(&overlaps)
+	if err != nil {
+		return false, err
+	}
+
+	if overlaps {
+		return false, nil
+	}
+
+	tNow := time.Now().UTC()
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO price_schedules (product_id, price, starts_at, ends_at, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		schedule.ProductID, schedule.Price, schedule.StartsAt, schedule.EndsAt, entity.PriceSchedulePending, tNow, tNow,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+
+	schedule.ID = int(id)
+	schedule.Status = entity.PriceSchedulePending
+	schedule.CreatedAt = tNow
+	schedule.UpdatedAt = tNow
+
+	return true, tx.Commit()
+}
+
+// CancelSchedule cancels a schedule that has not started. It returns false
+// when the schedule already started or ended.
+func (p *PriceRepository) CancelSchedule(ctx context.Context, id int) (bool, error) {
+
+	result, err := p.db.ExecContext(ctx, "UPDATE price_schedules SET status = ?, updated_at = ? WHERE id = ? AND status = ?", entity.PriceScheduleCancelled, time.Now().UTC(), id, entity.PriceSchedulePending)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// ApplySchedules starts the pending schedules whose start time has passed and
+// ends the active schedules whose end time has passed, and returns the ids of
+// the products whose price changed. An ended schedule only puts the regular
+// price back when the price was not changed meanwhile.
+func (p *PriceRepository) ApplySchedules(ctx context.Context, now time.Time) ([]int, error) {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var changed []int
+
+	starting, err := getPriceSchedules(ctx, tx, "SELECT "+priceScheduleColumns+" FROM price_schedules WHERE status = ? AND starts_at <= ? ORDER BY starts_at, id FOR UPDATE", entity.PriceSchedulePending, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schedule := range starting {
+		var regular float64
+		if err := tx.QueryRowContext(ctx, "SELECT price FROM products WHERE id = ? FOR UPDATE", schedule.ProductID).Scan(&regular); err != nil {
+			return nil, err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE products SET price = ?, updated_at = ? WHERE id = ?", schedule.Price, now, schedule.ProductID); err != nil {
+			return nil, err
+		}
+
+		if err := storePriceChange(ctx, tx, schedule.ProductID, schedule.Price, entity.PriceSourceSchedule, &schedule.ID, now); err != nil {
+			return nil, err
+		}
+
+		// schedules without an end are done once started
+		status := entity.PriceScheduleActive
+		if schedule.EndsAt == nil {
+			status = entity.PriceScheduleCompleted
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE price_schedules SET status = ?, regular_price = ?, updated_at = ? WHERE id = ?", status, regular, now, schedule.ID); err != nil {
+			return nil, err
+		}
+
+		changed = append(changed, schedule.ProductID)
+	}
+
+	ending, err := getPriceSchedules(ctx, tx, "SELECT "+priceScheduleColumns+" FROM price_schedules WHERE status = ? AND ends_at <= ? ORDER BY ends_at, id FOR UPDATE", entity.PriceScheduleActive, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, schedule := range ending {
+		var current float64
+		if err := tx.QueryRowContext(ctx, "SELECT price FROM products WHERE id = ? FOR UPDATE", schedule.ProductID).Scan(&current); err != nil {
+			return nil, err
+		}
+
+		if schedule.RegularPrice != nil && current == schedule.Price {
+			if _, err := tx.ExecContext(ctx, "UPDATE products SET price = ?, updated_at = ? WHERE id = ?", *schedule.RegularPrice, now, schedule.ProductID); err != nil {
+				return nil, err
+			}
+
+			if err := storePriceChange(ctx, tx, schedule.ProductID, *schedule.RegularPrice, entity.PriceSourceSchedule, &schedule.ID, now); err != nil {
+				return nil, err
+			}
+
+			changed = append(changed, schedule.ProductID)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE price_schedules SET status = ?, updated_at = ? WHERE id = ?", entity.PriceScheduleCompleted, now, schedule.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return changed, tx.Commit()
+}
+
+func getPriceSchedules(ctx context.Context, db queryer, query string, args ...any) ([]*entity.PriceSchedule, error) {
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*entity.PriceSchedule
+	for rows.Next() {
+		var schedule entity.PriceSchedule
+		if err := scanPriceSchedule(rows, &schedule); err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, rows.Err()
+}
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type ProductImageRepository struct {
+	db *sql.DB
+}
+
+func NewProductImageRepository(db *sql.DB) *ProductImageRepository {
+	return &ProductImageRepository{db: db}
+}
+
+const productImageColumns = "id, product_id, storage_key, content_type, size, width, height, position, created_at"
+
+func scanProductImage(row interface{ Scan(...any) error }, image *entity.ProductImage) error {
+	return row.Scan(&image.ID, &image.ProductID, &image.Key, &image.ContentType, &image.Size, &image.Width, &image.Height, &image.Position, &image.CreatedAt)
+}
+
+// StoreImage appends the image after the existing images of the product.
+func (p *ProductImageRepository) StoreImage(ctx context.Context, image *entity.ProductImage) (*entity.ProductImage, error) {
+
+	tNow := time.Now().UTC()
+	result, err := p.db.ExecContext(ctx,
+		"INSERT INTO product_images (product_id, storage_key, content_type, size, width, height, position, created_at) "+
+			"SELECT ?, ?, ?, ?, ?, ?, COALESCE(MAX(position) + 1, 0), ? FROM product_images WHERE product_id = ?",
+		image.ProductID, image.Key, image.ContentType, image.Size, image.Width, image.Height, tNow, image.ProductID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.GetImageByID(ctx, int(id))
+}
+
+func (p *ProductImageRepository) GetImageByID(ctx context.Context, id int) (*entity.ProductImage, error) {
+
+	var image entity.ProductImage
+	err := scanProductImage(p.db.QueryRowContext(ctx, "SELECT "+productImageColumns+" FROM product_images WHERE id = ?", id), &image)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// GetImagesByProductIDs returns the images of the products in display order by product id.
+func (p *ProductImageRepository) GetImagesByProductIDs(ctx context.Context, productIDs ...int) (map[int][]*entity.ProductImage, error) {
+
+	images := make(map[int][]*entity.ProductImage)
+	if len(productIDs) == 0 {
+		return images, nil
+	}
+
+	args := make([]any, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := p.db.QueryContext(ctx, "SELECT "+productImageColumns+" FROM product_images WHERE product_id IN ("+placeholders(len(args))+") ORDER BY product_id, position, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image entity.ProductImage
+		if err := scanProductImage(rows, &image); err != nil {
+			return nil, err
+		}
+
+		images[image.ProductID] = append(images[image.ProductID], &image)
+	}
+
+	return images, rows.Err()
+}
+
+// ReorderImages sets the position of each image to its index in ids.
+func (p *ProductImageRepository) ReorderImages(ctx context.Context, productID int, ids []int) error {
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for position, id := range ids {
+		_, err := tx.ExecContext(ctx, "UPDATE product_images SET position = ? WHERE id = ? AND product_id = ?", position, id, productID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *ProductImageRepository) DeleteImage(ctx context.Context, id int) error {
+
+	_, err := p.db.ExecContext(ctx, "DELETE FROM product_images WHERE id = ?", id)
+	return err
+}
@@ -3,74 +3,240 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/replica"
 )
 
 type ProductRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	stmts *stmtCache
+	reads *readStmts
 }
 
-func NewProductRepository(db *sql.DB) *ProductRepository {
+// NewProductRepository runs the product listings on the read replicas of
+// replicas, nil keeps them on db.
+func NewProductRepository(db *sql.DB, replicas *replica.Router) *ProductRepository {
+	stmts := newStmtCache(db)
 	return &ProductRepository{
-		db: db,
+		db:    db,
+		stmts: stmts,
+		reads: newReadStmts(stmts, replicas),
 	}
 }
 
-func (u *ProductRepository) GetProductsByCategoryID(ctx context.Context, ctg *entity.Category) (*entity.Category, error) {
+const productColumns = "p.id, COALESCE(p.sku, ''), p.name, p.description, p.price, p.category_id, p.weight, p.length, p.width, p.height, p.stock, p.status, p.publish_at, p.unpublish_at, p.created_at, p.updated_at, p.deleted_at"
 
-	var categories entity.Category
+// productFields returns the scan destinations of productColumns, to be combined
+// with the columns of joined tables.
+func productFields(product *entity.Product) []any {
+	return []any{&product.ID, &product.SKU, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.Weight, &product.Length, &product.Width, &product.Height, &product.Stock, &product.Status, &product.PublishAt, &product.UnpublishAt, &product.CreatedAt, &product.UpdatedAt, &product.DeletedAt}
+}
+
+func scanProduct(row interface{ Scan(...any) error }, product *entity.Product) error {
+	return row.Scan(productFields(product)...)
+}
+
+// visibleProductSQL is the condition on products p selecting the products
+// customers see at the time given twice as argument, like entity.ProductVisible.
+const visibleProductSQL = "(p.unpublish_at IS NULL OR p.unpublish_at > ?) AND (p.status = '" + entity.ProductPublished + "' OR p.publish_at <= ?)"
+
+// getProducts runs a catalog query with a fixed text as a cached statement, on
+// a read replica.
+func (u *ProductRepository) getProducts(ctx context.Context, query string, args ...any) ([]entity.Product, error) {
+	return queryProducts(ctx, u.reads.reader(ctx), query, args...)
+}
+
+// queryProducts runs a query selecting productColumns.
+func queryProducts(ctx context.Context, db queryer, query string, args ...any) ([]entity.Product, error) {
 
-	rows, err := u.db.QueryContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products WHERE category_id = ?", ctg.ID)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var products []entity.Product
-
 	for rows.Next() {
 		var product entity.Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.CreatedAt, &product.UpdatedAt)
-		if err != nil {
+		if err := scanProduct(rows, &product); err != nil {
 			return nil, err
 		}
 
 		products = append(products, product)
 	}
 
-	categories.Products = products
+	return products, rows.Err()
+}
 
-	return &categories, nil
+// getProductsByIDs returns the products with the given ids by id, including the
+// deleted ones. Repeated ids are loaded once.
+func getProductsByIDs(ctx context.Context, db queryer, ids []int) (map[int]*entity.Product, error) {
+
+	products := make(map[int]*entity.Product, len(ids))
+	if len(ids) == 0 {
+		return products, nil
+	}
+
+	seen := make(map[int]bool, len(ids))
+	var args []any
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			args = append(args, id)
+		}
+	}
+
+	list, err := queryProducts(ctx, db, "SELECT "+productColumns+" FROM products p WHERE p.id IN ("+placeholders(len(args))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		products[list[i].ID] = &list[i]
+	}
+
+	return products, nil
 }
 
-func (u *ProductRepository) GetAllProducts(ctx context.Context) ([]entity.Product, error) {
+// attachProducts loads the products of the cart items in one query. Items whose
+// product was deleted are marked ProductDeleted.
+func attachProducts(ctx context.Context, db queryer, cartItems []*entity.CartItem) error {
+
+	ids := make([]int, len(cartItems))
+	for i, item := range cartItems {
+		ids[i] = item.ProductID
+	}
 
-	rows, err := u.db.QueryContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products")
+	products, err := getProductsByIDs(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range cartItems {
+		product, ok := products[item.ProductID]
+		if ok {
+			item.Product = *product
+		}
+		item.ProductDeleted = !ok || product.DeletedAt != nil
+	}
+
+	return nil
+}
+
+// GetProductsByCategoryID returns the products of the category, and of all the
+// categories below it when includeDescendants is set. Drafts and unpublished
+// products are only included with includeHidden.
+func (u *ProductRepository) GetProductsByCategoryID(ctx context.Context, ctg *entity.Category, includeDescendants bool, includeHidden bool) (*entity.Category, error) {
+
+	var categories entity.Category
+
+	query := "SELECT " + productColumns + " FROM products p WHERE p.category_id = ? AND p.deleted_at IS NULL"
+	if includeDescendants {
+		query = "SELECT " + productColumns + " FROM products p WHERE p.category_id IN (SELECT descendant_id FROM category_paths WHERE ancestor_id = ?) AND p.deleted_at IS NULL"
+	}
+
+	args := []any{ctg.ID}
+	if !includeHidden {
+		now := time.Now().UTC()
+		query += " AND " + visibleProductSQL
+		args = append(args, now, now)
+	}
+
+	products, err := u.getProducts(ctx, query+" ORDER BY p.id", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	var products []entity.Product
+	categories.Products = products
 
-	for rows.Next() {
-		var product entity.Product
-		err := rows.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.CreatedAt, &product.UpdatedAt)
-		if err != nil {
-			return nil, err
+	return &categories, nil
+}
+
+// GetAllProducts returns the products customers see, and the drafts and
+// unpublished products with includeHidden.
+func (u *ProductRepository) GetAllProducts(ctx context.Context, includeHidden bool) ([]entity.Product, error) {
+
+	query := "SELECT " + productColumns + " FROM products p WHERE p.deleted_at IS NULL"
+
+	var args []any
+	if !includeHidden {
+		now := time.Now().UTC()
+		query += " AND " + visibleProductSQL
+		args = append(args, now, now)
+	}
+
+	return u.getProducts(ctx, query+" ORDER BY p.id", args...)
+}
+
+// SearchProducts returns the products matching filter.
+func (u *ProductRepository) SearchProducts(ctx context.Context, filter entity.ProductFilter) ([]entity.Product, error) {
+
+	where, args := productFilterSQL(filter)
+	return queryProducts(ctx, u.reads.reader(ctx).db, "SELECT "+productColumns+" FROM products p WHERE "+where+" ORDER BY p.id", args...)
+}
+
+// productFilterSQL returns the condition on products p selecting the products
+// matching filter, with its arguments.
+func productFilterSQL(filter entity.ProductFilter) (string, []any) {
+
+	conditions := []string{"p.deleted_at IS NULL"}
+	var args []any
+
+	if !filter.IncludeHidden {
+		now := time.Now().UTC()
+		conditions = append(conditions, visibleProductSQL)
+		args = append(args, now, now)
+	}
+
+	if filter.CategoryID != 0 {
+		conditions = append(conditions, "p.category_id IN (SELECT descendant_id FROM category_paths WHERE ancestor_id = ?)")
+		args = append(args, filter.CategoryID)
+	}
+
+	if filter.MinPrice != nil {
+		conditions = append(conditions, "p.price >= ?")
+		args = append(args, *filter.MinPrice)
+	}
+
+	if filter.MaxPrice != nil {
+		conditions = append(conditions, "p.price <= ?")
+		args = append(args, *filter.MaxPrice)
+	}
+
+	codes := make([]string, 0, len(filter.Attributes))
+	for code := range filter.Attributes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		values := filter.Attributes[code]
+		if len(values) == 0 {
+			continue
 		}
 
-		products = append(products, product)
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM product_attributes pa "+
+			"WHERE pa.product_id = p.id AND pa.attribute_id = ? AND pa.value IN ("+placeholders(len(values))+"))")
+		args = append(args, filter.AttributeIDs[code])
+		for _, value := range values {
+			args = append(args, value)
+		}
 	}
 
-	return products, nil
+	return strings.Join(conditions, " AND "), args
 }
 
+// GetProductByID returns the product unless it was deleted, whether customers
+// see it or not.
 func (u *ProductRepository) GetProductByID(ctx context.Context, id int) (*entity.Product, error) {
 
-	row := u.db.QueryRowContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products WHERE id = ?", id)
+	row := u.stmts.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products p WHERE p.id = ? AND p.deleted_at IS NULL", id)
 	var product entity.Product
-	if err := row.Scan(&product.ID, &product.Name, &product.Description, &product.Price, &product.CategoryID, &product.CreatedAt, &product.UpdatedAt); err != nil {
+	if err := scanProduct(row, &product); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -83,8 +249,14 @@ func (u *ProductRepository) GetProductByID(ctx context.Context, id int) (*entity
 
 func (u *ProductRepository) StoreProduct(ctx context.Context, product entity.Product) (*entity.Product, error) {
 
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	tNow := time.Now().UTC()
-	result, err := u.db.ExecContext(ctx, "INSERT INTO products (name, description, price, category_id, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", product.Name, product.Description, product.Price, product.CategoryID, tNow, tNow)
+	result, err := tx.ExecContext(ctx, "INSERT INTO products (sku, name, description, price, category_id, weight, length, width, height, stock, status, publish_at, unpublish_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", nullString(product.SKU), product.Name, product.Description, product.Price, product.CategoryID, product.Weight, product.Length, product.Width, product.Height, product.Stock, product.Status, product.PublishAt, product.UnpublishAt, tNow, tNow)
 	if err != nil {
 		return nil, err
 	}
@@ -94,9 +266,16 @@ func (u *ProductRepository) StoreProduct(ctx context.Context, product entity.Pro
 		return nil, err
 	}
 
+	if err := storePriceChange(ctx, tx, int(id), product.Price, entity.PriceSourceManual, nil, tNow); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
 	var insertedProduct entity.Product
-	err = u.db.QueryRowContext(ctx, "SELECT id, name, description, price, category_id, created_at, updated_at FROM products WHERE id = ?", id).
-		Scan(&insertedProduct.ID, &insertedProduct.Name, &insertedProduct.Description, &insertedProduct.Price, &insertedProduct.CategoryID, &insertedProduct.CreatedAt, &insertedProduct.UpdatedAt)
+	err = scanProduct(u.db.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products p WHERE p.id = ?", id), &insertedProduct)
 	if err != nil {
 		return nil, err
 	}
@@ -105,20 +284,214 @@ func (u *ProductRepository) StoreProduct(ctx context.Context, product entity.Pro
 
 }
 
+// UpdateProduct records the new price in the price history when it changed.
 func (u *ProductRepository) UpdateProduct(ctx context.Context, product *entity.Product) error {
 
-	_, err := u.db.ExecContext(ctx, "UPDATE products SET name = ?, description = ?, price = ?, updated_at = ? WHERE id = ?", product.Name, product.Description, product.Price, time.Now().UTC(), product.ID)
+	tx, err := u.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil
+		return err
+	}
+	defer tx.Rollback()
+
+	var price float64
+	if err := tx.QueryRowContext(ctx, "SELECT price FROM products WHERE id = ? FOR UPDATE", product.ID).Scan(&price); err != nil {
+		return err
+	}
+
+	tNow := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, "UPDATE products SET name = ?, description = ?, price = ?, weight = ?, length = ?, width = ?, height = ?, stock = ?, updated_at = ? WHERE id = ?", product.Name, product.Description, product.Price, product.Weight, product.Length, product.Width, product.Height, product.Stock, tNow, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if product.Price != price {
+		if err := storePriceChange(ctx, tx, product.ID, product.Price, entity.PriceSourceManual, nil, tNow); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+
+}
+
+// GetProductsBySKUs returns the products with the given SKUs by lower case SKU,
+// including the deleted ones. SKUs are compared without case like the database
+// does.
+func (u *ProductRepository) GetProductsBySKUs(ctx context.Context, skus ...string) (map[string]*entity.Product, error) {
+
+	products := make(map[string]*entity.Product, len(skus))
+	if len(skus) == 0 {
+		return products, nil
+	}
+
+	args := make([]any, len(skus))
+	for i, sku := range skus {
+		args[i] = sku
+	}
+
+	list, err := queryProducts(ctx, u.db, "SELECT "+productColumns+" FROM products p WHERE p.sku IN ("+placeholders(len(skus))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		products[strings.ToLower(list[i].SKU)] = &list[i]
+	}
+
+	return products, nil
+}
+
+// UpsertProducts updates the products with an id and inserts the others in one
+// transaction, setting their id. Price changes are recorded in the price history.
+// The attributes of products[i] are replaced by attributes[i] unless it is nil.
+func (u *ProductRepository) UpsertProducts(ctx context.Context, products []*entity.Product, attributes [][]entity.ProductAttribute) error {
+
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tNow := time.Now().UTC()
+	for i, product := range products {
+		if product.ID == 0 {
+			result, err := tx.ExecContext(ctx, "INSERT INTO products (sku, name, description, price, category_id, weight, length, width, height, stock, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", nullString(product.SKU), product.Name, product.Description, product.Price, product.CategoryID, product.Weight, product.Length, product.Width, product.Height, product.Stock, product.Status, tNow, tNow)
+			if err != nil {
+				return err
+			}
+
+			id, err := result.LastInsertId()
+			if err != nil {
+				return err
+			}
+
+			product.ID = int(id)
+			if err := storePriceChange(ctx, tx, product.ID, product.Price, entity.PriceSourceManual, nil, tNow); err != nil {
+				return err
+			}
+		} else if err := updateImportedProduct(ctx, tx, product, tNow); err != nil {
+			return err
+		}
+
+		if attributes[i] != nil {
+			if err := replaceProductAttributes(ctx, tx, product.ID, attributes[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// updateImportedProduct updates a product of UpsertProducts, recording a price
+// change.
+func updateImportedProduct(ctx context.Context, tx *sql.Tx, product *entity.Product, tNow time.Time) error {
+
+	var price float64
+	if err := tx.QueryRowContext(ctx, "SELECT price FROM products WHERE id = ? FOR UPDATE", product.ID).Scan(&price); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE products SET name = ?, description = ?, price = ?, weight = ?, length = ?, width = ?, height = ?, stock = ?, status = ?, updated_at = ? WHERE id = ?", product.Name, product.Description, product.Price, product.Weight, product.Length, product.Width, product.Height, product.Stock, product.Status, tNow, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if product.Price != price {
+		return storePriceChange(ctx, tx, product.ID, product.Price, entity.PriceSourceManual, nil, tNow)
 	}
 
 	return nil
+}
+
+// ExportProducts passes every product that is not deleted to fn by id, reading
+// them one at a time.
+func (u *ProductRepository) ExportProducts(ctx context.Context, fn func(*entity.Product) error) error {
+
+	rows, err := u.db.QueryContext(ctx, "SELECT "+productColumns+" FROM products p WHERE p.deleted_at IS NULL ORDER BY p.id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		var product entity.Product
+		if err := scanProduct(rows, &product); err != nil {
+			return err
+		}
+
+		if err := fn(&product); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
 }
 
+// SetPublishing changes the status and the publishing schedule of the product.
+func (u *ProductRepository) SetPublishing(ctx context.Context, id int, status string, publishAt, unpublishAt *time.Time) error {
+
+	_, err := u.db.ExecContext(ctx, "UPDATE products SET status = ?, publish_at = ?, unpublish_at = ?, updated_at = ? WHERE id = ?", status, publishAt, unpublishAt, time.Now().UTC(), id)
+	return err
+}
+
+// ApplySchedule publishes and unpublishes the products whose scheduled time
+// has passed, clearing the applied times, and returns their ids. A product
+// whose both times have passed ends up unpublished.
+func (u *ProductRepository) ApplySchedule(ctx context.Context, now time.Time) ([]int, error) {
+
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM products WHERE deleted_at IS NULL AND (publish_at <= ? OR unpublish_at <= ?) FOR UPDATE", now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := []any{now, entity.ProductUnpublished, entity.ProductPublished, now, now}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE products SET status = CASE WHEN unpublish_at <= ? THEN ? ELSE ? END, publish_at = NULL, "+
+			"unpublish_at = CASE WHEN unpublish_at <= ? THEN NULL ELSE unpublish_at END, updated_at = ? WHERE id IN ("+placeholders(len(ids))+")",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, tx.Commit()
+}
+
+// DeleteProduct soft deletes the product, which stays referenced by the orders
+// and carts holding it.
 func (u *ProductRepository) DeleteProduct(ctx context.Context, id int) error {
 
-	_, err := u.db.ExecContext(ctx, "DELETE FROM products WHERE id = ?", id)
+	_, err := u.db.ExecContext(ctx, "UPDATE products SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL", time.Now().UTC(), time.Now().UTC(), id)
 	if err != nil {
 		return err
 	}
@@ -126,3 +499,131 @@ func (u *ProductRepository) DeleteProduct(ctx context.Context, id int) error {
 	return nil
 
 }
+
+// GetDeletedProducts returns the soft deleted products, most recently deleted first.
+func (u *ProductRepository) GetDeletedProducts(ctx context.Context) ([]entity.Product, error) {
+
+	return u.getProducts(ctx, "SELECT "+productColumns+" FROM products p WHERE p.deleted_at IS NOT NULL ORDER BY p.deleted_at DESC, p.id")
+}
+
+// GetDeletedProductByID returns the product when it is soft deleted.
+func (u *ProductRepository) GetDeletedProductByID(ctx context.Context, id int) (*entity.Product, error) {
+
+	row := u.db.QueryRowContext(ctx, "SELECT "+productColumns+" FROM products p WHERE p.id = ? AND p.deleted_at IS NOT NULL", id)
+	var product entity.Product
+	if err := scanProduct(row, &product); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (u *ProductRepository) RestoreProduct(ctx context.Context, id int) error {
+
+	_, err := u.db.ExecContext(ctx, "UPDATE products SET deleted_at = NULL, updated_at = ? WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
+
+// GetPurgeableProductIDs returns the products deleted before the given time
+// that were never ordered.
+func (u *ProductRepository) GetPurgeableProductIDs(ctx context.Context, before time.Time) ([]int, error) {
+
+	rows, err := u.db.QueryContext(ctx, "SELECT p.id FROM products p WHERE p.deleted_at < ? AND NOT EXISTS (SELECT 1 FROM order_details od WHERE od.product_id = p.id) ORDER BY p.id", before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// PurgeProduct permanently removes a soft deleted product with its variants,
+// attributes, reviews and the cart and wishlist items holding it. It returns
+// false without deleting when the product was restored or ordered meanwhile.
+// The images must be removed beforehand.
+func (u *ProductRepository) PurgeProduct(ctx context.Context, id int) (bool, error) {
+
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	err = tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM products WHERE id = ? FOR UPDATE", id).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var ordered bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM order_details WHERE product_id = ?)", id).Scan(&ordered); err != nil {
+		return false, err
+	}
+
+	if !deleted || ordered {
+		return false, nil
+	}
+
+	for _, query := range []string{
+		"DELETE FROM cart_items WHERE product_id = ?",
+		"DELETE FROM wishlist_items WHERE product_id = ?",
+		"DELETE FROM reviews WHERE product_id = ?",
+		"DELETE FROM product_attributes WHERE product_id = ?",
+		"DELETE FROM product_variant_options WHERE variant_id IN (SELECT id FROM product_variants WHERE product_id = ?)",
+		"DELETE FROM product_variants WHERE product_id = ?",
+		"DELETE FROM product_options WHERE product_id = ?",
+		"DELETE FROM product_images WHERE product_id = ?",
+		"DELETE FROM product_price_history WHERE product_id = ?",
+		"DELETE FROM price_schedules WHERE product_id = ?",
+		"DELETE FROM products WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// DecreaseStockWithTransaction reserves quantity units of a product. Products without
+// tracked stock always succeed, it returns false when not enough units are left.
+func (u *ProductRepository) DecreaseStockWithTransaction(ctx context.Context, tx *sql.Tx, id int, quantity int) (bool, error) {
+
+	result, err := tx.ExecContext(ctx, "UPDATE products SET stock = CASE WHEN stock IS NULL THEN NULL ELSE stock - ? END WHERE id = ? AND (stock IS NULL OR stock >= ?)", quantity, id, quantity)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// IncreaseStockWithTransaction puts quantity units back in stock when the product's stock is tracked.
+func (u *ProductRepository) IncreaseStockWithTransaction(ctx context.Context, tx *sql.Tx, id int, quantity int) error {
+
+	_, err := tx.ExecContext(ctx, "UPDATE products SET stock = stock + ?, updated_at = ? WHERE id = ? AND stock IS NOT NULL", quantity, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
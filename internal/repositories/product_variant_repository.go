@@ -0,0 +1,339 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type ProductVariantRepository struct {
+	db *sql.DB
+}
+
+func NewProductVariantRepository(db *sql.DB) *ProductVariantRepository {
+	return &ProductVariantRepository{db: db}
+}
+
+const variantColumns = "id, product_id, sku, price, stock, created_at, updated_at"
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func (v *ProductVariantRepository) GetOptionsByProductID(ctx context.Context, productID int) ([]entity.ProductOption, error) {
+
+	rows, err := v.db.QueryContext(ctx, "SELECT id, product_id, name, option_values, position FROM product_options WHERE product_id = ? ORDER BY position, id", productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var options []entity.ProductOption
+	for rows.Next() {
+		var option entity.ProductOption
+		var values string
+		if err := rows.Scan(&option.ID, &option.ProductID, &option.Name, &values, &option.Position); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(values), &option.Values); err != nil {
+			return nil, err
+		}
+
+		options = append(options, option)
+	}
+
+	return options, rows.Err()
+}
+
+// ReplaceOptions replaces the option definitions of the product.
+func (v *ProductVariantRepository) ReplaceOptions(ctx context.Context, productID int, options []entity.ProductOption) error {
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM product_options WHERE product_id = ?", productID); err != nil {
+		return err
+	}
+
+	for i, option := range options {
+		values, err := json.Marshal(option.Values)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO product_options (product_id, name, option_values, position) VALUES (?, ?, ?, ?)", productID, option.Name, string(values), i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (v *ProductVariantRepository) GetVariantsByProductID(ctx context.Context, productID int) ([]*entity.ProductVariant, error) {
+	return getVariants(ctx, v.db, "SELECT "+variantColumns+" FROM product_variants WHERE product_id = ? ORDER BY id", productID)
+}
+
+func (v *ProductVariantRepository) GetVariantByID(ctx context.Context, id int) (*entity.ProductVariant, error) {
+	return firstVariant(getVariants(ctx, v.db, "SELECT "+variantColumns+" FROM product_variants WHERE id = ?", id))
+}
+
+func (v *ProductVariantRepository) GetVariantBySKU(ctx context.Context, sku string) (*entity.ProductVariant, error) {
+	return firstVariant(getVariants(ctx, v.db, "SELECT "+variantColumns+" FROM product_variants WHERE sku = ?", sku))
+}
+
+// HasVariants reports whether the product is sold by variant.
+func (v *ProductVariantRepository) HasVariants(ctx context.Context, productID int) (bool, error) {
+
+	var exists bool
+	err := v.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)", productID).Scan(&exists)
+	return exists, err
+}
+
+func (v *ProductVariantRepository) StoreVariant(ctx context.Context, variant *entity.ProductVariant) (*entity.ProductVariant, error) {
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	tNow := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, "INSERT INTO product_variants (product_id, sku, price, stock, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", variant.ProductID, variant.SKU, variant.Price, variant.Stock, tNow, tNow)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	variant.ID = int(id)
+	variant.CreatedAt = tNow
+	variant.UpdatedAt = tNow
+
+	if err := storeVariantOptions(ctx, tx, variant); err != nil {
+		return nil, err
+	}
+
+	return variant, tx.Commit()
+}
+
+// UpdateVariant saves the variant with its options. The stock is only written
+// with setStock, so that the units reserved by orders meanwhile are kept.
+func (v *ProductVariantRepository) UpdateVariant(ctx context.Context, variant *entity.ProductVariant, setStock bool) error {
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE product_variants SET sku = ?, price = ?, updated_at = ? WHERE id = ?", variant.SKU, variant.Price, time.Now().UTC(), variant.ID)
+	if err != nil {
+		return err
+	}
+
+	if setStock {
+		if _, err := tx.ExecContext(ctx, "UPDATE product_variants SET stock = ? WHERE id = ?", variant.Stock, variant.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM product_variant_options WHERE variant_id = ?", variant.ID); err != nil {
+		return err
+	}
+
+	if err := storeVariantOptions(ctx, tx, variant); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteVariant removes the variant and the cart and wishlist items referencing it. It returns
+// false without deleting when the variant was ordered.
+func (v *ProductVariantRepository) DeleteVariant(ctx context.Context, id int) (bool, error) {
+
+	tx, err := v.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var ordered bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM order_details WHERE variant_id = ?)", id).Scan(&ordered); err != nil {
+		return false, err
+	}
+
+	if ordered {
+		return false, nil
+	}
+
+	for _, query := range []string{
+		"DELETE FROM cart_items WHERE variant_id = ?",
+		"DELETE FROM wishlist_items WHERE variant_id = ?",
+		"DELETE FROM product_variant_options WHERE variant_id = ?",
+		"DELETE FROM product_variants WHERE id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// DecreaseStockWithTransaction reserves quantity units of a variant like
+// ProductRepository.DecreaseStockWithTransaction.
+func (v *ProductVariantRepository) DecreaseStockWithTransaction(ctx context.Context, tx *sql.Tx, id int, quantity int) (bool, error) {
+
+	result, err := tx.ExecContext(ctx, "UPDATE product_variants SET stock = CASE WHEN stock IS NULL THEN NULL ELSE stock - ? END WHERE id = ? AND (stock IS NULL OR stock >= ?)", quantity, id, quantity)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// IncreaseStockWithTransaction puts quantity units back in stock when the variant's stock is tracked.
+func (v *ProductVariantRepository) IncreaseStockWithTransaction(ctx context.Context, tx *sql.Tx, id int, quantity int) error {
+
+	_, err := tx.ExecContext(ctx, "UPDATE product_variants SET stock = stock + ?, updated_at = ? WHERE id = ? AND stock IS NOT NULL", quantity, time.Now().UTC(), id)
+	return err
+}
+
+func storeVariantOptions(ctx context.Context, tx *sql.Tx, variant *entity.ProductVariant) error {
+
+	for name, value := range variant.Options {
+		_, err := tx.ExecContext(ctx, "INSERT INTO product_variant_options (variant_id, name, value) VALUES (?, ?, ?)", variant.ID, name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getVariants loads the variants selected by query with their option values.
+func getVariants(ctx context.Context, db queryer, query string, args ...any) ([]*entity.ProductVariant, error) {
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []*entity.ProductVariant
+	byID := make(map[int]*entity.ProductVariant)
+	for rows.Next() {
+		variant := entity.ProductVariant{Options: map[string]string{}}
+		if err := rows.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &variant.Price, &variant.Stock, &variant.CreatedAt, &variant.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		variants = append(variants, &variant)
+		byID[variant.ID] = &variant
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(variants) == 0 {
+		return variants, nil
+	}
+
+	ids := make([]any, 0, len(variants))
+	for _, variant := range variants {
+		ids = append(ids, variant.ID)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT variant_id, name, value FROM product_variant_options WHERE variant_id IN ("+placeholders(len(ids))+")", ids...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variantID int
+		var name, value string
+		if err := rows.Scan(&variantID, &name, &value); err != nil {
+			return nil, err
+		}
+
+		byID[variantID].Options[name] = value
+	}
+
+	return variants, rows.Err()
+}
+
+// getVariantsByIDs returns the variants with the given ids by id.
+func getVariantsByIDs(ctx context.Context, db queryer, ids []int) (map[int]*entity.ProductVariant, error) {
+
+	variants := make(map[int]*entity.ProductVariant)
+	if len(ids) == 0 {
+		return variants, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	list, err := getVariants(ctx, db, "SELECT "+variantColumns+" FROM product_variants WHERE id IN ("+placeholders(len(ids))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, variant := range list {
+		variants[variant.ID] = variant
+	}
+
+	return variants, nil
+}
+
+func firstVariant(variants []*entity.ProductVariant, err error) (*entity.ProductVariant, error) {
+	if err != nil || len(variants) == 0 {
+		return nil, err
+	}
+	return variants[0], nil
+}
+
+// attachVariants sets the variant of the cart items that reference one.
+func attachVariants(ctx context.Context, db queryer, cartItems []*entity.CartItem) error {
+
+	var ids []int
+	for _, item := range cartItems {
+		if item.VariantID != 0 {
+			ids = append(ids, item.VariantID)
+		}
+	}
+
+	variants, err := getVariantsByIDs(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range cartItems {
+		if variant, ok := variants[item.VariantID]; ok {
+			item.Variant = variant
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/aldotp/OnlineStore/internal/replica"
+)
+
+// readStmts holds a statement cache per database for the read-only queries of a
+// repository that may run on a read replica.
+type readStmts struct {
+	primary *stmtCache
+	router  *replica.Router
+	mu      sync.Mutex
+	caches  map[*sql.DB]*stmtCache
+}
+
+// newReadStmts routes the reads with router, a nil router keeps them on the
+// primary.
+func newReadStmts(primary *stmtCache, router *replica.Router) *readStmts {
+	return &readStmts{
+		primary: primary,
+		router:  router,
+		caches:  map[*sql.DB]*stmtCache{primary.db: primary},
+	}
+}
+
+// reader returns the statement cache of the database of a read made with ctx.
+// Queries that are not cached run on its db.
+func (r *readStmts) reader(ctx context.Context) *stmtCache {
+
+	if r.router == nil {
+		return r.primary
+	}
+
+	db := r.router.Reader(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cache, ok := r.caches[db]
+	if !ok {
+		cache = newStmtCache(db)
+		r.caches[db] = cache
+	}
+
+	return cache
+}
@@ -0,0 +1,294 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+// unpaidStatusesSQL lists the statuses of the orders not counted as sales, the
+// pending orders were never paid and the cancelled ones were refunded.
+const unpaidStatusesSQL = "('" + entity.OrderStatusPending + "', '" + entity.OrderStatusCancelled + "')"
+
+// dateLayout formats the DATE columns, days are passed as text so that they
+// are not shifted by the time zone of the connection.
+const dateLayout = "2006-01-02"
+
+type ReportRepository struct {
+	db *sql.DB
+}
+
+func NewReportRepository(db *sql.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// ComputeSalesDay aggregates the orders placed from start until end. Customers
+// are returning when they placed an order before start. The refunds of returns
+// are taken off the revenue of the day of their order.
+func (r *ReportRepository) ComputeSalesDay(ctx context.Context, start, end time.Time) (*entity.SalesDay, []entity.ProductSales, error) {
+
+	var day entity.SalesDay
+	var customers, returning int
+	row := r.db.QueryRowContext(
+		ctx,
+		`SELECT COUNT(*), COALESCE(SUM(o.total_amount), 0), COUNT(DISTINCT o.user_id),
+			COUNT(DISTINCT CASE WHEN EXISTS (SELECT 1 FROM orders e WHERE e.user_id = o.user_id AND e.created_at < ? AND e.status NOT IN `+unpaidStatusesSQL+`) THEN o.user_id END)
+		FROM orders o WHERE o.created_at >= ? AND o.created_at < ? AND o.status NOT IN `+unpaidStatusesSQL,
+		start,
+		start,
+		end,
+	)
+	if err := row.Scan(&day.Orders, &day.Revenue, &customers, &returning); err != nil {
+		return nil, nil, err
+	}
+
+	day.NewCustomers = customers - returning
+	day.ReturningCustomers = returning
+
+	var refunded float64
+	row = r.db.QueryRowContext(
+		ctx,
+		`SELECT COALESCE(SUM(f.amount), 0) FROM refunds f JOIN orders o ON o.id = f.order_id
+		WHERE o.created_at >= ? AND o.created_at < ? AND o.status NOT IN `+unpaidStatusesSQL,
+		start,
+		end,
+	)
+	if err := row.Scan(&refunded); err != nil {
+		return nil, nil, err
+	}
+
+	day.Revenue -= refunded
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT d.product_id, SUM(d.quantity), SUM(d.quantity * d.price)
+		FROM order_details d
+		JOIN orders o ON o.id = d.order_id
+		WHERE o.created_at >= ? AND o.created_at < ? AND d.product_id IS NOT NULL AND o.status NOT IN `+unpaidStatusesSQL+`
+		GROUP BY d.product_id`,
+		start,
+		end,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var products []entity.ProductSales
+	for rows.Next() {
+		var product entity.ProductSales
+		if err := rows.Scan(&product.ProductID, &product.Units, &product.Revenue); err != nil {
+			return nil, nil, err
+		}
+
+		day.Units += product.Units
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return &day, products, nil
+}
+
+// StoreSalesDay replaces the rollups of the day in one transaction.
+func (r *ReportRepository) StoreSalesDay(ctx context.Context, day *entity.SalesDay, products []entity.ProductSales) error {
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	date := day.Day.Format(dateLayout)
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO sales_daily (timezone, day, orders, revenue, units, new_customers, returning_customers, final, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE orders = VALUES(orders), revenue = VALUES(revenue), units = VALUES(units), new_customers = VALUES(new_customers),
+			returning_customers = VALUES(returning_customers), final = VALUES(final), updated_at = VALUES(updated_at)`,
+		day.Timezone, date, day.Orders, day.Revenue, day.Units, day.NewCustomers, day.ReturningCustomers, day.Final, time.Now().UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sales_daily_products WHERE timezone = ? AND day = ?", day.Timezone, date); err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		_, err := tx.ExecContext(ctx, "INSERT INTO sales_daily_products (timezone, day, product_id, units, revenue) VALUES (?, ?, ?, ?, ?)", day.Timezone, date, product.ProductID, product.Units, product.Revenue)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReopenSalesDays marks the days around placedAt as open in every timezone, so
+// that the rollups are computed again after the status of an order changed or
+// it was refunded.
+func (r *ReportRepository) ReopenSalesDays(ctx context.Context, placedAt time.Time) error {
+
+	day := placedAt.UTC()
+	_, err := r.db.ExecContext(ctx, "UPDATE sales_daily SET final = FALSE WHERE day >= ? AND day <= ?", day.AddDate(0, 0, -1).Format(dateLayout), day.AddDate(0, 0, 1).Format(dateLayout))
+	return err
+}
+
+// GetSalesDays returns the rollups of the days from from to to, both included,
+// by day. Days that were not rolled up yet are missing.
+func (r *ReportRepository) GetSalesDays(ctx context.Context, timezone string, from, to time.Time) ([]entity.SalesDay, error) {
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT timezone, DATE_FORMAT(day, '%Y-%m-%d'), orders, revenue, units, new_customers, returning_customers, final FROM sales_daily WHERE timezone = ? AND day >= ? AND day <= ? ORDER BY day",
+		timezone,
+		from.Format(dateLayout),
+		to.Format(dateLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []entity.SalesDay
+	for rows.Next() {
+		var day entity.SalesDay
+		var date string
+		if err := rows.Scan(&day.Timezone, &date, &day.Orders, &day.Revenue, &day.Units, &day.NewCustomers, &day.ReturningCustomers, &day.Final); err != nil {
+			return nil, err
+		}
+
+		day.Day, err = time.Parse(dateLayout, date)
+		if err != nil {
+			return nil, err
+		}
+
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
+
+// GetOpenSalesDays returns the days of the timezone rolled up before they ended.
+func (r *ReportRepository) GetOpenSalesDays(ctx context.Context, timezone string) ([]time.Time, error) {
+
+	rows, err := r.db.QueryContext(ctx, "SELECT DATE_FORMAT(day, '%Y-%m-%d') FROM sales_daily WHERE timezone = ? AND final = FALSE ORDER BY day", timezone)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+
+		day, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return nil, err
+		}
+
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
+
+// GetLastSalesDay returns the last day of the timezone rolled up, nil when none is.
+func (r *ReportRepository) GetLastSalesDay(ctx context.Context, timezone string) (*time.Time, error) {
+
+	var date sql.NullString
+	if err := r.db.QueryRowContext(ctx, "SELECT DATE_FORMAT(MAX(day), '%Y-%m-%d') FROM sales_daily WHERE timezone = ?", timezone).Scan(&date); err != nil {
+		return nil, err
+	}
+
+	if !date.Valid {
+		return nil, nil
+	}
+
+	day, err := time.Parse(dateLayout, date.String)
+	if err != nil {
+		return nil, err
+	}
+
+	return &day, nil
+}
+
+// GetFirstOrderTime returns when the first sale was made, nil without sales.
+func (r *ReportRepository) GetFirstOrderTime(ctx context.Context) (*time.Time, error) {
+
+	var first sql.NullTime
+	if err := r.db.QueryRowContext(ctx, "SELECT MIN(o.created_at) FROM orders o WHERE o.status NOT IN "+unpaidStatusesSQL).Scan(&first); err != nil {
+		return nil, err
+	}
+
+	if !first.Valid {
+		return nil, nil
+	}
+
+	return &first.Time, nil
+}
+
+// GetTopProducts ranks the products sold from from to to, both included, by
+// revenue, or by units with byUnits.
+func (r *ReportRepository) GetTopProducts(ctx context.Context, timezone string, from, to time.Time, byUnits bool, limit int) ([]entity.TopSeller, error) {
+
+	query := `SELECT s.product_id, COALESCE(p.name, ''), SUM(s.units) AS units, SUM(s.revenue) AS revenue
+		FROM sales_daily_products s
+		LEFT JOIN products p ON p.id = s.product_id
+		WHERE s.timezone = ? AND s.day >= ? AND s.day <= ?
+		GROUP BY s.product_id, p.name
+		ORDER BY ` + topSellerOrder(byUnits) + ` LIMIT ?`
+
+	return r.getTopSellers(ctx, query, timezone, from.Format(dateLayout), to.Format(dateLayout), limit)
+}
+
+// GetTopCategories ranks the categories by the sales of their products, from
+// from to to, both included. Products count in their current category.
+func (r *ReportRepository) GetTopCategories(ctx context.Context, timezone string, from, to time.Time, byUnits bool, limit int) ([]entity.TopSeller, error) {
+
+	query := `SELECT c.id, c.name, SUM(s.units) AS units, SUM(s.revenue) AS revenue
+		FROM sales_daily_products s
+		JOIN products p ON p.id = s.product_id
+		JOIN categories c ON c.id = p.category_id
+		WHERE s.timezone = ? AND s.day >= ? AND s.day <= ?
+		GROUP BY c.id, c.name
+		ORDER BY ` + topSellerOrder(byUnits) + ` LIMIT ?`
+
+	return r.getTopSellers(ctx, query, timezone, from.Format(dateLayout), to.Format(dateLayout), limit)
+}
+
+func topSellerOrder(byUnits bool) string {
+	if byUnits {
+		return "units DESC, revenue DESC, 1"
+	}
+	return "revenue DESC, units DESC, 1"
+}
+
+func (r *ReportRepository) getTopSellers(ctx context.Context, query string, args ...any) ([]entity.TopSeller, error) {
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sellers := []entity.TopSeller{}
+	for rows.Next() {
+		var seller entity.TopSeller
+		if err := rows.Scan(&seller.ID, &seller.Name, &seller.Units, &seller.Revenue); err != nil {
+			return nil, err
+		}
+
+		sellers = append(sellers, seller)
+	}
+
+	return sellers, rows.Err()
+}
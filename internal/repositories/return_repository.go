@@ -0,0 +1,309 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type ReturnRepository struct {
+	db *sql.DB
+}
+
+func NewReturnRepository(db *sql.DB) *ReturnRepository {
+	return &ReturnRepository{db: db}
+}
+
+const returnColumns = "id, order_id, user_id, status, reason, approved_amount, refunded_amount, received_at, created_at, updated_at"
+
+func scanReturn(row interface{ Scan(...any) error }, ret *entity.Return) error {
+	return row.Scan(&ret.ID, &ret.OrderID, &ret.UserID, &ret.Status, &ret.Reason, &ret.ApprovedAmount, &ret.RefundedAmount, &ret.ReceivedAt, &ret.CreatedAt, &ret.UpdatedAt)
+}
+
+func (r *ReturnRepository) BeginTransaction(ctx context.Context) (*sql.Tx, error) {
+	return r.db.BeginTx(ctx, nil)
+}
+
+// CreateReturnWithTransaction stores the return with its items and first
+// history entry.
+func (r *ReturnRepository) CreateReturnWithTransaction(ctx context.Context, tx *sql.Tx, ret *entity.Return, history *entity.ReturnHistory) (*entity.Return, error) {
+
+	tNow := time.Now().UTC()
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO returns (order_id, user_id, status, reason, approved_amount, refunded_amount, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		ret.OrderID, ret.UserID, ret.Status, ret.Reason, ret.ApprovedAmount, ret.RefundedAmount, tNow, tNow,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	ret.ID = int(id)
+	ret.CreatedAt = tNow
+	ret.UpdatedAt = tNow
+
+	for i := range ret.Items {
+		ret.Items[i].ReturnID = ret.ID
+		result, err := tx.ExecContext(ctx, "INSERT INTO return_items (return_id, order_detail_id, product_id, quantity, price) VALUES (?, ?, ?, ?, ?)", ret.ID, ret.Items[i].OrderDetailID, ret.Items[i].ProductID, ret.Items[i].Quantity, ret.Items[i].Price)
+		if err != nil {
+			return nil, err
+		}
+
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		ret.Items[i].ID = int(itemID)
+	}
+
+	history.ReturnID = ret.ID
+	if err := createReturnHistory(ctx, tx, history); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (r *ReturnRepository) GetReturnByID(ctx context.Context, id int) (*entity.Return, error) {
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+returnColumns+" FROM returns WHERE id = ?", id)
+	var ret entity.Return
+	err := scanReturn(row, &ret)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Items, err = getReturnItems(ctx, r.db, ret.ID); err != nil {
+		return nil, err
+	}
+
+	if ret.Refunds, err = r.getRefunds(ctx, ret.ID); err != nil {
+		return nil, err
+	}
+
+	if ret.History, err = r.getReturnHistory(ctx, ret.ID); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+func (r *ReturnRepository) GetReturnsByUserID(ctx context.Context, userID int) ([]entity.Return, error) {
+	return r.getReturns(ctx, "SELECT "+returnColumns+" FROM returns WHERE user_id = ? ORDER BY id DESC", userID)
+}
+
+// GetReturns lists all returns, optionally filtered by status.
+func (r *ReturnRepository) GetReturns(ctx context.Context, status string) ([]entity.Return, error) {
+
+	if status == "" {
+		return r.getReturns(ctx, "SELECT "+returnColumns+" FROM returns ORDER BY id DESC")
+	}
+
+	return r.getReturns(ctx, "SELECT "+returnColumns+" FROM returns WHERE status = ? ORDER BY id DESC", status)
+}
+
+// GetReturnedQuantitiesWithTransaction returns the quantity per order detail
+// already part of a return of the order that has not been rejected. The order
+// should be locked in tx so that no other return of it is created meanwhile.
+func (r *ReturnRepository) GetReturnedQuantitiesWithTransaction(ctx context.Context, tx *sql.Tx, orderID int) (map[int]int, error) {
+
+	rows, err := tx.QueryContext(ctx, "SELECT ri.order_detail_id, SUM(ri.quantity) FROM return_items ri JOIN returns rt ON rt.id = ri.return_id WHERE rt.order_id = ? AND rt.status <> ? GROUP BY ri.order_detail_id", orderID, entity.ReturnStatusRejected)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]int)
+	for rows.Next() {
+		var orderDetailID, quantity int
+		if err := rows.Scan(&orderDetailID, &quantity); err != nil {
+			return nil, err
+		}
+
+		quantities[orderDetailID] = quantity
+	}
+
+	return quantities, rows.Err()
+}
+
+// GetReturnForUpdateWithTransaction returns the return with its items and locks
+// it until the transaction ends, nil when it does not exist.
+func (r *ReturnRepository) GetReturnForUpdateWithTransaction(ctx context.Context, tx *sql.Tx, id int) (*entity.Return, error) {
+
+	row := tx.QueryRowContext(ctx, "SELECT "+returnColumns+" FROM returns WHERE id = ? FOR UPDATE", id)
+	var ret entity.Return
+	err := scanReturn(row, &ret)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Items, err = getReturnItems(ctx, tx, ret.ID); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// UpdateReturnWithTransaction saves the status and amounts of the return and
+// appends a history entry.
+func (r *ReturnRepository) UpdateReturnWithTransaction(ctx context.Context, tx *sql.Tx, ret *entity.Return, history *entity.ReturnHistory) error {
+
+	if err := updateReturn(ctx, tx, ret); err != nil {
+		return err
+	}
+
+	return createReturnHistory(ctx, tx, history)
+}
+
+// CreateRefundWithTransaction records a refund issued for the return together
+// with the updated return.
+func (r *ReturnRepository) CreateRefundWithTransaction(ctx context.Context, tx *sql.Tx, refund *entity.Refund, ret *entity.Return, history *entity.ReturnHistory) error {
+
+	tNow := time.Now().UTC()
+	result, err := tx.ExecContext(ctx, "INSERT INTO refunds (return_id, order_id, amount, status, created_at) VALUES (?, ?, ?, ?, ?)", refund.ReturnID, refund.OrderID, refund.Amount, refund.Status, tNow)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	refund.ID = int(id)
+	refund.CreatedAt = tNow
+
+	return r.UpdateReturnWithTransaction(ctx, tx, ret, history)
+}
+
+func (r *ReturnRepository) getReturns(ctx context.Context, query string, args ...any) ([]entity.Return, error) {
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var returns []entity.Return
+	for rows.Next() {
+		var ret entity.Return
+		if err := scanReturn(rows, &ret); err != nil {
+			return nil, err
+		}
+
+		returns = append(returns, ret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range returns {
+		if returns[i].Items, err = getReturnItems(ctx, r.db, returns[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return returns, nil
+}
+
+func getReturnItems(ctx context.Context, db queryer, returnID int) ([]entity.ReturnItem, error) {
+
+	rows, err := db.QueryContext(ctx, "SELECT id, return_id, order_detail_id, product_id, quantity, price FROM return_items WHERE return_id = ?", returnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []entity.ReturnItem
+	for rows.Next() {
+		var item entity.ReturnItem
+		if err := rows.Scan(&item.ID, &item.ReturnID, &item.OrderDetailID, &item.ProductID, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (r *ReturnRepository) getRefunds(ctx context.Context, returnID int) ([]entity.Refund, error) {
+
+	rows, err := r.db.QueryContext(ctx, "SELECT id, return_id, order_id, amount, status, created_at FROM refunds WHERE return_id = ? ORDER BY id", returnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []entity.Refund
+	for rows.Next() {
+		var refund entity.Refund
+		if err := rows.Scan(&refund.ID, &refund.ReturnID, &refund.OrderID, &refund.Amount, &refund.Status, &refund.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, rows.Err()
+}
+
+func (r *ReturnRepository) getReturnHistory(ctx context.Context, returnID int) ([]entity.ReturnHistory, error) {
+
+	rows, err := r.db.QueryContext(ctx, "SELECT id, return_id, order_id, action, note, amount, actor_id, created_at FROM return_history WHERE return_id = ? ORDER BY id", returnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []entity.ReturnHistory
+	for rows.Next() {
+		var entry entity.ReturnHistory
+		if err := rows.Scan(&entry.ID, &entry.ReturnID, &entry.OrderID, &entry.Action, &entry.Note, &entry.Amount, &entry.ActorID, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
+
+func updateReturn(ctx context.Context, tx *sql.Tx, ret *entity.Return) error {
+
+	ret.UpdatedAt = time.Now().UTC()
+	_, err := tx.ExecContext(ctx, "UPDATE returns SET status = ?, approved_amount = ?, refunded_amount = ?, received_at = ?, updated_at = ? WHERE id = ?", ret.Status, ret.ApprovedAmount, ret.RefundedAmount, ret.ReceivedAt, ret.UpdatedAt, ret.ID)
+	return err
+}
+
+func createReturnHistory(ctx context.Context, tx *sql.Tx, history *entity.ReturnHistory) error {
+
+	history.CreatedAt = time.Now().UTC()
+	result, err := tx.ExecContext(ctx, "INSERT INTO return_history (return_id, order_id, action, note, amount, actor_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)", history.ReturnID, history.OrderID, history.Action, history.Note, history.Amount, history.ActorID, history.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	history.ID = int(id)
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type ReviewRepository struct {
+	db *sql.DB
+}
+
+func NewReviewRepository(db *sql.DB) *ReviewRepository {
+	return &ReviewRepository{db: db}
+}
+
+const reviewColumns = "r.id, r.product_id, r.user_id, u.username, r.rating, r.title, r.body, r.verified, r.status, r.created_at, r.updated_at"
+
+func scanReview(row interface{ Scan(...any) error }, review *entity.Review) error {
+	return row.Scan(&review.ID, &review.ProductID, &review.UserID, &review.Username, &review.Rating, &review.Title, &review.Body, &review.Verified, &review.Status, &review.CreatedAt, &review.UpdatedAt)
+}
+
+func (r *ReviewRepository) getReviews(ctx context.Context, where string, args ...any) ([]*entity.Review, error) {
+
+	rows, err := r.db.QueryContext(ctx, "SELECT "+reviewColumns+" FROM reviews r JOIN users u ON u.id = r.user_id WHERE "+where+" ORDER BY r.created_at DESC, r.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []*entity.Review
+	for rows.Next() {
+		var review entity.Review
+		if err := scanReview(rows, &review); err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	return reviews, rows.Err()
+}
+
+func (r *ReviewRepository) GetReviewsByProductID(ctx context.Context, productID int, status string) ([]*entity.Review, error) {
+	return r.getReviews(ctx, "r.product_id = ? AND r.status = ?", productID, status)
+}
+
+// GetReviews returns the reviews of all products, filtered by status when it is not empty.
+func (r *ReviewRepository) GetReviews(ctx context.Context, status string) ([]*entity.Review, error) {
+	if status == "" {
+		return r.getReviews(ctx, "1 = 1")
+	}
+	return r.getReviews(ctx, "r.status = ?", status)
+}
+
+func (r *ReviewRepository) GetReviewByID(ctx context.Context, id int) (*entity.Review, error) {
+	return r.getReview(ctx, "r.id = ?", id)
+}
+
+func (r *ReviewRepository) GetReviewByUserAndProduct(ctx context.Context, userID, productID int) (*entity.Review, error) {
+	return r.getReview(ctx, "r.user_id = ? AND r.product_id = ?", userID, productID)
+}
+
+func (r *ReviewRepository) getReview(ctx context.Context, where string, args ...any) (*entity.Review, error) {
+
+	row := r.db.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM reviews r JOIN users u ON u.id = r.user_id WHERE "+where, args...)
+
+	var review entity.Review
+	err := scanReview(row, &review)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (r *ReviewRepository) StoreReview(ctx context.Context, review *entity.Review) (*entity.Review, error) {
+
+	tNow := time.Now().UTC()
+	result, err := r.db.ExecContext(
+		ctx,
+		"INSERT INTO reviews (product_id, user_id, rating, title, body, verified, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		review.ProductID,
+		review.UserID,
+		review.Rating,
+		review.Title,
+		review.Body,
+		review.Verified,
+		review.Status,
+		tNow,
+		tNow,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetReviewByID(ctx, int(id))
+}
+
+func (r *ReviewRepository) UpdateReview(ctx context.Context, review *entity.Review) error {
+
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE reviews SET rating = ?, title = ?, body = ?, verified = ?, status = ?, updated_at = ? WHERE id = ?",
+		review.Rating,
+		review.Title,
+		review.Body,
+		review.Verified,
+		review.Status,
+		time.Now().UTC(),
+		review.ID,
+	)
+	return err
+}
+
+func (r *ReviewRepository) UpdateReviewStatus(ctx context.Context, id int, status string) error {
+
+	_, err := r.db.ExecContext(ctx, "UPDATE reviews SET status = ?, updated_at = ? WHERE id = ?", status, time.Now().UTC(), id)
+	return err
+}
+
+func (r *ReviewRepository) DeleteReview(ctx context.Context, id int) error {
+
+	_, err := r.db.ExecContext(ctx, "DELETE FROM reviews WHERE id = ?", id)
+	return err
+}
+
+// HasPurchased reports whether the user has an order in one of the statuses that contains the product.
+func (r *ReviewRepository) HasPurchased(ctx context.Context, userID, productID int, statuses ...string) (bool, error) {
+
+	args := []any{userID, productID}
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+
+	var exists bool
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT EXISTS (SELECT 1 FROM order_details od JOIN orders o ON o.id = od.order_id WHERE o.user_id = ? AND od.product_id = ? AND o.status IN ("+placeholders(len(statuses))+"))",
+		args...,
+	).Scan(&exists)
+
+	return exists, err
+}
+
+// GetRatingSummaries returns the average rating and count of the approved reviews of the products.
+func (r *ReviewRepository) GetRatingSummaries(ctx context.Context, productIDs ...int) (map[int]entity.RatingSummary, error) {
+
+	summaries := make(map[int]entity.RatingSummary, len(productIDs))
+	if len(productIDs) == 0 {
+		return summaries, nil
+	}
+
+	args := []any{entity.ReviewStatusApproved}
+	for _, id := range productIDs {
+		args = append(args, id)
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT product_id, AVG(rating), COUNT(*) FROM reviews WHERE status = ? AND product_id IN ("+placeholders(len(productIDs))+") GROUP BY product_id",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var summary entity.RatingSummary
+		if err := rows.Scan(&productID, &summary.Average, &summary.Count); err != nil {
+			return nil, err
+		}
+
+		summaries[productID] = summary
+	}
+
+	return summaries, rows.Err()
+}
@@ -0,0 +1,236 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type ShipmentRepository struct {
+	db *sql.DB
+}
+
+func NewShipmentRepository(db *sql.DB) *ShipmentRepository {
+	return &ShipmentRepository{db: db}
+}
+
+func (s *ShipmentRepository) CreateShipmentWithTransaction(ctx context.Context, tx *sql.Tx, shipment *entity.Shipment) (*entity.Shipment, error) {
+
+	tNow := time.Now().UTC()
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO shipments (order_id, carrier_code, tracking_number, status, shipped_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		shipment.OrderID, shipment.CarrierCode, shipment.TrackingNumber, shipment.Status, tNow, tNow, tNow,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	shipment.ID = int(id)
+	shipment.ShippedAt = tNow
+	shipment.CreatedAt = tNow
+	shipment.UpdatedAt = tNow
+
+	for i := range shipment.Items {
+		shipment.Items[i].ShipmentID = shipment.ID
+		result, err := tx.ExecContext(ctx, "INSERT INTO shipment_items (shipment_id, order_detail_id, quantity) VALUES (?, ?, ?)", shipment.ID, shipment.Items[i].OrderDetailID, shipment.Items[i].Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		itemID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		shipment.Items[i].ID = int(itemID)
+	}
+
+	return shipment, nil
+}
+
+func (s *ShipmentRepository) GetShipmentsByOrderID(ctx context.Context, orderID int) ([]entity.Shipment, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, order_id, carrier_code, tracking_number, status, shipped_at, delivered_at, created_at, updated_at FROM shipments WHERE order_id = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shipments []entity.Shipment
+	for rows.Next() {
+		var shipment entity.Shipment
+		err := rows.Scan(&shipment.ID, &shipment.OrderID, &shipment.CarrierCode, &shipment.TrackingNumber, &shipment.Status, &shipment.ShippedAt, &shipment.DeliveredAt, &shipment.CreatedAt, &shipment.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		shipments = append(shipments, shipment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range shipments {
+		items, err := s.getShipmentItems(ctx, shipments[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		events, err := s.getShipmentEvents(ctx, shipments[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		shipments[i].Items = items
+		shipments[i].Events = events
+	}
+
+	return shipments, nil
+}
+
+func (s *ShipmentRepository) GetShipmentByTrackingNumber(ctx context.Context, carrierCode, trackingNumber string) (*entity.Shipment, error) {
+
+	row := s.db.QueryRowContext(ctx, "SELECT id, order_id, carrier_code, tracking_number, status, shipped_at, delivered_at, created_at, updated_at FROM shipments WHERE carrier_code = ? AND tracking_number = ?", carrierCode, trackingNumber)
+	var shipment entity.Shipment
+	err := row.Scan(&shipment.ID, &shipment.OrderID, &shipment.CarrierCode, &shipment.TrackingNumber, &shipment.Status, &shipment.ShippedAt, &shipment.DeliveredAt, &shipment.CreatedAt, &shipment.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &shipment, nil
+}
+
+// GetShippedQuantities returns the quantity already shipped per order detail of an order.
+// Only shipments with the given statuses are counted, all shipments when none are given.
+func (s *ShipmentRepository) GetShippedQuantities(ctx context.Context, orderID int, statuses ...string) (map[int]int, error) {
+	return getShippedQuantities(ctx, s.db, orderID, statuses...)
+}
+
+// GetShippedQuantitiesWithTransaction is GetShippedQuantities within tx, to be
+// read after locking the order.
+func (s *ShipmentRepository) GetShippedQuantitiesWithTransaction(ctx context.Context, tx *sql.Tx, orderID int, statuses ...string) (map[int]int, error) {
+	return getShippedQuantities(ctx, tx, orderID, statuses...)
+}
+
+func getShippedQuantities(ctx context.Context, db queryer, orderID int, statuses ...string) (map[int]int, error) {
+
+	query := "SELECT si.order_detail_id, SUM(si.quantity) FROM shipment_items si JOIN shipments s ON s.id = si.shipment_id WHERE s.order_id = ?"
+	args := []any{orderID}
+	if len(statuses) > 0 {
+		query += " AND s.status IN (" + placeholders(len(statuses)) + ")"
+		for _, status := range statuses {
+			args = append(args, status)
+		}
+	}
+	query += " GROUP BY si.order_detail_id"
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]int)
+	for rows.Next() {
+		var orderDetailID, quantity int
+		if err := rows.Scan(&orderDetailID, &quantity); err != nil {
+			return nil, err
+		}
+
+		quantities[orderDetailID] = quantity
+	}
+
+	return quantities, rows.Err()
+}
+
+// UpdateShipmentStatus records a carrier event and moves the shipment to its
+// status. An event older than the latest recorded one is only recorded, the
+// shipment keeps its status and false is returned.
+func (s *ShipmentRepository) UpdateShipmentStatus(ctx context.Context, shipment *entity.Shipment, event *entity.ShipmentEvent) (bool, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// the lock orders the concurrent events of the shipment
+	var locked int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM shipments WHERE id = ? FOR UPDATE", shipment.ID).Scan(&locked); err != nil {
+		return false, err
+	}
+
+	var latest sql.NullTime
+	if err := tx.QueryRowContext(ctx, "SELECT MAX(occurred_at) FROM shipment_events WHERE shipment_id = ?", shipment.ID).Scan(&latest); err != nil {
+		return false, err
+	}
+
+	tNow := time.Now().UTC()
+	_, err = tx.ExecContext(ctx, "INSERT INTO shipment_events (shipment_id, status, description, occurred_at, created_at) VALUES (?, ?, ?, ?, ?)", shipment.ID, event.Status, event.Description, event.OccurredAt, tNow)
+	if err != nil {
+		return false, err
+	}
+
+	applied := !latest.Valid || !event.OccurredAt.Before(latest.Time)
+	if applied {
+		_, err = tx.ExecContext(ctx, "UPDATE shipments SET status = ?, delivered_at = ?, updated_at = ? WHERE id = ?", shipment.Status, shipment.DeliveredAt, tNow, shipment.ID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return applied, tx.Commit()
+}
+
+func (s *ShipmentRepository) getShipmentItems(ctx context.Context, shipmentID int) ([]entity.ShipmentItem, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, shipment_id, order_detail_id, quantity FROM shipment_items WHERE shipment_id = ?", shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []entity.ShipmentItem
+	for rows.Next() {
+		var item entity.ShipmentItem
+		if err := rows.Scan(&item.ID, &item.ShipmentID, &item.OrderDetailID, &item.Quantity); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *ShipmentRepository) getShipmentEvents(ctx context.Context, shipmentID int) ([]entity.ShipmentEvent, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, shipment_id, status, description, occurred_at, created_at FROM shipment_events WHERE shipment_id = ? ORDER BY occurred_at", shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entity.ShipmentEvent
+	for rows.Next() {
+		var event entity.ShipmentEvent
+		if err := rows.Scan(&event.ID, &event.ShipmentID, &event.Status, &event.Description, &event.OccurredAt, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
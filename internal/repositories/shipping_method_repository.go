@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type ShippingMethodRepository struct {
+	db *sql.DB
+}
+
+func NewShippingMethodRepository(db *sql.DB) *ShippingMethodRepository {
+	return &ShippingMethodRepository{db: db}
+}
+
+func (s *ShippingMethodRepository) GetActiveShippingMethods(ctx context.Context) ([]entity.ShippingMethod, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, code, name, type, base_rate, rate_per_kg, free_threshold, countries, active, created_at, updated_at FROM shipping_methods WHERE active = TRUE ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var methods []entity.ShippingMethod
+	for rows.Next() {
+		var method entity.ShippingMethod
+		err := rows.Scan(&method.ID, &method.Code, &method.Name, &method.Type, &method.BaseRate, &method.RatePerKg, &method.FreeThreshold, &method.Countries, &method.Active, &method.CreatedAt, &method.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		methods = append(methods, method)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return methods, nil
+}
+
+func (s *ShippingMethodRepository) GetShippingMethodByID(ctx context.Context, id int) (*entity.ShippingMethod, error) {
+
+	row := s.db.QueryRowContext(ctx, "SELECT id, code, name, type, base_rate, rate_per_kg, free_threshold, countries, active, created_at, updated_at FROM shipping_methods WHERE id = ?", id)
+	var method entity.ShippingMethod
+	err := row.Scan(&method.ID, &method.Code, &method.Name, &method.Type, &method.BaseRate, &method.RatePerKg, &method.FreeThreshold, &method.Countries, &method.Active, &method.CreatedAt, &method.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &method, nil
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// maxCachedStatements bounds the statements prepared by one repository, the
+// queries past it are run unprepared.
+const maxCachedStatements = 64
+
+// stmtCache prepares each query once and reuses the statement on every call,
+// sparing the driver a prepare and a close per query. database/sql prepares the
+// statement again on the connections it was not prepared on yet.
+//
+// Only queries with a fixed text belong in the cache, queries built with a
+// variable number of placeholders run on db.
+type stmtCache struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{
+		db:    db,
+		stmts: make(map[string]*sql.Stmt),
+	}
+}
+
+// stmt returns the statement of query, nil when it cannot be prepared or the
+// cache is full.
+func (c *stmtCache) stmt(ctx context.Context, query string) *sql.Stmt {
+
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	full := len(c.stmts) >= maxCachedStatements
+	c.mu.RUnlock()
+	if ok {
+		return stmt
+	}
+	if full {
+		return nil
+	}
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another call may have prepared it meanwhile
+	if cached, ok := c.stmts[query]; ok {
+		stmt.Close()
+		return cached
+	}
+
+	if len(c.stmts) >= maxCachedStatements {
+		stmt.Close()
+		return nil
+	}
+
+	c.stmts[query] = stmt
+	return stmt
+}
+
+// QueryContext runs query as a cached statement. A query that cannot be
+// prepared runs unprepared, returning its error.
+func (c *stmtCache) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if stmt := c.stmt(ctx, query); stmt != nil {
+		return stmt.QueryContext(ctx, args...)
+	}
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+func (c *stmtCache) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if stmt := c.stmt(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return c.db.QueryRowContext(ctx, query, args...)
+}
+
+func (c *stmtCache) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if stmt := c.stmt(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return c.db.ExecContext(ctx, query, args...)
+}
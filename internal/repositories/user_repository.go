@@ -16,11 +16,14 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-func (u UserRepository) GetUserByID(id int) (*entity.User, error) {
+func (u UserRepository) GetUserByID(ctx context.Context, id int) (*entity.User, error) {
 
-	row := u.db.QueryRow("SELECT id, username, password, email, created_at, updated_at FROM users WHERE id = ?", id)
+	row := u.db.QueryRowContext(ctx, "SELECT id, username, password, email, role, created_at, updated_at FROM users WHERE id = ?", id)
 	var user entity.User
-	if err := row.Scan(&user.ID, &user.Username, &user.Email); err != nil {
+	if err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
 
@@ -35,14 +38,14 @@ func (u UserRepository) CreateUser(ctx context.Context, cust entity.User) (*enti
 		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx, "INSERT INTO users (username, password, email, created_at, updated_at) VALUES (?, ?, ?, ?, ?)", cust.Username, cust.Password, cust.Email, time.Now().UTC(), time.Now().UTC())
+	_, err = tx.ExecContext(ctx, "INSERT INTO users (username, password, email, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", cust.Username, cust.Password, cust.Email, entity.RoleCustomer, time.Now().UTC(), time.Now().UTC())
 	if err != nil {
 		return nil, err
 	}
 
-	row := tx.QueryRowContext(ctx, "SELECT id, username, password, email, created_at, updated_at FROM users WHERE username = ?", cust.Username)
+	row := tx.QueryRowContext(ctx, "SELECT id, username, password, email, role, created_at, updated_at FROM users WHERE username = ?", cust.Username)
 	insertedUser := new(entity.User)
-	if err := row.Scan(&insertedUser.ID, &insertedUser.Username, &insertedUser.Password, &insertedUser.Email, &insertedUser.CreatedAt, &insertedUser.UpdatedAt); err != nil {
+	if err := row.Scan(&insertedUser.ID, &insertedUser.Username, &insertedUser.Password, &insertedUser.Email, &insertedUser.Role, &insertedUser.CreatedAt, &insertedUser.UpdatedAt); err != nil {
 		return nil, err
 	}
 
@@ -63,10 +66,10 @@ func (u UserRepository) CreateUser(ctx context.Context, cust entity.User) (*enti
 
 func (u UserRepository) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
 
-	row := u.db.QueryRowContext(ctx, "SELECT id, username, password, email, created_at, updated_at FROM users WHERE username = ?", username)
+	row := u.db.QueryRowContext(ctx, "SELECT id, username, password, email, role, created_at, updated_at FROM users WHERE username = ?", username)
 	var user entity.User
 
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -0,0 +1,286 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+)
+
+type WishlistRepository struct {
+	db *sql.DB
+}
+
+func NewWishlistRepository(db *sql.DB) *WishlistRepository {
+	return &WishlistRepository{db: db}
+}
+
+const wishlistColumns = "id, user_id, name, COALESCE(share_token, ''), created_at, updated_at"
+
+const wishlistItemColumns = "wi.id, wi.wishlist_id, wi.product_id, COALESCE(wi.variant_id, 0), wi.quantity, wi.price, wi.in_stock, wi.created_at, wi.updated_at, " + productColumns
+
+func scanWishlist(row interface{ Scan(...any) error }, wishlist *entity.Wishlist) error {
+	return row.Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.ShareToken, &wishlist.CreatedAt, &wishlist.UpdatedAt)
+}
+
+func scanWishlistItem(row interface{ Scan(...any) error }, item *entity.WishlistItem) error {
+	return row.Scan(wishlistItemFields(item)...)
+}
+
+func wishlistItemFields(item *entity.WishlistItem) []any {
+	return append([]any{&item.ID, &item.WishlistID, &item.ProductID, &item.VariantID, &item.Quantity, &item.Price, &item.InStock, &item.CreatedAt, &item.UpdatedAt}, productFields(&item.Product)...)
+}
+
+func (w *WishlistRepository) GetWishlistsByUserID(ctx context.Context, userID int) ([]*entity.Wishlist, error) {
+
+	rows, err := w.db.QueryContext(ctx, "SELECT "+wishlistColumns+" FROM wishlists WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wishlists []*entity.Wishlist
+	for rows.Next() {
+		var wishlist entity.Wishlist
+		if err := scanWishlist(rows, &wishlist); err != nil {
+			return nil, err
+		}
+
+		wishlists = append(wishlists, &wishlist)
+	}
+
+	return wishlists, rows.Err()
+}
+
+func (w *WishlistRepository) GetWishlistByID(ctx context.Context, id int) (*entity.Wishlist, error) {
+	return w.getWishlist(ctx, "SELECT "+wishlistColumns+" FROM wishlists WHERE id = ?", id)
+}
+
+func (w *WishlistRepository) GetWishlistByShareToken(ctx context.Context, token string) (*entity.Wishlist, error) {
+	return w.getWishlist(ctx, "SELECT "+wishlistColumns+" FROM wishlists WHERE share_token = ?", token)
+}
+
+func (w *WishlistRepository) GetWishlistByName(ctx context.Context, userID int, name string) (*entity.Wishlist, error) {
+	return w.getWishlist(ctx, "SELECT "+wishlistColumns+" FROM wishlists WHERE user_id = ? AND name = ?", userID, name)
+}
+
+func (w *WishlistRepository) getWishlist(ctx context.Context, query string, args ...any) (*entity.Wishlist, error) {
+
+	var wishlist entity.Wishlist
+	err := scanWishlist(w.db.QueryRowContext(ctx, query, args...), &wishlist)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &wishlist, nil
+}
+
+func (w *WishlistRepository) StoreWishlist(ctx context.Context, wishlist *entity.Wishlist) (*entity.Wishlist, error) {
+
+	tNow := time.Now().UTC()
+	result, err := w.db.ExecContext(
+		ctx,
+		"INSERT INTO wishlists (user_id, name, share_token, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		wishlist.UserID,
+		wishlist.Name,
+		nullString(wishlist.ShareToken),
+		tNow,
+		tNow,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	wishlist.ID = int(id)
+	wishlist.CreatedAt = tNow
+	wishlist.UpdatedAt = tNow
+
+	return wishlist, nil
+}
+
+func (w *WishlistRepository) UpdateWishlist(ctx context.Context, wishlist *entity.Wishlist) error {
+
+	_, err := w.db.ExecContext(ctx, "UPDATE wishlists SET name = ?, share_token = ?, updated_at = ? WHERE id = ?", wishlist.Name, nullString(wishlist.ShareToken), time.Now().UTC(), wishlist.ID)
+	return err
+}
+
+func (w *WishlistRepository) DeleteWishlist(ctx context.Context, id int) error {
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM wishlist_items WHERE wishlist_id = ?", id); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM wishlists WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetWishlistItems leaves out the products that were deleted.
+func (w *WishlistRepository) GetWishlistItems(ctx context.Context, wishlistID int) ([]*entity.WishlistItem, error) {
+
+	rows, err := w.db.QueryContext(ctx, "SELECT "+wishlistItemColumns+" FROM wishlist_items wi JOIN products p ON p.id = wi.product_id WHERE wi.wishlist_id = ? AND p.deleted_at IS NULL ORDER BY wi.id", wishlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*entity.WishlistItem
+	for rows.Next() {
+		var item entity.WishlistItem
+		if err := scanWishlistItem(rows, &item); err != nil {
+			return nil, err
+		}
+
+		items = append(items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, attachWishlistVariants(ctx, w.db, items)
+}
+
+// GetWishlistItem returns the item of the product, of its variant when
+// variantID is not 0.
+func (w *WishlistRepository) GetWishlistItem(ctx context.Context, wishlistID, productID, variantID int) (*entity.WishlistItem, error) {
+
+	row := w.db.QueryRowContext(ctx, "SELECT "+wishlistItemColumns+" FROM wishlist_items wi JOIN products p ON p.id = wi.product_id WHERE wi.wishlist_id = ? AND wi.product_id = ? AND COALESCE(wi.variant_id, 0) = ?", wishlistID, productID, variantID)
+
+	var item entity.WishlistItem
+	err := scanWishlistItem(row, &item)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := attachWishlistVariants(ctx, w.db, []*entity.WishlistItem{&item}); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// attachWishlistVariants sets the variant of the wishlist items that reference one.
+func attachWishlistVariants(ctx context.Context, db queryer, items []*entity.WishlistItem) error {
+
+	var ids []int
+	for _, item := range items {
+		if item.VariantID != 0 {
+			ids = append(ids, item.VariantID)
+		}
+	}
+
+	variants, err := getVariantsByIDs(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if variant, ok := variants[item.VariantID]; ok {
+			item.Variant = variant
+		}
+	}
+
+	return nil
+}
+
+func (w *WishlistRepository) BeginTransaction(ctx context.Context) (*sql.Tx, error) {
+	return w.db.BeginTx(ctx, nil)
+}
+
+// addWishlistItemQuery adds the item to the wishlist, or its quantity when the
+// product or variant is already on the list.
+const addWishlistItemQuery = `INSERT INTO wishlist_items (wishlist_id, product_id, variant_id, quantity, price, in_stock, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity), price = VALUES(price), in_stock = VALUES(in_stock), updated_at = VALUES(updated_at)`
+
+func (w *WishlistRepository) AddWishlistItem(ctx context.Context, item *entity.WishlistItem) error {
+
+	tNow := time.Now().UTC()
+	_, err := w.db.ExecContext(ctx, addWishlistItemQuery, item.WishlistID, item.ProductID, nullInt(item.VariantID), item.Quantity, item.Price, item.InStock, tNow, tNow)
+	return err
+}
+
+func (w *WishlistRepository) AddWishlistItemWithTransaction(ctx context.Context, tx *sql.Tx, item *entity.WishlistItem) error {
+
+	tNow := time.Now().UTC()
+	_, err := tx.ExecContext(ctx, addWishlistItemQuery, item.WishlistID, item.ProductID, nullInt(item.VariantID), item.Quantity, item.Price, item.InStock, tNow, tNow)
+	return err
+}
+
+func (w *WishlistRepository) DeleteWishlistItemWithTransaction(ctx context.Context, tx *sql.Tx, wishlistID, productID, variantID int) error {
+
+	_, err := tx.ExecContext(ctx, "DELETE FROM wishlist_items WHERE wishlist_id = ? AND product_id = ? AND COALESCE(variant_id, 0) = ?", wishlistID, productID, variantID)
+	return err
+}
+
+func (w *WishlistRepository) DeleteWishlistItem(ctx context.Context, wishlistID, productID, variantID int) error {
+
+	_, err := w.db.ExecContext(ctx, "DELETE FROM wishlist_items WHERE wishlist_id = ? AND product_id = ? AND COALESCE(variant_id, 0) = ?", wishlistID, productID, variantID)
+	return err
+}
+
+// GetChangedWishlistItems returns the items whose product or variant price or
+// availability differs from the one last reported, with the owner of their
+// wishlist. Items of deleted or hidden products are left out.
+func (w *WishlistRepository) GetChangedWishlistItems(ctx context.Context) ([]*entity.WishlistItem, map[int]int, error) {
+
+	now := time.Now().UTC()
+	rows, err := w.db.QueryContext(
+		ctx,
+		"SELECT "+wishlistItemColumns+", l.user_id FROM wishlist_items wi JOIN products p ON p.id = wi.product_id JOIN wishlists l ON l.id = wi.wishlist_id "+
+			"LEFT JOIN product_variants v ON v.id = wi.variant_id "+
+			"WHERE p.deleted_at IS NULL AND "+visibleProductSQL+" AND (wi.price <> COALESCE(v.price, p.price) OR "+
+			"wi.in_stock <> IF(v.id IS NULL, p.stock IS NULL OR p.stock > 0, v.stock IS NULL OR v.stock > 0))",
+		now, now,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var items []*entity.WishlistItem
+	owners := make(map[int]int)
+	for rows.Next() {
+		var item entity.WishlistItem
+		var userID int
+
+		err := rows.Scan(append(wishlistItemFields(&item), &userID)...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		owners[item.WishlistID] = userID
+		items = append(items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return items, owners, attachWishlistVariants(ctx, w.db, items)
+}
+
+// UpdateWishlistItemSnapshot records the price and availability reported to the user.
+func (w *WishlistRepository) UpdateWishlistItemSnapshot(ctx context.Context, id int, price float64, inStock bool) error {
+
+	_, err := w.db.ExecContext(ctx, "UPDATE wishlist_items SET price = ?, in_stock = ? WHERE id = ?", price, inStock, id)
+	return err
+}
@@ -1,6 +1,8 @@
 package route
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,13 +10,17 @@ import (
 	"github.com/aldotp/OnlineStore/internal/config"
 	"github.com/aldotp/OnlineStore/internal/handler"
 	"github.com/aldotp/OnlineStore/internal/middleware"
+	"github.com/aldotp/OnlineStore/internal/replica"
 	"github.com/aldotp/OnlineStore/internal/repositories"
 	"github.com/aldotp/OnlineStore/internal/services"
+	"github.com/aldotp/OnlineStore/internal/storage"
+	"github.com/aldotp/OnlineStore/internal/worker"
 	"github.com/gorilla/mux"
 )
 
 type Route struct {
 	config *config.BootstrapConfig
+	jobs   []worker.Job
 }
 
 func NewRouter(conf *config.BootstrapConfig) *Route {
@@ -27,23 +33,65 @@ func (route *Route) Router() *mux.Router {
 
 	// instance
 	redisInstance := config.NewRedisClient(route.config.Viper)
+	mediaStorage, err := storage.New(route.config.Storage)
+	if err != nil {
+		log.Fatalf("cannot create media storage: %v", err)
+	}
+	poolMonitor := config.NewPoolMonitor("primary", route.config.DB)
+	replicaRouter := replica.New(route.config.DB, route.config.Replicas, route.config.ReplicaPinAfterWrite, route.config.ReplicaMaxLag)
+	replicaRouter.CheckHealth(context.Background())
 
 	// repositories
 	userRepo := repositories.NewUserRepository(route.config.DB)
-	productRepo := repositories.NewProductRepository(route.config.DB)
-	categoryRepo := repositories.NewCategoryRepository(route.config.DB)
+	productRepo := repositories.NewProductRepository(route.config.DB, replicaRouter)
+	categoryRepo := repositories.NewCategoryRepository(route.config.DB, replicaRouter)
 	cartRepo := repositories.NewCartRepository(route.config.DB)
 	cartItemsRepo := repositories.NewCartItemsRepository(route.config.DB)
-	orderRepo := repositories.NewOrderRepository(route.config.DB)
-	orderDetailRepo := repositories.NewOrderDetailRepository(route.config.DB)
+	orderRepo := repositories.NewOrderRepository(route.config.DB, replicaRouter)
+	orderDetailRepo := repositories.NewOrderDetailRepository(route.config.DB, replicaRouter)
+	addressRepo := repositories.NewAddressRepository(route.config.DB)
+	shippingMethodRepo := repositories.NewShippingMethodRepository(route.config.DB)
+	shipmentRepo := repositories.NewShipmentRepository(route.config.DB)
+	returnRepo := repositories.NewReturnRepository(route.config.DB)
+	abandonedCartRepo := repositories.NewAbandonedCartRepository(route.config.DB)
+	wishlistRepo := repositories.NewWishlistRepository(route.config.DB)
+	reviewRepo := repositories.NewReviewRepository(route.config.DB)
+	variantRepo := repositories.NewProductVariantRepository(route.config.DB)
+	imageRepo := repositories.NewProductImageRepository(route.config.DB)
+	attributeRepo := repositories.NewAttributeRepository(route.config.DB)
+	priceRepo := repositories.NewPriceRepository(route.config.DB)
+	reportRepo := repositories.NewReportRepository(route.config.DB)
 
 	// services
-	userService := services.NewUser(userRepo, route.config)
-	productService := services.NewProduct(productRepo, categoryRepo, redisInstance)
+	notifier := services.NewLogNotifier()
+	cartService := services.NewCart(cartRepo, cartItemsRepo, productRepo, variantRepo, orderRepo, orderDetailRepo, route.config.CartMergeStrategy)
+	userService := services.NewUser(userRepo, route.config, cartService)
+	imageService := services.NewImage(imageRepo, productRepo, mediaStorage, redisInstance, route.config.ImageMaxSize)
+	productService := services.NewProduct(productRepo, categoryRepo, reviewRepo, variantRepo, attributeRepo, priceRepo, imageService, redisInstance)
 	paymentService := services.NewPayment()
-	cartService := services.NewCart(cartRepo, cartItemsRepo, productRepo)
-	checkoutService := services.NewCheckout(orderRepo, cartRepo, orderDetailRepo, paymentService)
+	shippingService := services.NewShipping(shippingMethodRepo, cartRepo, addressRepo)
+	checkoutService := services.NewCheckout(orderRepo, cartRepo, orderDetailRepo, addressRepo, productRepo, variantRepo, paymentService, shippingService)
 	categoryService := services.NewCategory(redisInstance, categoryRepo)
+	attributeService := services.NewAttribute(attributeRepo, categoryRepo, redisInstance)
+	addressService := services.NewAddress(addressRepo)
+	shipmentService := services.NewShipment(shipmentRepo, orderRepo, orderDetailRepo)
+	for _, code := range route.config.CarrierBatchCodes {
+		shipmentService.RegisterCarrierParser(code, services.NewGenericCarrierBatchParser())
+	}
+	returnService := services.NewReturn(returnRepo, orderRepo, orderDetailRepo, productRepo, variantRepo, reportRepo, paymentService)
+	cartAbandonmentService := services.NewCartAbandonment(abandonedCartRepo, cartRepo, cartItemsRepo, notifier, route.config.CartItemTTL, route.config.CartAbandonAfter)
+	wishlistService := services.NewWishlist(wishlistRepo, cartRepo, productRepo, variantRepo, notifier)
+	reviewService := services.NewReview(reviewRepo, productRepo, redisInstance)
+	variantService := services.NewVariant(variantRepo, productRepo, redisInstance)
+	priceService := services.NewPrice(priceRepo, productRepo, redisInstance)
+	catalogService := services.NewCatalog(productRepo, categoryRepo, attributeRepo, redisInstance)
+	orderExportService := services.NewOrderExport(orderRepo, route.config.Currency, route.config.OrderExportDir, route.config.OrderExportFormat)
+	orderManagementService := services.NewOrderManagement(orderRepo, orderDetailRepo, userRepo, reportRepo, paymentService)
+	reportService, err := services.NewReport(reportRepo, route.config.ReportTimezones)
+	if err != nil {
+		log.Fatalf("cannot create reports: %v", err)
+	}
+	archiveService := services.NewArchive(productRepo, categoryRepo, imageService, route.config.PurgeAfter)
 
 	// handlers
 	userHandler := handler.NewUserHandler(userService)
@@ -51,10 +99,47 @@ func (route *Route) Router() *mux.Router {
 	categoryHandler := handler.NewCategoryHandler(categoryService, categoryRepo, redisInstance)
 	cartHandler := handler.NewCartHandler(cartService, cartRepo, cartItemsRepo, productRepo)
 	checkoutHandler := handler.NewCheckoutHandler(checkoutService)
+	addressHandler := handler.NewAddressHandler(addressService)
+	shippingHandler := handler.NewShippingHandler(shippingService)
+	shipmentHandler := handler.NewShipmentHandler(shipmentService, route.config.CarrierWebhookSecret)
+	returnHandler := handler.NewReturnHandler(returnService)
+	cartAbandonmentHandler := handler.NewCartAbandonmentHandler(cartAbandonmentService)
+	wishlistHandler := handler.NewWishlistHandler(wishlistService)
+	reviewHandler := handler.NewReviewHandler(reviewService)
+	variantHandler := handler.NewVariantHandler(variantService)
+	imageHandler := handler.NewImageHandler(imageService, route.config.ImageMaxSize)
+	attributeHandler := handler.NewAttributeHandler(attributeService)
+	priceHandler := handler.NewPriceHandler(priceService)
+	catalogHandler := handler.NewCatalogHandler(catalogService)
+	orderExportHandler := handler.NewOrderExportHandler(orderExportService)
+	reportHandler := handler.NewReportHandler(reportService)
+	orderManagementHandler := handler.NewOrderManagementHandler(orderManagementService)
+
+	// background jobs
+	route.jobs = []worker.Job{
+		{Name: "carts", Interval: route.config.CartWorkerInterval, Run: cartAbandonmentService.Run},
+		{Name: "wishlists", Interval: route.config.WishlistWorkerInterval, Run: wishlistService.NotifyChanges},
+		{Name: "purge", Interval: route.config.PurgeWorkerInterval, Run: archiveService.Purge},
+		{Name: "publishing", Interval: route.config.PublishWorkerInterval, Run: productService.ApplySchedule},
+		{Name: "prices", Interval: route.config.PriceWorkerInterval, Run: priceService.ApplySchedules},
+		{Name: "order-export", Interval: route.config.OrderExportWorkerInterval, Run: orderExportService.WriteDailyFile},
+		{Name: "reports", Interval: route.config.ReportWorkerInterval, Run: reportService.Rollup},
+		{Name: "db-pool", Interval: route.config.DBPoolWorkerInterval, Run: poolMonitor.Check},
+		{Name: "replicas", Interval: route.config.ReplicaWorkerInterval, Run: replicaRouter.CheckHealth},
+	}
+	for i, db := range route.config.Replicas {
+		name := fmt.Sprintf("replica-%d", i+1)
+		route.jobs = append(route.jobs, worker.Job{Name: "db-pool-" + name, Interval: route.config.DBPoolWorkerInterval, Run: config.NewPoolMonitor(name, db).Check})
+	}
 
 	// router
 	r := mux.NewRouter()
 
+	// files of the local media storage
+	if local, ok := mediaStorage.(*storage.Local); ok {
+		r.PathPrefix("/media/").Handler(http.StripPrefix("/media/", http.FileServer(local.FileSystem())))
+	}
+
 	v1 := r.PathPrefix("/v1").Subrouter()
 	api := v1.PathPrefix("/api").Subrouter()
 
@@ -63,9 +148,19 @@ func (route *Route) Router() *mux.Router {
 
 	public.HandleFunc("/login", userHandler.LoginUser).Methods("POST")
 	public.HandleFunc("/register", userHandler.RegisterUser).Methods("POST")
+	public.HandleFunc("/webhooks/carrier/{carrier}", shipmentHandler.CarrierWebhook).Methods("POST")
+
+	public.HandleFunc("/cart", cartHandler.GuestCart).Methods("GET")
+	public.HandleFunc("/cart", cartHandler.GuestAddToCart).Methods("POST")
+	public.HandleFunc("/cart/product/{id}", cartHandler.GuestDeleteProductFromCart).Methods("DELETE")
+	public.HandleFunc("/cart", cartHandler.GuestEmptyCart).Methods("DELETE")
+	public.HandleFunc("/cart/product/{id}", cartHandler.GuestModifyCart).Methods("PUT")
+	public.HandleFunc("/cart/batch", cartHandler.GuestBatchCart).Methods("POST")
+
+	public.HandleFunc("/wishlist/shared/{token}", wishlistHandler.GetSharedWishlist).Methods("GET")
 
 	jwt := middleware.NewJWT(route.config)
-	protected.Use(jwt.AuthMiddleware)
+	protected.Use(jwt.AuthMiddleware, middleware.Pinning(replicaRouter))
 
 	protected.HandleFunc("/products/category/{id}", productHandler.GetProductsByCategory).Methods("GET")
 	protected.HandleFunc("/product/{id}", productHandler.UpdateProduct).Methods("PUT")
@@ -73,9 +168,20 @@ func (route *Route) Router() *mux.Router {
 	protected.HandleFunc("/product", productHandler.StoreProducts).Methods("POST")
 	protected.HandleFunc("/product/{id}", productHandler.DeleteProduct).Methods("DELETE")
 	protected.HandleFunc("/products", productHandler.GetProducts).Methods("GET")
+	protected.HandleFunc("/products/search", productHandler.SearchProducts).Methods("GET")
+
+	protected.HandleFunc("/product/{id}/prices", priceHandler.GetTimeline).Methods("GET")
+
+	protected.HandleFunc("/product/{id}/reviews", reviewHandler.GetProductReviews).Methods("GET")
+	protected.HandleFunc("/product/{id}/review", reviewHandler.StoreReview).Methods("POST")
+	protected.HandleFunc("/product/{id}/review", reviewHandler.UpdateReview).Methods("PUT")
+	protected.HandleFunc("/product/{id}/review", reviewHandler.DeleteReview).Methods("DELETE")
 
 	protected.HandleFunc("/category/{id}", categoryHandler.GetCategoryByID).Methods("GET")
 	protected.HandleFunc("/categories", categoryHandler.GetCategories).Methods("GET")
+	protected.HandleFunc("/categories/tree", categoryHandler.GetCategoryTree).Methods("GET")
+	protected.HandleFunc("/category/{id}/breadcrumbs", categoryHandler.GetBreadcrumbs).Methods("GET")
+	protected.HandleFunc("/category/{id}/attributes", attributeHandler.GetAttributes).Methods("GET")
 	protected.HandleFunc("/category/{id}", categoryHandler.DeleteCategory).Methods("DELETE")
 	protected.HandleFunc("/category/{id}", categoryHandler.UpdateCategory).Methods("PUT")
 	protected.HandleFunc("/category", categoryHandler.StoreCategory).Methods("POST")
@@ -85,15 +191,92 @@ func (route *Route) Router() *mux.Router {
 	protected.HandleFunc("/cart/product/{id}", cartHandler.DeleteProductFromCart).Methods("DELETE")
 	protected.HandleFunc("/cart", cartHandler.EmptyCart).Methods("DELETE")
 	protected.HandleFunc("/cart/product/{id}", cartHandler.ModifyCart).Methods("PUT")
+	protected.HandleFunc("/cart/batch", cartHandler.BatchCart).Methods("POST")
+	protected.HandleFunc("/order/{id}/reorder", cartHandler.Reorder).Methods("POST")
+	protected.HandleFunc("/cart/product/{id}/save-for-later", wishlistHandler.SaveForLater).Methods("POST")
+
+	protected.HandleFunc("/wishlists", wishlistHandler.GetWishlists).Methods("GET")
+	protected.HandleFunc("/wishlist", wishlistHandler.StoreWishlist).Methods("POST")
+	protected.HandleFunc("/wishlist/{id}", wishlistHandler.GetWishlistByID).Methods("GET")
+	protected.HandleFunc("/wishlist/{id}", wishlistHandler.UpdateWishlist).Methods("PUT")
+	protected.HandleFunc("/wishlist/{id}", wishlistHandler.DeleteWishlist).Methods("DELETE")
+	protected.HandleFunc("/wishlist/{id}/product", wishlistHandler.AddItem).Methods("POST")
+	protected.HandleFunc("/wishlist/{id}/product/{product_id}", wishlistHandler.RemoveItem).Methods("DELETE")
+	protected.HandleFunc("/wishlist/{id}/product/{product_id}/move-to-cart", wishlistHandler.MoveToCart).Methods("POST")
+
+	protected.HandleFunc("/addresses", addressHandler.GetAddresses).Methods("GET")
+	protected.HandleFunc("/address/{id}", addressHandler.GetAddressByID).Methods("GET")
+	protected.HandleFunc("/address", addressHandler.StoreAddress).Methods("POST")
+	protected.HandleFunc("/address/{id}", addressHandler.UpdateAddress).Methods("PUT")
+	protected.HandleFunc("/address/{id}", addressHandler.DeleteAddress).Methods("DELETE")
+
+	protected.HandleFunc("/shipping/quote", shippingHandler.Quote).Methods("POST")
 
 	protected.HandleFunc("/checkout", checkoutHandler.CheckoutHandler).Methods("POST")
 	protected.HandleFunc("/checkout/history", checkoutHandler.CheckoutHistory).Methods("GET")
+	protected.HandleFunc("/orders/{id}", checkoutHandler.GetOrder).Methods("GET")
+
+	protected.HandleFunc("/order/{id}/shipments", shipmentHandler.GetOrderShipments).Methods("GET")
+	protected.HandleFunc("/order/{id}/return", returnHandler.RequestReturn).Methods("POST")
+	protected.HandleFunc("/returns", returnHandler.GetUserReturns).Methods("GET")
+	protected.HandleFunc("/return/{id}", returnHandler.GetUserReturnByID).Methods("GET")
+
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(jwt.AdminMiddleware)
+
+	admin.HandleFunc("/orders", orderManagementHandler.ListOrders).Methods("GET")
+	admin.HandleFunc("/orders/status", orderManagementHandler.ChangeStatus).Methods("POST")
+	admin.HandleFunc("/orders/export", orderExportHandler.ExportOrders).Methods("GET")
+	admin.HandleFunc("/order/{id}", orderManagementHandler.GetOrder).Methods("GET")
+	admin.HandleFunc("/order/{id}/notes", orderManagementHandler.AddNote).Methods("POST")
+	admin.HandleFunc("/reports/sales", reportHandler.Sales).Methods("GET")
+	admin.HandleFunc("/reports/top-products", reportHandler.TopProducts).Methods("GET")
+	admin.HandleFunc("/reports/top-categories", reportHandler.TopCategories).Methods("GET")
+	admin.HandleFunc("/order/{id}/shipment", shipmentHandler.CreateShipment).Methods("POST")
+	admin.HandleFunc("/order/{id}/shipments", shipmentHandler.GetShipments).Methods("GET")
+
+	admin.HandleFunc("/returns", returnHandler.GetReturns).Methods("GET")
+	admin.HandleFunc("/return/{id}", returnHandler.GetReturnByID).Methods("GET")
+	admin.HandleFunc("/return/{id}/approve", returnHandler.ApproveReturn).Methods("POST")
+	admin.HandleFunc("/return/{id}/reject", returnHandler.RejectReturn).Methods("POST")
+	admin.HandleFunc("/return/{id}/receive", returnHandler.ReceiveReturn).Methods("POST")
+	admin.HandleFunc("/return/{id}/refund", returnHandler.RefundReturn).Methods("POST")
+
+	admin.HandleFunc("/carts/abandonment", cartAbandonmentHandler.Stats).Methods("GET")
+
+	admin.HandleFunc("/reviews", reviewHandler.GetReviews).Methods("GET")
+	admin.HandleFunc("/review/{id}/approve", reviewHandler.ApproveReview).Methods("POST")
+	admin.HandleFunc("/review/{id}/reject", reviewHandler.RejectReview).Methods("POST")
+
+	admin.HandleFunc("/products/import", catalogHandler.ImportProducts).Methods("POST")
+	admin.HandleFunc("/products/export", catalogHandler.ExportProducts).Methods("GET")
+	admin.HandleFunc("/products/deleted", productHandler.GetDeletedProducts).Methods("GET")
+	admin.HandleFunc("/product/{id}/restore", productHandler.RestoreProduct).Methods("POST")
+	admin.HandleFunc("/product/{id}/publishing", productHandler.SetPublishing).Methods("PUT")
+	admin.HandleFunc("/product/{id}/price-schedule", priceHandler.SchedulePrice).Methods("POST")
+	admin.HandleFunc("/product/{id}/price-schedule/{schedule_id}", priceHandler.CancelSchedule).Methods("DELETE")
+	admin.HandleFunc("/product/{id}/options", variantHandler.SetOptions).Methods("PUT")
+	admin.HandleFunc("/product/{id}/variant", variantHandler.StoreVariant).Methods("POST")
+	admin.HandleFunc("/product/{id}/variant/{variant_id}", variantHandler.UpdateVariant).Methods("PUT")
+	admin.HandleFunc("/product/{id}/variant/{variant_id}", variantHandler.DeleteVariant).Methods("DELETE")
+	admin.HandleFunc("/product/{id}/images", imageHandler.UploadImages).Methods("POST")
+	admin.HandleFunc("/product/{id}/images", imageHandler.ReorderImages).Methods("PUT")
+	admin.HandleFunc("/product/{id}/image/{image_id}", imageHandler.DeleteImage).Methods("DELETE")
+	admin.HandleFunc("/categories/deleted", categoryHandler.GetDeletedCategories).Methods("GET")
+	admin.HandleFunc("/category/{id}/restore", categoryHandler.RestoreCategory).Methods("POST")
+	admin.HandleFunc("/category/{id}/move", categoryHandler.MoveCategory).Methods("PUT")
+	admin.HandleFunc("/category/{id}/attribute", attributeHandler.StoreAttribute).Methods("POST")
+	admin.HandleFunc("/category/{id}/attribute/{attribute_id}", attributeHandler.UpdateAttribute).Methods("PUT")
+	admin.HandleFunc("/category/{id}/attribute/{attribute_id}", attributeHandler.DeleteAttribute).Methods("DELETE")
+
+	admin.Handle("/metrics", expvar.Handler()).Methods("GET")
 
 	return r
 }
 
 func (route *Route) Run() {
 	router := route.Router()
+	worker.Start(context.Background(), route.jobs...)
 	log.Printf("Server is running on %s:%s", route.config.Host, route.config.WebPort)
 	http.ListenAndServe(fmt.Sprintf(":%s", route.config.WebPort), router)
 }
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+type AddressService interface {
+	GetAddresses(ctx context.Context, userID int) ([]entity.Address, error)
+	GetAddressByID(ctx context.Context, id int, userID int) (*entity.Address, error)
+	StoreAddress(ctx context.Context, request model.AddressRequest, userID int) (*entity.Address, error)
+	UpdateAddress(ctx context.Context, request model.AddressRequest, userID int) error
+	DeleteAddress(ctx context.Context, request model.DeleteAddressRequest, userID int) error
+}
+
+type address struct {
+	repo *repositories.AddressRepository
+}
+
+func NewAddress(repo *repositories.AddressRepository) AddressService {
+	return &address{
+		repo: repo,
+	}
+}
+
+func (a *address) GetAddresses(ctx context.Context, userID int) ([]entity.Address, error) {
+
+	addresses, err := a.repo.GetAddressesByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get addresses")
+	}
+
+	return addresses, nil
+}
+
+func (a *address) GetAddressByID(ctx context.Context, id int, userID int) (*entity.Address, error) {
+
+	address, err := a.repo.GetAddressByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get address")
+	}
+
+	if address == nil || address.UserID != userID {
+		return nil, fmt.Errorf("address not found")
+	}
+
+	return address, nil
+}
+
+func (a *address) StoreAddress(ctx context.Context, request model.AddressRequest, userID int) (*entity.Address, error) {
+
+	if err := validateAddress(request); err != nil {
+		return nil, err
+	}
+
+	existing, err := a.repo.GetAddressesByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get addresses")
+	}
+
+	address := addressFromRequest(request, userID)
+	address.IsDefaultShipping = request.IsDefaultShipping != nil && *request.IsDefaultShipping
+	address.IsDefaultBilling = request.IsDefaultBilling != nil && *request.IsDefaultBilling
+
+	// the first address of a user becomes the default for both purposes
+	if len(existing) == 0 {
+		address.IsDefaultShipping = true
+		address.IsDefaultBilling = true
+	}
+
+	return a.repo.StoreAddress(ctx, address)
+}
+
+// UpdateAddress replaces the fields of the address. The default flags are kept
+// unless the request sets them.
+func (a *address) UpdateAddress(ctx context.Context, request model.AddressRequest, userID int) error {
+
+	stored, err := a.GetAddressByID(ctx, request.AddressID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := validateAddress(request); err != nil {
+		return err
+	}
+
+	address := addressFromRequest(request, userID)
+	address.ID = request.AddressID
+	address.IsDefaultShipping = stored.IsDefaultShipping
+	if request.IsDefaultShipping != nil {
+		address.IsDefaultShipping = *request.IsDefaultShipping
+	}
+	address.IsDefaultBilling = stored.IsDefaultBilling
+	if request.IsDefaultBilling != nil {
+		address.IsDefaultBilling = *request.IsDefaultBilling
+	}
+
+	err = a.repo.UpdateAddress(ctx, address)
+	if err != nil {
+		return fmt.Errorf("cannot update address")
+	}
+
+	return nil
+}
+
+func (a *address) DeleteAddress(ctx context.Context, request model.DeleteAddressRequest, userID int) error {
+
+	if _, err := a.GetAddressByID(ctx, request.AddressID, userID); err != nil {
+		return err
+	}
+
+	err := a.repo.DeleteAddress(ctx, userID, request.AddressID)
+	if err != nil {
+		return fmt.Errorf("cannot delete address")
+	}
+
+	return nil
+}
+
+// resolveShippingAddress builds the address snapshot stored on the order from
+// the inline address, the referenced address book entry or the user's default.
+func resolveShippingAddress(ctx context.Context, repo *repositories.AddressRepository, addressID int, inline *model.AddressRequest, userID int) (*entity.OrderAddress, error) {
+
+	if inline != nil {
+		if err := validateAddress(*inline); err != nil {
+			return nil, err
+		}
+
+		return &entity.OrderAddress{
+			RecipientName: inline.RecipientName,
+			Phone:         inline.Phone,
+			Line1:         inline.Line1,
+			Line2:         inline.Line2,
+			City:          inline.City,
+			State:         inline.State,
+			PostalCode:    inline.PostalCode,
+			Country:       inline.Country,
+		}, nil
+	}
+
+	var address *entity.Address
+	var err error
+	if addressID != 0 {
+		address, err = repo.GetAddressByID(ctx, addressID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get address")
+		}
+
+		if address == nil || address.UserID != userID {
+			return nil, invalidRequest("address not found")
+		}
+	} else {
+		address, err = repo.GetDefaultShippingAddress(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get address")
+		}
+
+		if address == nil {
+			return nil, invalidRequest("shipping address is required")
+		}
+	}
+
+	return &entity.OrderAddress{
+		RecipientName: address.RecipientName,
+		Phone:         address.Phone,
+		Line1:         address.Line1,
+		Line2:         address.Line2,
+		City:          address.City,
+		State:         address.State,
+		PostalCode:    address.PostalCode,
+		Country:       address.Country,
+	}, nil
+}
+
+func validateAddress(request model.AddressRequest) error {
+
+	required := map[string]string{
+		"recipient_name": request.RecipientName,
+		"line1":          request.Line1,
+		"city":           request.City,
+		"postal_code":    request.PostalCode,
+		"country":        request.Country,
+	}
+
+	for _, field := range []string{"recipient_name", "line1", "city", "postal_code", "country"} {
+		if strings.TrimSpace(required[field]) == "" {
+			return invalidRequest("%s is required", field)
+		}
+	}
+
+	return nil
+}
+
+func addressFromRequest(request model.AddressRequest, userID int) *entity.Address {
+	return &entity.Address{
+		UserID:        userID,
+		Label:         request.Label,
+		RecipientName: request.RecipientName,
+		Phone:         request.Phone,
+		Line1:         request.Line1,
+		Line2:         request.Line2,
+		City:          request.City,
+		State:         request.State,
+		PostalCode:    request.PostalCode,
+		Country:       request.Country,
+	}
+}
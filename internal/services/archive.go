@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+// ArchiveService purges the products and categories that were soft deleted
+// long enough ago. Products that were ordered are kept for the order history.
+type ArchiveService interface {
+	Purge(ctx context.Context) error
+}
+
+type archive struct {
+	productRepo  *repositories.ProductRepository
+	categoryRepo *repositories.CategoryRepository
+	imageSvc     ImageService
+	purgeAfter   time.Duration
+}
+
+// NewArchive purges the rows deleted for longer than purgeAfter. A zero
+// duration disables purging.
+func NewArchive(productRepo *repositories.ProductRepository, categoryRepo *repositories.CategoryRepository, imageSvc ImageService, purgeAfter time.Duration) ArchiveService {
+	return &archive{
+		productRepo:  productRepo,
+		categoryRepo: categoryRepo,
+		imageSvc:     imageSvc,
+		purgeAfter:   purgeAfter,
+	}
+}
+
+// Purge removes the products before the categories, so that categories emptied
+// by the purge are removed in the same run.
+func (a *archive) Purge(ctx context.Context) error {
+
+	if a.purgeAfter <= 0 {
+		return nil
+	}
+
+	before := time.Now().UTC().Add(-a.purgeAfter)
+
+	productIDs, err := a.productRepo.GetPurgeableProductIDs(ctx, before)
+	if err != nil {
+		return fmt.Errorf("cannot find purgeable products: %w", err)
+	}
+
+	products := 0
+	for _, id := range productIDs {
+		if err := a.imageSvc.DeleteProductImages(ctx, id); err != nil {
+			return fmt.Errorf("cannot delete images of product %d: %w", id, err)
+		}
+
+		purged, err := a.productRepo.PurgeProduct(ctx, id)
+		if err != nil {
+			return fmt.Errorf("cannot purge product %d: %w", id, err)
+		}
+
+		if purged {
+			products++
+		}
+	}
+
+	categoryIDs, err := a.categoryRepo.GetPurgeableCategoryIDs(ctx, before)
+	if err != nil {
+		return fmt.Errorf("cannot find purgeable categories: %w", err)
+	}
+
+	categories := 0
+	for _, id := range categoryIDs {
+		purged, err := a.categoryRepo.PurgeCategory(ctx, id)
+		if err != nil {
+			return fmt.Errorf("cannot purge category %d: %w", id, err)
+		}
+
+		if purged {
+			categories++
+		}
+	}
+
+	if products > 0 || categories > 0 {
+		log.Printf("purged %d products and %d categories", products, categories)
+	}
+
+	return nil
+}
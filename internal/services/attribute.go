@@ -0,0 +1,333 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/go-redis/redis/v8"
+)
+
+var attributeCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+type AttributeService interface {
+	GetAttributes(ctx context.Context, categoryID int) ([]entity.Attribute, error)
+	StoreAttribute(ctx context.Context, request model.AttributeRequest) (*entity.Attribute, error)
+	UpdateAttribute(ctx context.Context, request model.AttributeRequest) (*entity.Attribute, error)
+	DeleteAttribute(ctx context.Context, categoryID int, attributeID int) error
+}
+
+type attribute struct {
+	repo         *repositories.AttributeRepository
+	repoCategory *repositories.CategoryRepository
+	redis        *redis.Client
+}
+
+func NewAttribute(repo *repositories.AttributeRepository, repoCategory *repositories.CategoryRepository, redis *redis.Client) AttributeService {
+	return &attribute{
+		repo:         repo,
+		repoCategory: repoCategory,
+		redis:        redis,
+	}
+}
+
+// GetAttributes returns the attributes of the category, including the ones
+// inherited from its ancestors.
+func (a *attribute) GetAttributes(ctx context.Context, categoryID int) ([]entity.Attribute, error) {
+
+	if _, err := a.getCategory(ctx, categoryID); err != nil {
+		return nil, err
+	}
+
+	attributes, err := a.repo.GetAttributesByCategoryID(ctx, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attributes")
+	}
+
+	return attributes, nil
+}
+
+func (a *attribute) StoreAttribute(ctx context.Context, request model.AttributeRequest) (*entity.Attribute, error) {
+
+	if _, err := a.getCategory(ctx, request.CategoryID); err != nil {
+		return nil, err
+	}
+
+	request.Code = strings.TrimSpace(request.Code)
+	if !attributeCodePattern.MatchString(request.Code) {
+		return nil, fmt.Errorf("code must be lowercase letters, digits and underscores")
+	}
+
+	switch request.Type {
+	case entity.AttributeTypeString, entity.AttributeTypeNumber, entity.AttributeTypeBoolean, entity.AttributeTypeEnum:
+	default:
+		return nil, fmt.Errorf("type must be string, number, boolean or enum")
+	}
+
+	used, err := a.repo.CodeUsedInTree(ctx, request.CategoryID, request.Code)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attributes")
+	}
+
+	if used {
+		return nil, fmt.Errorf("attribute %s is already defined for this category, a parent or a subcategory", request.Code)
+	}
+
+	attribute := &entity.Attribute{
+		CategoryID: request.CategoryID,
+		Code:       request.Code,
+		Type:       request.Type,
+	}
+	if err := applyAttributeRequest(attribute, request); err != nil {
+		return nil, err
+	}
+
+	attribute, err = a.repo.StoreAttribute(ctx, attribute)
+	if err != nil {
+		return nil, fmt.Errorf("cannot store attribute")
+	}
+
+	return attribute, nil
+}
+
+func (a *attribute) UpdateAttribute(ctx context.Context, request model.AttributeRequest) (*entity.Attribute, error) {
+
+	attribute, err := a.getAttribute(ctx, request.CategoryID, request.AttributeID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyAttributeRequest(attribute, request); err != nil {
+		return nil, err
+	}
+
+	if attribute.Type == entity.AttributeTypeEnum {
+		invalid, err := a.repo.CountValuesNotIn(ctx, attribute.ID, attribute.Options)
+		if err != nil {
+			return nil, fmt.Errorf("cannot check attribute values")
+		}
+
+		if invalid > 0 {
+			return nil, fmt.Errorf("%d products use a value that is no longer an option", invalid)
+		}
+	}
+
+	if err := a.repo.UpdateAttribute(ctx, attribute); err != nil {
+		return nil, fmt.Errorf("cannot update attribute")
+	}
+
+	a.invalidateProducts(ctx)
+
+	return a.repo.GetAttributeByID(ctx, attribute.ID)
+}
+
+// DeleteAttribute removes the attribute and its values on all products.
+func (a *attribute) DeleteAttribute(ctx context.Context, categoryID int, attributeID int) error {
+
+	if _, err := a.getAttribute(ctx, categoryID, attributeID); err != nil {
+		return err
+	}
+
+	if err := a.repo.DeleteAttribute(ctx, attributeID); err != nil {
+		return fmt.Errorf("cannot delete attribute")
+	}
+
+	a.invalidateProducts(ctx)
+
+	return nil
+}
+
+func (a *attribute) getCategory(ctx context.Context, categoryID int) (*entity.Category, error) {
+
+	category, err := a.repoCategory.GetCategoryByID(ctx, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get category")
+	}
+
+	if category == nil {
+		return nil, fmt.Errorf("category not found")
+	}
+
+	return category, nil
+}
+
+func (a *attribute) getAttribute(ctx context.Context, categoryID int, attributeID int) (*entity.Attribute, error) {
+
+	attribute, err := a.repo.GetAttributeByID(ctx, attributeID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attribute")
+	}
+
+	if attribute == nil || attribute.CategoryID != categoryID {
+		return nil, fmt.Errorf("attribute not found")
+	}
+
+	return attribute, nil
+}
+
+// invalidateProducts drops the cached products, which include attribute values.
+func (a *attribute) invalidateProducts(ctx context.Context) {
+
+	iter := a.redis.Scan(ctx, 0, "product:*", 100).Iterator()
+	for iter.Next(ctx) {
+		a.redis.Del(ctx, iter.Val())
+	}
+	a.redis.Del(ctx, "products")
+}
+
+// applyAttributeRequest copies the changeable fields of the request into attribute.
+func applyAttributeRequest(attribute *entity.Attribute, request model.AttributeRequest) error {
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	var options []string
+	if attribute.Type == entity.AttributeTypeEnum {
+		seen := make(map[string]bool)
+		for _, option := range request.Options {
+			option = strings.TrimSpace(option)
+			if option == "" || seen[option] {
+				return fmt.Errorf("options must be unique and not empty")
+			}
+			seen[option] = true
+			options = append(options, option)
+		}
+
+		if len(options) == 0 {
+			return fmt.Errorf("enum attributes need options")
+		}
+	} else if len(request.Options) > 0 {
+		return fmt.Errorf("only enum attributes have options")
+	}
+
+	attribute.Name = name
+	attribute.Required = request.Required
+	attribute.Filterable = request.Filterable
+	attribute.Options = options
+
+	return nil
+}
+
+// validateAttributes checks values against the attribute definitions of a
+// product's category and returns them in canonical form.
+func validateAttributes(definitions []entity.Attribute, values map[string]any) ([]entity.ProductAttribute, error) {
+
+	byCode := make(map[string]entity.Attribute, len(definitions))
+	for _, definition := range definitions {
+		byCode[definition.Code] = definition
+	}
+
+	for code := range values {
+		if _, ok := byCode[code]; !ok {
+			return nil, fmt.Errorf("unknown attribute %s for this category", code)
+		}
+	}
+
+	var result []entity.ProductAttribute
+	for _, definition := range definitions {
+		value, ok := values[definition.Code]
+		if !ok || value == nil {
+			if definition.Required {
+				return nil, fmt.Errorf("attribute %s is required", definition.Code)
+			}
+			continue
+		}
+
+		canonical, err := canonicalAttributeValue(definition, value)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, entity.ProductAttribute{
+			AttributeID: definition.ID,
+			Code:        definition.Code,
+			Type:        definition.Type,
+			Value:       canonical,
+		})
+	}
+
+	return result, nil
+}
+
+// canonicalAttributeValue converts a JSON value, or a query string value, of
+// the attribute to its stored form.
+func canonicalAttributeValue(definition entity.Attribute, value any) (string, error) {
+
+	switch definition.Type {
+	case entity.AttributeTypeNumber:
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return strconv.FormatFloat(f, 'f', -1, 64), nil
+			}
+		}
+		return "", fmt.Errorf("attribute %s must be a number", definition.Code)
+
+	case entity.AttributeTypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case string:
+			if v == "true" || v == "false" {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("attribute %s must be true or false", definition.Code)
+
+	case entity.AttributeTypeEnum:
+		if v, ok := value.(string); ok {
+			for _, option := range definition.Options {
+				if option == v {
+					return v, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("attribute %s must be one of %s", definition.Code, strings.Join(definition.Options, ", "))
+
+	default:
+		v, ok := value.(string)
+		if !ok || strings.TrimSpace(v) == "" {
+			return "", fmt.Errorf("attribute %s must be a text", definition.Code)
+		}
+		if len(v) > 255 {
+			return "", fmt.Errorf("attribute %s is longer than 255 characters", definition.Code)
+		}
+		return strings.TrimSpace(v), nil
+	}
+}
+
+// attributeMap returns the attribute values of a product by code with their JSON type.
+func attributeMap(values []entity.ProductAttribute) map[string]any {
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	result := make(map[string]any, len(values))
+	for _, value := range values {
+		switch value.Type {
+		case entity.AttributeTypeNumber:
+			f, err := strconv.ParseFloat(value.Value, 64)
+			if err != nil {
+				result[value.Code] = value.Value
+				continue
+			}
+			result[value.Code] = f
+		case entity.AttributeTypeBoolean:
+			result[value.Code] = value.Value == "true"
+		default:
+			result[value.Code] = value.Value
+		}
+	}
+
+	return result
+}
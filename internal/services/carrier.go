@@ -0,0 +1,115 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+)
+
+// CarrierStatusParser turns the webhook payload of a carrier into normalized status updates.
+// Carriers with their own payload format register a parser with ShipmentService.RegisterCarrierParser.
+type CarrierStatusParser interface {
+	Parse(payload []byte) ([]model.CarrierStatusUpdate, error)
+}
+
+// carrierStatuses maps the status names used by carriers to shipment statuses.
+var carrierStatuses = map[string]string{
+	"shipped":          entity.ShipmentStatusShipped,
+	"picked_up":        entity.ShipmentStatusShipped,
+	"in_transit":       entity.ShipmentStatusInTransit,
+	"transit":          entity.ShipmentStatusInTransit,
+	"out_for_delivery": entity.ShipmentStatusOutForDelivery,
+	"delivered":        entity.ShipmentStatusDelivered,
+	"exception":        entity.ShipmentStatusException,
+	"failed_attempt":   entity.ShipmentStatusException,
+	"returned":         entity.ShipmentStatusException,
+}
+
+func normalizeCarrierStatus(status string) (string, error) {
+
+	key := strings.ToLower(strings.TrimSpace(status))
+	key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+
+	normalized, ok := carrierStatuses[key]
+	if !ok {
+		return "", invalidRequest("unknown carrier status %q", status)
+	}
+
+	return normalized, nil
+}
+
+type genericCarrierEvent struct {
+	TrackingNumber string    `json:"tracking_number"`
+	Status         string    `json:"status"`
+	Description    string    `json:"description"`
+	OccurredAt     time.Time `json:"occurred_at"`
+}
+
+// genericCarrierParser accepts a single event object.
+type genericCarrierParser struct{}
+
+func NewGenericCarrierParser() CarrierStatusParser {
+	return &genericCarrierParser{}
+}
+
+func (g *genericCarrierParser) Parse(payload []byte) ([]model.CarrierStatusUpdate, error) {
+
+	var event genericCarrierEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, invalidRequest("invalid carrier payload")
+	}
+
+	return genericCarrierUpdates([]genericCarrierEvent{event})
+}
+
+// genericCarrierBatchParser accepts {"events": [...]}, for the carriers sending
+// their events in batches.
+type genericCarrierBatchParser struct{}
+
+func NewGenericCarrierBatchParser() CarrierStatusParser {
+	return &genericCarrierBatchParser{}
+}
+
+func (g *genericCarrierBatchParser) Parse(payload []byte) ([]model.CarrierStatusUpdate, error) {
+
+	var batch struct {
+		Events []genericCarrierEvent `json:"events"`
+	}
+	if err := json.Unmarshal(payload, &batch); err != nil {
+		return nil, invalidRequest("invalid carrier payload")
+	}
+
+	return genericCarrierUpdates(batch.Events)
+}
+
+func genericCarrierUpdates(events []genericCarrierEvent) ([]model.CarrierStatusUpdate, error) {
+
+	updates := make([]model.CarrierStatusUpdate, 0, len(events))
+	for _, event := range events {
+		if event.TrackingNumber == "" {
+			return nil, invalidRequest("tracking number is required")
+		}
+
+		status, err := normalizeCarrierStatus(event.Status)
+		if err != nil {
+			return nil, err
+		}
+
+		occurredAt := event.OccurredAt
+		if occurredAt.IsZero() {
+			occurredAt = time.Now().UTC()
+		}
+
+		updates = append(updates, model.CarrierStatusUpdate{
+			TrackingNumber: event.TrackingNumber,
+			Status:         status,
+			Description:    event.Description,
+			OccurredAt:     occurredAt,
+		})
+	}
+
+	return updates, nil
+}
@@ -2,32 +2,72 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
 	"github.com/aldotp/OnlineStore/internal/model"
 	"github.com/aldotp/OnlineStore/internal/repositories"
 )
 
+// Conflict rules applied when a guest cart and the user cart contain the same product.
+const (
+	CartMergeSum      = "sum"
+	CartMergeMax      = "max"
+	CartMergeKeepUser = "keep_user"
+)
+
+const maxCartOperations = 100
+
 type CartService interface {
 	AddToCart(ctx context.Context, request model.CartItemsRequest, userID int) (*entity.CartItem, error)
 	ViewCart(ctx context.Context, userID int) (*model.ViewCartResponse, error)
 	RemoveFromCart(ctx context.Context, request model.DeleteProductRequest, userID int) error
 	EmptyCart(ctx context.Context, userID int) error
 	ModifyCart(ctx context.Context, request model.ModifyCartRequest, userID int) error
+	BatchCart(ctx context.Context, request model.CartBatchRequest, userID int) (*model.CartBatchResponse, error)
+	Reorder(ctx context.Context, orderID int, userID int) (*model.CartBatchResponse, error)
+
+	AddToGuestCart(ctx context.Context, request model.CartItemsRequest, token string) (*entity.CartItem, string, error)
+	ViewGuestCart(ctx context.Context, token string) (*model.ViewCartResponse, error)
+	RemoveFromGuestCart(ctx context.Context, request model.DeleteProductRequest, token string) error
+	EmptyGuestCart(ctx context.Context, token string) error
+	ModifyGuestCart(ctx context.Context, request model.ModifyCartRequest, token string) error
+	BatchGuestCart(ctx context.Context, request model.CartBatchRequest, token string) (*model.CartBatchResponse, string, error)
+	MergeGuestCart(ctx context.Context, token string, userID int) error
 }
 
 type cart struct {
 	repo          *repositories.CartRepository
 	repoCartItems *repositories.CartItemsRepository
 	repoProduct   *repositories.ProductRepository
+	repoVariant   *repositories.ProductVariantRepository
+	repoOrder     *repositories.OrderRepository
+	repoOrderItem *repositories.OrderDetailRepository
+	mergeStrategy string
 }
 
-func NewCart(repo *repositories.CartRepository, repoCartItems *repositories.CartItemsRepository, repoProduct *repositories.ProductRepository) CartService {
+func NewCart(repo *repositories.CartRepository, repoCartItems *repositories.CartItemsRepository, repoProduct *repositories.ProductRepository, repoVariant *repositories.ProductVariantRepository, repoOrder *repositories.OrderRepository, repoOrderItem *repositories.OrderDetailRepository, mergeStrategy string) CartService {
+	switch mergeStrategy {
+	case CartMergeSum, CartMergeMax, CartMergeKeepUser:
+	default:
+		if mergeStrategy != "" {
+			log.Printf("unknown cart merge strategy %q, using %q", mergeStrategy, CartMergeSum)
+		}
+		mergeStrategy = CartMergeSum
+	}
+
 	return &cart{
 		repo:          repo,
 		repoCartItems: repoCartItems,
 		repoProduct:   repoProduct,
+		repoVariant:   repoVariant,
+		repoOrder:     repoOrder,
+		repoOrderItem: repoOrderItem,
+		mergeStrategy: mergeStrategy,
 	}
 }
 
@@ -38,25 +78,319 @@ func (c *cart) AddToCart(ctx context.Context, request model.CartItemsRequest, us
 		return nil, err
 	}
 
-	product, err := c.repoProduct.GetProductByID(ctx, request.ProductID)
+	return c.addToCart(ctx, cart, request)
+}
+
+func (c *cart) RemoveFromCart(ctx context.Context, request model.DeleteProductRequest, userID int) error {
+	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("cannot get cart")
+	}
+
+	return c.removeFromCart(ctx, cart, request)
+}
+
+func (c *cart) ViewCart(ctx context.Context, userID int) (*model.ViewCartResponse, error) {
+
+	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart")
+	}
+
+	return c.viewCart(ctx, cart)
+}
+
+func (c *cart) EmptyCart(ctx context.Context, userID int) error {
+
+	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("cannot get cart")
+	}
+
+	return c.emptyCart(ctx, cart)
+}
+
+func (c *cart) ModifyCart(ctx context.Context, request model.ModifyCartRequest, userID int) error {
+
+	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("cannot get cart")
+	}
+
+	return c.modifyCart(ctx, cart, request)
+}
+
+func (c *cart) BatchCart(ctx context.Context, request model.CartBatchRequest, userID int) (*model.CartBatchResponse, error) {
+
+	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart")
+	}
+
+	return c.batchCart(ctx, cart, request.Operations, nil)
+}
+
+// Reorder adds every line of one of the user's orders to the cart. Lines whose
+// product or variant no longer exists are skipped and reported with the reason.
+func (c *cart) Reorder(ctx context.Context, orderID int, userID int) (*model.CartBatchResponse, error) {
+
+	order, err := c.repoOrder.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil || order.UserID != userID {
+		return nil, invalidRequest("order not found")
+	}
+
+	details, err := c.repoOrderItem.GetOrderDetailsByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order details")
+	}
+
+	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart")
+	}
+
+	operations := make([]model.CartOperation, 0, len(details))
+	for _, detail := range details {
+		operations = append(operations, model.CartOperation{
+			Op:        model.CartOperationAdd,
+			ProductID: detail.ProductID,
+			VariantID: detail.VariantID,
+			Quantity:  detail.Quantity,
+		})
+	}
+
+	// lookup errors are left to the operation, which then fails
+	skip := func(operation model.CartOperation) string {
+		if operation.ProductID == 0 {
+			return "product not found"
+		}
+
+		product, err := c.repoProduct.GetProductByID(ctx, operation.ProductID)
+		if err != nil {
+			return ""
+		}
+
+		if product == nil || !product.Visible(time.Now().UTC()) {
+			return "product not found"
+		}
+
+		if operation.VariantID == 0 {
+			hasVariants, err := c.repoVariant.HasVariants(ctx, product.ID)
+			if err == nil && hasVariants {
+				return "product is now sold by variant"
+			}
+			return ""
+		}
+
+		variant, err := c.repoVariant.GetVariantByID(ctx, operation.VariantID)
+		if err == nil && (variant == nil || variant.ProductID != product.ID) {
+			return "variant not found"
+		}
+
+		return ""
+	}
+
+	return c.batchCart(ctx, cart, operations, skip)
+}
+
+// AddToGuestCart adds the product to the guest cart of the token. A new guest cart
+// is created when the token is empty or unknown, its token is returned.
+func (c *cart) AddToGuestCart(ctx context.Context, request model.CartItemsRequest, token string) (*entity.CartItem, string, error) {
+
+	cart, err := c.guestCart(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cart == nil {
+		token, err = newToken()
+		if err != nil {
+			return nil, "", err
+		}
+
+		cart, err = c.repo.CreateGuestCart(ctx, token)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot create cart")
+		}
+	}
+
+	item, err := c.addToCart(ctx, cart, request)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return item, cart.Token, nil
+}
+
+func (c *cart) ViewGuestCart(ctx context.Context, token string) (*model.ViewCartResponse, error) {
+
+	cart, err := c.requireGuestCart(ctx, token)
 	if err != nil {
 		return nil, err
 	}
 
-	if product == nil {
-		return nil, fmt.Errorf("product not found")
+	return c.viewCart(ctx, cart)
+}
+
+func (c *cart) RemoveFromGuestCart(ctx context.Context, request model.DeleteProductRequest, token string) error {
+
+	cart, err := c.requireGuestCart(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return c.removeFromCart(ctx, cart, request)
+}
+
+func (c *cart) EmptyGuestCart(ctx context.Context, token string) error {
+
+	cart, err := c.requireGuestCart(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return c.emptyCart(ctx, cart)
+}
+
+func (c *cart) ModifyGuestCart(ctx context.Context, request model.ModifyCartRequest, token string) error {
+
+	cart, err := c.requireGuestCart(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return c.modifyCart(ctx, cart, request)
+}
+
+// BatchGuestCart applies the operations to the guest cart of the token, creating
+// the cart like AddToGuestCart.
+func (c *cart) BatchGuestCart(ctx context.Context, request model.CartBatchRequest, token string) (*model.CartBatchResponse, string, error) {
+
+	cart, err := c.guestCart(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cart == nil {
+		token, err = newToken()
+		if err != nil {
+			return nil, "", err
+		}
+
+		cart, err = c.repo.CreateGuestCart(ctx, token)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot create cart")
+		}
+	}
+
+	response, err := c.batchCart(ctx, cart, request.Operations, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return response, cart.Token, nil
+}
+
+// MergeGuestCart moves the guest cart of the token into the user's cart using the
+// configured conflict rule. Unknown tokens are ignored.
+func (c *cart) MergeGuestCart(ctx context.Context, token string, userID int) error {
+
+	guest, err := c.guestCart(ctx, token)
+	if err != nil || guest == nil {
+		return err
+	}
+
+	userCart, err := c.repo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("cannot get cart")
 	}
 
-	item, err := c.repo.GetCartItemByUserIDAndProductID(ctx, userID, request.ProductID)
+	err = c.repo.MergeCarts(ctx, guest.ID, userCart.ID, c.resolveQuantity)
+	if err != nil {
+		return fmt.Errorf("cannot merge cart")
+	}
+
+	return nil
+}
+
+func (c *cart) resolveQuantity(userQuantity, guestQuantity int) int {
+
+	switch c.mergeStrategy {
+	case CartMergeMax:
+		if guestQuantity > userQuantity {
+			return guestQuantity
+		}
+		return userQuantity
+	case CartMergeKeepUser:
+		return userQuantity
+	default:
+		return userQuantity + guestQuantity
+	}
+}
+
+func (c *cart) guestCart(ctx context.Context, token string) (*entity.Cart, error) {
+
+	if token == "" {
+		return nil, nil
+	}
+
+	cart, err := c.repo.GetCartByToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart")
+	}
+
+	return cart, nil
+}
+
+func (c *cart) requireGuestCart(ctx context.Context, token string) (*entity.Cart, error) {
+
+	cart, err := c.guestCart(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if cart == nil {
+		return nil, invalidRequest("cart not found")
+	}
+
+	return cart, nil
+}
+
+func (c *cart) addToCart(ctx context.Context, cart *entity.Cart, request model.CartItemsRequest) (*entity.CartItem, error) {
+
+	if request.Quantity <= 0 {
+		return nil, invalidRequest("quantity must be greater than 0")
+	}
+
+	product, err := c.repoProduct.GetProductByID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil || !product.Visible(time.Now().UTC()) {
+		return nil, invalidRequest("product not found")
+	}
+
+	variant, err := resolveVariant(ctx, c.repoVariant, product, request.VariantID)
 	if err != nil {
 		return nil, err
 	}
 
+	item, err := c.repo.GetCartItemByCartIDAndProductID(ctx, cart.ID, request.ProductID, request.VariantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart item")
+	}
+
 	if item != nil {
 		item.Quantity += request.Quantity
+		item.Price = unitPrice(product, variant)
 		err := c.repo.UpdateCartItem(ctx, item)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("cannot update cart")
 		}
 
 		return item, nil
@@ -65,49 +399,47 @@ func (c *cart) AddToCart(ctx context.Context, request model.CartItemsRequest, us
 	data := entity.CartItem{
 		CartID:    cart.ID,
 		ProductID: request.ProductID,
+		VariantID: request.VariantID,
 		Quantity:  request.Quantity,
+		Price:     unitPrice(product, variant),
 	}
 
 	cartItem, err := c.repoCartItems.StoreCartItems(ctx, &data)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot add product to cart")
 	}
 
 	return cartItem, nil
 }
 
-func (c *cart) RemoveFromCart(ctx context.Context, request model.DeleteProductRequest, userID int) error {
-	cart, err := c.repo.GetCartByUserID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("cannot get cart")
-	}
+func (c *cart) removeFromCart(ctx context.Context, cart *entity.Cart, request model.DeleteProductRequest) error {
 
-	err = c.repo.DeleteProductFromCart(ctx, cart.ID, request.ProductID)
+	err := c.repo.DeleteProductFromCart(ctx, cart.ID, request.ProductID, request.VariantID)
 	if err != nil {
 		return fmt.Errorf("cannot delete product from cart")
 	}
 
 	return nil
-
 }
 
-func (c *cart) ViewCart(ctx context.Context, userID int) (*model.ViewCartResponse, error) {
-
-	cart, err := c.repo.GetCartByUserID(ctx, userID)
-	if err != nil {
-		return nil, fmt.Errorf("cannot get cart")
-	}
+func (c *cart) viewCart(ctx context.Context, cart *entity.Cart) (*model.ViewCartResponse, error) {
 
 	cartItems, err := c.repoCartItems.GetCartItemsByCartID(ctx, cart.ID)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get cart items")
 	}
 
+	hasChanges := markPriceChanges(cartItems)
+
 	var total float64 = 0
 	count := 0
 
 	for _, item := range cartItems {
-		price := item.Product.Price * float64(item.Quantity)
+		if item.ProductDeleted {
+			continue
+		}
+
+		price := item.UnitPrice() * float64(item.Quantity)
 		total += price
 		count += item.Quantity
 	}
@@ -117,36 +449,228 @@ func (c *cart) ViewCart(ctx context.Context, userID int) (*model.ViewCartRespons
 		TotalProduct: len(cartItems),
 		Total:        count,
 		TotalPrice:   total,
+		HasChanges:   hasChanges,
 	}, nil
 }
 
-func (c *cart) EmptyCart(ctx context.Context, userID int) error {
+func (c *cart) emptyCart(ctx context.Context, cart *entity.Cart) error {
 
-	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	err := c.repo.EmptyCart(ctx, cart.ID)
 	if err != nil {
-		return fmt.Errorf("cannot get cart")
+		return fmt.Errorf("cannot empty cart")
 	}
 
-	err = c.repo.EmptyCart(ctx, cart.ID)
+	return nil
+}
+
+func (c *cart) modifyCart(ctx context.Context, cart *entity.Cart, request model.ModifyCartRequest) error {
+
+	if request.Quantity < 0 {
+		return invalidRequest("quantity must not be negative")
+	}
+
+	err := c.repo.ModifyCart(ctx, cart.ID, request.ProductID, request.VariantID, request.Quantity)
 	if err != nil {
-		return fmt.Errorf("cannot empty cart")
+		return fmt.Errorf("cannot modify cart")
 	}
 
 	return nil
-
 }
 
-func (c *cart) ModifyCart(ctx context.Context, request model.ModifyCartRequest, userID int) error {
+// batchCart validates every operation against the cart and saves all of them in
+// one transaction, or none when a line failed. Operations for which skip returns
+// a reason are reported as skipped with it and not applied.
+func (c *cart) batchCart(ctx context.Context, cart *entity.Cart, operations []model.CartOperation, skip func(operation model.CartOperation) string) (*model.CartBatchResponse, error) {
 
-	cart, err := c.repo.GetCartByUserID(ctx, userID)
+	if len(operations) == 0 {
+		return nil, invalidRequest("operations are required")
+	}
+
+	if len(operations) > maxCartOperations {
+		return nil, invalidRequest("at most %d operations are allowed", maxCartOperations)
+	}
+
+	tx, err := c.repo.BeginTransaction(ctx)
 	if err != nil {
-		return fmt.Errorf("cannot get cart")
+		return nil, fmt.Errorf("cannot begin transaction")
 	}
+	defer tx.Rollback()
 
-	err = c.repo.ModifyCart(ctx, cart.ID, request.ProductID, request.Quantity)
+	items, err := c.repo.GetCartItemsForUpdateWithTransaction(ctx, tx, cart.ID)
 	if err != nil {
-		return fmt.Errorf("cannot modify cart")
+		return nil, fmt.Errorf("cannot get cart items")
 	}
 
-	return nil
+	quantities := make(map[entity.CartLine]int, len(items))
+	for line, item := range items {
+		quantities[line] = item.Quantity
+	}
+
+	// current prices of the lines added or set, and the lines in the order they were first changed
+	prices := make(map[entity.CartLine]float64)
+	changed := make(map[entity.CartLine]bool)
+	var touched []entity.CartLine
+
+	response := &model.CartBatchResponse{Applied: true}
+	for i, operation := range operations {
+		result := model.CartOperationResult{
+			Index:     i,
+			Op:        operation.Op,
+			ProductID: operation.ProductID,
+			VariantID: operation.VariantID,
+			Status:    model.CartOperationOK,
+		}
+		line := entity.CartLine{ProductID: operation.ProductID, VariantID: operation.VariantID}
+
+		if skip != nil {
+			if reason := skip(operation); reason != "" {
+				result.Status = model.CartOperationSkipped
+				result.Error = reason
+				response.Results = append(response.Results, result)
+				continue
+			}
+		}
+
+		quantity, err := c.applyOperation(ctx, operation, quantities[line], prices)
+		if err != nil {
+			result.Status = model.CartOperationFailed
+			result.Error = err.Error()
+			response.Applied = false
+			response.Results = append(response.Results, result)
+			continue
+		}
+
+		if _, ok := changed[line]; !ok {
+			changed[line] = true
+			touched = append(touched, line)
+		}
+
+		quantities[line] = quantity
+		result.Quantity = quantity
+		response.Results = append(response.Results, result)
+	}
+
+	if !response.Applied {
+		return response, nil
+	}
+
+	for _, line := range touched {
+		item, quantity := items[line], quantities[line]
+		price, priced := prices[line]
+
+		switch {
+		case item != nil && quantity == 0:
+			err = c.repo.DeleteCartItemWithTransaction(ctx, tx, item.ID)
+		case item != nil:
+			item.Quantity = quantity
+			if priced {
+				item.Price = price
+			}
+			err = c.repo.UpdateCartItemWithTransaction(ctx, tx, item)
+		case quantity > 0:
+			err = c.repo.StoreCartItemWithTransaction(ctx, tx, &entity.CartItem{
+				CartID:    cart.ID,
+				ProductID: line.ProductID,
+				VariantID: line.VariantID,
+				Quantity:  quantity,
+				Price:     price,
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot update cart")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot commit transaction")
+	}
+
+	response.Cart, err = c.viewCart(ctx, cart)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// applyOperation returns the quantity of the line after the operation. The current
+// price of the lines that are added or set is loaded into prices once.
+func (c *cart) applyOperation(ctx context.Context, operation model.CartOperation, current int, prices map[entity.CartLine]float64) (int, error) {
+
+	if operation.ProductID <= 0 {
+		return 0, fmt.Errorf("product_id is required")
+	}
+
+	switch operation.Op {
+	case model.CartOperationRemove:
+		if current == 0 {
+			return 0, fmt.Errorf("product is not in the cart")
+		}
+		return 0, nil
+	case model.CartOperationAdd:
+		if operation.Quantity <= 0 {
+			return 0, fmt.Errorf("quantity must be greater than 0")
+		}
+	case model.CartOperationSet:
+		if operation.Quantity < 0 {
+			return 0, fmt.Errorf("quantity must not be negative")
+		}
+		if operation.Quantity == 0 {
+			return 0, nil
+		}
+	default:
+		return 0, fmt.Errorf("unknown operation %q", operation.Op)
+	}
+
+	line := entity.CartLine{ProductID: operation.ProductID, VariantID: operation.VariantID}
+	if _, ok := prices[line]; !ok {
+		product, err := c.repoProduct.GetProductByID(ctx, operation.ProductID)
+		if err != nil {
+			return 0, fmt.Errorf("cannot get product")
+		}
+
+		if product == nil || !product.Visible(time.Now().UTC()) {
+			return 0, fmt.Errorf("product not found")
+		}
+
+		variant, err := resolveVariant(ctx, c.repoVariant, product, operation.VariantID)
+		if err != nil {
+			return 0, err
+		}
+
+		prices[line] = unitPrice(product, variant)
+	}
+
+	if operation.Op == model.CartOperationAdd {
+		return current + operation.Quantity, nil
+	}
+
+	return operation.Quantity, nil
+}
+
+// markPriceChanges flags the items whose product price differs from the price seen
+// when they were added and reports whether any item changed or was deleted.
+// Items without a recorded price are never flagged.
+func markPriceChanges(cartItems []*entity.CartItem) bool {
+
+	changed := false
+	for _, item := range cartItems {
+		item.PriceChanged = !item.ProductDeleted && item.Price != 0 && item.Price != item.UnitPrice()
+		if item.PriceChanged || item.ProductDeleted {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// newToken returns a random token for guest carts and share links.
+func newToken() (string, error) {
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("cannot create token")
+	}
+
+	return hex.EncodeToString(b), nil
 }
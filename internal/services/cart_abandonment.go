@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+type CartAbandonmentService interface {
+	Run(ctx context.Context) error
+	Stats(ctx context.Context, from, to time.Time) (*model.CartAbandonmentStats, error)
+}
+
+type cartAbandonment struct {
+	repo          *repositories.AbandonedCartRepository
+	cartRepo      *repositories.CartRepository
+	cartItemsRepo *repositories.CartItemsRepository
+	notifier      Notifier
+	itemTTL       time.Duration
+	abandonAfter  time.Duration
+}
+
+// NewCartAbandonment detects carts untouched for abandonAfter and expires cart
+// items untouched for itemTTL. A zero duration disables the step.
+func NewCartAbandonment(repo *repositories.AbandonedCartRepository, cartRepo *repositories.CartRepository, cartItemsRepo *repositories.CartItemsRepository, notifier Notifier, itemTTL, abandonAfter time.Duration) CartAbandonmentService {
+	return &cartAbandonment{
+		repo:          repo,
+		cartRepo:      cartRepo,
+		cartItemsRepo: cartItemsRepo,
+		notifier:      notifier,
+		itemTTL:       itemTTL,
+		abandonAfter:  abandonAfter,
+	}
+}
+
+// Run detects abandoned carts before expiring items, so carts that expire are
+// still reported.
+func (c *cartAbandonment) Run(ctx context.Context) error {
+
+	if c.abandonAfter > 0 {
+		if err := c.detectAbandoned(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.itemTTL > 0 {
+		if err := c.expireItems(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// detectAbandoned records the carts abandoned since the last run, then notifies
+// every recorded cart whose notification was not sent yet. A cart is marked
+// notified only once the notification is sent, so failed ones are retried on
+// the next run.
+func (c *cartAbandonment) detectAbandoned(ctx context.Context) error {
+
+	carts, err := c.repo.FindAbandonedCarts(ctx, time.Now().UTC().Add(-c.abandonAfter))
+	if err != nil {
+		return fmt.Errorf("cannot find abandoned carts: %w", err)
+	}
+
+	for _, cart := range carts {
+		if err := c.repo.StoreAbandonedCart(ctx, cart); err != nil {
+			return fmt.Errorf("cannot store abandoned cart %d: %w", cart.CartID, err)
+		}
+	}
+
+	carts, err = c.repo.FindUnnotifiedCarts(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot find abandoned carts to notify: %w", err)
+	}
+
+	for _, cart := range carts {
+		err := c.notifier.Notify(ctx, model.Notification{
+			Type:   model.NotificationAbandonedCart,
+			UserID: cart.UserID,
+			Data:   cart,
+		})
+		if err != nil {
+			log.Printf("cannot notify abandoned cart %d: %v", cart.CartID, err)
+			continue
+		}
+
+		if err := c.repo.MarkNotified(ctx, cart.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *cartAbandonment) expireItems(ctx context.Context) error {
+
+	before := time.Now().UTC().Add(-c.itemTTL)
+
+	items, err := c.cartItemsRepo.DeleteCartItemsUpdatedBefore(ctx, before)
+	if err != nil {
+		return fmt.Errorf("cannot expire cart items: %w", err)
+	}
+
+	carts, err := c.cartRepo.DeleteEmptyGuestCarts(ctx, before)
+	if err != nil {
+		return fmt.Errorf("cannot expire guest carts: %w", err)
+	}
+
+	if items > 0 || carts > 0 {
+		log.Printf("expired %d cart items and %d guest carts", items, carts)
+	}
+
+	return nil
+}
+
+// Stats reports the abandonment rate as the share of abandoned carts among
+// abandoned carts and placed orders.
+func (c *cartAbandonment) Stats(ctx context.Context, from, to time.Time) (*model.CartAbandonmentStats, error) {
+
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+
+	abandoned, value, recovered, orders, err := c.repo.GetAbandonmentStats(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get abandonment stats")
+	}
+
+	stats := &model.CartAbandonmentStats{
+		From:           from,
+		To:             to,
+		AbandonedCarts: abandoned,
+		AbandonedValue: value,
+		RecoveredCarts: recovered,
+		Orders:         orders,
+	}
+
+	if abandoned+orders > 0 {
+		stats.AbandonmentRate = math.Round(float64(abandoned)/float64(abandoned+orders)*10000) / 10000
+	}
+
+	return stats, nil
+}
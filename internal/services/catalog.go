@@ -0,0 +1,530 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/go-redis/redis/v8"
+)
+
+// Formats of the import and export files. Only orders are exported as XLSX.
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatXLSX  = "xlsx"
+)
+
+// importBatchSize is the number of rows written in one transaction.
+const importBatchSize = 500
+
+// catalogColumns are the CSV columns of the catalog files, in export order.
+var catalogColumns = []string{"sku", "name", "description", "price", "category_id", "weight", "length", "width", "height", "stock", "status"}
+
+// attributeColumnPrefix starts the CSV columns of the attribute values, followed
+// by the attribute code.
+const attributeColumnPrefix = "attribute."
+
+// CatalogService imports and exports products in bulk. Rows are matched by SKU
+// and validated one by one, a row that fails is reported and skipped without
+// stopping the import.
+type CatalogService interface {
+	Import(ctx context.Context, r io.Reader, format string, dryRun bool) (*model.ImportReport, error)
+	Export(ctx context.Context, w io.Writer, format string) error
+}
+
+type catalog struct {
+	productRepo   *repositories.ProductRepository
+	categoryRepo  *repositories.CategoryRepository
+	attributeRepo *repositories.AttributeRepository
+	redis         *redis.Client
+}
+
+func NewCatalog(productRepo *repositories.ProductRepository, categoryRepo *repositories.CategoryRepository, attributeRepo *repositories.AttributeRepository, redis *redis.Client) CatalogService {
+	return &catalog{
+		productRepo:   productRepo,
+		categoryRepo:  categoryRepo,
+		attributeRepo: attributeRepo,
+		redis:         redis,
+	}
+}
+
+// importRow is a valid row waiting for its batch.
+type importRow struct {
+	line int
+	row  model.ImportRow
+}
+
+// rowReader returns the next row of a file with its line. A row that cannot be
+// read is returned with a message, io.EOF ends the file.
+type rowReader func() (line int, row model.ImportRow, invalid string, err error)
+
+// Import creates the products with a new SKU and updates the others in batches
+// of importBatchSize rows. Nothing is written on a dry run.
+func (c *catalog) Import(ctx context.Context, r io.Reader, format string, dryRun bool) (*model.ImportReport, error) {
+
+	next, err := newRowReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := c.categoryRepo.GetAllCategory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get categories")
+	}
+
+	categoryIDs := make(map[int]bool, len(categories))
+	for _, category := range categories {
+		categoryIDs[category.ID] = true
+	}
+
+	report := &model.ImportReport{DryRun: dryRun, Errors: []model.ImportRowError{}}
+	definitions := make(map[int][]entity.Attribute)
+	seen := make(map[string]int)
+	var batch []importRow
+	var changed []int
+
+	for {
+		line, row, invalid, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		report.Rows++
+		row.SKU = strings.TrimSpace(row.SKU)
+		if invalid == "" {
+			invalid = validateImportRow(row, categoryIDs)
+		}
+		// SKUs differing only in case are the same for the database
+		sku := strings.ToLower(row.SKU)
+		if invalid == "" && sku != "" {
+			if first, ok := seen[sku]; ok {
+				invalid = fmt.Sprintf("sku is already used on row %d", first)
+			}
+		}
+
+		if sku != "" {
+			if _, ok := seen[sku]; !ok {
+				seen[sku] = line
+			}
+		}
+
+		if invalid != "" {
+			report.Errors = append(report.Errors, model.ImportRowError{Row: line, SKU: row.SKU, Message: invalid})
+			continue
+		}
+
+		batch = append(batch, importRow{line: line, row: row})
+		if len(batch) == importBatchSize {
+			ids, err := c.importBatch(ctx, batch, definitions, dryRun, report)
+			if err != nil {
+				return nil, err
+			}
+			changed = append(changed, ids...)
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		ids, err := c.importBatch(ctx, batch, definitions, dryRun, report)
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, ids...)
+	}
+
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Row < report.Errors[j].Row
+	})
+	report.Failed = len(report.Errors)
+
+	if len(changed) > 0 {
+		for _, id := range changed {
+			c.redis.Del(ctx, fmt.Sprintf("product:%d", id))
+		}
+
+		c.redis.Del(ctx, "products")
+		c.redis.Del(ctx, "product/category")
+	}
+
+	return report, nil
+}
+
+// importBatch matches the rows of batch with the stored products, validates
+// their attributes against the definitions of their category, loaded once per
+// import in definitions, and writes them in one transaction. It returns the ids
+// of the updated products.
+func (c *catalog) importBatch(ctx context.Context, batch []importRow, definitions map[int][]entity.Attribute, dryRun bool, report *model.ImportReport) ([]int, error) {
+
+	skus := make([]string, len(batch))
+	for i, item := range batch {
+		skus[i] = item.row.SKU
+	}
+
+	existing, err := c.productRepo.GetProductsBySKUs(ctx, skus...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get products: %w", err)
+	}
+
+	products := make([]*entity.Product, 0, len(batch))
+	attributes := make([][]entity.ProductAttribute, 0, len(batch))
+	var updated []int
+	for _, item := range batch {
+		row := item.row
+		product := &entity.Product{
+			SKU:         row.SKU,
+			Name:        row.Name,
+			Description: row.Description,
+			Price:       row.Price,
+			CategoryID:  row.CategoryID,
+			Weight:      row.Weight,
+			Length:      row.Length,
+			Width:       row.Width,
+			Height:      row.Height,
+			Stock:       row.Stock,
+			Status:      row.Status,
+		}
+
+		stored := existing[strings.ToLower(row.SKU)]
+
+		// the attributes of a new product are required like in StoreProduct,
+		// an update without attributes keeps the stored ones
+		var values []entity.ProductAttribute
+		if stored == nil || row.Attributes != nil {
+			categoryDefinitions, ok := definitions[row.CategoryID]
+			if !ok {
+				categoryDefinitions, err = c.attributeRepo.GetAttributesByCategoryID(ctx, row.CategoryID)
+				if err != nil {
+					return nil, fmt.Errorf("cannot get attributes of category %d: %w", row.CategoryID, err)
+				}
+				definitions[row.CategoryID] = categoryDefinitions
+			}
+
+			values, err = validateAttributes(categoryDefinitions, row.Attributes)
+			if err != nil {
+				report.Errors = append(report.Errors, model.ImportRowError{Row: item.line, SKU: row.SKU, Message: err.Error()})
+				continue
+			}
+
+			if values == nil {
+				values = []entity.ProductAttribute{}
+			}
+		}
+
+		if stored != nil {
+			if stored.DeletedAt != nil {
+				report.Errors = append(report.Errors, model.ImportRowError{Row: item.line, SKU: row.SKU, Message: "product is deleted, restore it first"})
+				continue
+			}
+
+			if stored.CategoryID != row.CategoryID {
+				report.Errors = append(report.Errors, model.ImportRowError{Row: item.line, SKU: row.SKU, Message: "category of an existing product cannot change"})
+				continue
+			}
+
+			// empty columns keep the stored stock and status
+			if product.Stock == nil {
+				product.Stock = stored.Stock
+			}
+			if product.Status == "" {
+				product.Status = stored.Status
+			}
+
+			product.ID = stored.ID
+			updated = append(updated, stored.ID)
+			report.Updated++
+		} else {
+			if product.Status == "" {
+				product.Status = entity.ProductPublished
+			}
+			report.Created++
+		}
+
+		products = append(products, product)
+		attributes = append(attributes, values)
+	}
+
+	if dryRun || len(products) == 0 {
+		return nil, nil
+	}
+
+	if err := c.productRepo.UpsertProducts(ctx, products, attributes); err != nil {
+		return nil, fmt.Errorf("cannot import rows %d to %d: %w", batch[0].line, batch[len(batch)-1].line, err)
+	}
+
+	return updated, nil
+}
+
+// validateImportRow returns why row cannot be imported, or an empty string.
+func validateImportRow(row model.ImportRow, categoryIDs map[int]bool) string {
+
+	switch {
+	case row.SKU == "":
+		return "sku is required"
+	case strings.TrimSpace(row.Name) == "":
+		return "name is required"
+	case row.Price <= 0:
+		return "price must be greater than 0"
+	case !categoryIDs[row.CategoryID]:
+		return fmt.Sprintf("category %d not found", row.CategoryID)
+	case row.Weight < 0 || row.Length < 0 || row.Width < 0 || row.Height < 0:
+		return "weight and dimensions cannot be negative"
+	case row.Stock != nil && *row.Stock < 0:
+		return "stock cannot be negative"
+	}
+
+	switch row.Status {
+	case "", entity.ProductDraft, entity.ProductPublished, entity.ProductUnpublished:
+	default:
+		return "status must be draft, published or unpublished"
+	}
+
+	return ""
+}
+
+func newRowReader(r io.Reader, format string) (rowReader, error) {
+
+	switch format {
+	case FormatCSV:
+		return newCSVRowReader(r)
+	case FormatJSONL:
+		return newJSONLRowReader(r), nil
+	default:
+		return nil, fmt.Errorf("format must be csv or jsonl")
+	}
+}
+
+// newCSVRowReader reads a CSV file whose header names the columns. Only sku,
+// name, price and category_id are required. The attribute values are in the
+// columns named after the attribute code with attributeColumnPrefix, an empty
+// value leaves the attribute unset.
+func newCSVRowReader(r io.Reader) (rowReader, error) {
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %v", err)
+	}
+
+	known := make(map[string]bool, len(catalogColumns))
+	for _, name := range catalogColumns {
+		known[name] = true
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !known[name] && (!strings.HasPrefix(name, attributeColumnPrefix) || name == attributeColumnPrefix) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+
+	for _, name := range []string{"sku", "name", "price", "category_id"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	return func() (int, model.ImportRow, string, error) {
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			return 0, model.ImportRow{}, "", err
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+			return parseErr.StartLine, model.ImportRow{}, "wrong number of columns", nil
+		}
+		if err != nil {
+			return 0, model.ImportRow{}, "", fmt.Errorf("invalid csv: %v", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		value := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := model.ImportRow{
+			SKU:         value("sku"),
+			Name:        value("name"),
+			Description: value("description"),
+			Status:      value("status"),
+		}
+
+		for name := range columns {
+			code, ok := strings.CutPrefix(name, attributeColumnPrefix)
+			if !ok {
+				continue
+			}
+
+			if v := value(name); v != "" {
+				if row.Attributes == nil {
+					row.Attributes = make(map[string]any)
+				}
+				row.Attributes[code] = v
+			}
+		}
+
+		var invalid []string
+		number := func(name string, dest *float64) {
+			if v := value(name); v != "" {
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					invalid = append(invalid, name)
+					return
+				}
+				*dest = f
+			}
+		}
+
+		number("price", &row.Price)
+		number("weight", &row.Weight)
+		number("length", &row.Length)
+		number("width", &row.Width)
+		number("height", &row.Height)
+
+		if v := value("category_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				invalid = append(invalid, "category_id")
+			}
+			row.CategoryID = id
+		}
+
+		if v := value("stock"); v != "" {
+			stock, err := strconv.Atoi(v)
+			if err != nil {
+				invalid = append(invalid, "stock")
+			}
+			row.Stock = &stock
+		}
+
+		if len(invalid) > 0 {
+			return line, row, "invalid " + strings.Join(invalid, ", "), nil
+		}
+
+		return line, row, "", nil
+	}, nil
+}
+
+// newJSONLRowReader reads one JSON object per line, blank lines are skipped.
+func newJSONLRowReader(r io.Reader) rowReader {
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+
+	return func() (int, model.ImportRow, string, error) {
+
+		for scanner.Scan() {
+			line++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+
+			var row model.ImportRow
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&row); err != nil {
+				return line, row, "invalid json: " + err.Error(), nil
+			}
+
+			return line, row, "", nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			return 0, model.ImportRow{}, "", fmt.Errorf("cannot read line %d: %v", line+1, err)
+		}
+
+		return 0, model.ImportRow{}, "", io.EOF
+	}
+}
+
+// Export writes every product that is not deleted, in the columns read by
+// Import except the attributes, which an import without attributes keeps.
+// Products without a SKU need one before the file is imported again.
+func (c *catalog) Export(ctx context.Context, w io.Writer, format string) error {
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(catalogColumns); err != nil {
+			return err
+		}
+
+		err := c.productRepo.ExportProducts(ctx, func(product *entity.Product) error {
+			stock := ""
+			if product.Stock != nil {
+				stock = strconv.Itoa(*product.Stock)
+			}
+
+			return writer.Write([]string{
+				product.SKU,
+				product.Name,
+				product.Description,
+				strconv.FormatFloat(product.Price, 'f', -1, 64),
+				strconv.Itoa(product.CategoryID),
+				strconv.FormatFloat(product.Weight, 'f', -1, 64),
+				strconv.FormatFloat(product.Length, 'f', -1, 64),
+				strconv.FormatFloat(product.Width, 'f', -1, 64),
+				strconv.FormatFloat(product.Height, 'f', -1, 64),
+				stock,
+				product.Status,
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		return c.productRepo.ExportProducts(ctx, func(product *entity.Product) error {
+			return encoder.Encode(model.ImportRow{
+				SKU:         product.SKU,
+				Name:        product.Name,
+				Description: product.Description,
+				Price:       product.Price,
+				CategoryID:  product.CategoryID,
+				Weight:      product.Weight,
+				Length:      product.Length,
+				Width:       product.Width,
+				Height:      product.Height,
+				Stock:       product.Stock,
+				Status:      product.Status,
+			})
+		})
+	default:
+		return fmt.Errorf("format must be csv or jsonl")
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/aldotp/OnlineStore/internal/entity"
 	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/replica"
 	"github.com/aldotp/OnlineStore/internal/repositories"
 	"github.com/go-redis/redis/v8"
 )
@@ -18,6 +19,11 @@ type CategoryService interface {
 	GetCategoryByID(ctx context.Context, id int) (*entity.Category, error)
 	DeleteCategoryByID(ctx context.Context, id int) error
 	UpdateCategory(ctx context.Context, request model.UpdateCategoryRequest) error
+	GetCategoryTree(ctx context.Context) ([]*entity.Category, error)
+	GetBreadcrumbs(ctx context.Context, id int) ([]entity.Category, error)
+	MoveCategory(ctx context.Context, request model.MoveCategoryRequest) (*entity.Category, error)
+	GetDeletedCategories(ctx context.Context) ([]entity.Category, error)
+	RestoreCategory(ctx context.Context, id int) (*entity.Category, error)
 }
 
 type category struct {
@@ -38,7 +44,8 @@ func (c *category) GetCategories(ctx context.Context) ([]entity.Category, error)
 	}
 
 	if cachedCategories == "" {
-		categories, err := c.repo.GetAllCategory(ctx)
+		// filled from the primary, a lagging replica would cache stale categories
+		categories, err := c.repo.GetAllCategory(replica.WithPrimary(ctx))
 		if err != nil {
 			return nil, err
 		}
@@ -67,8 +74,33 @@ func (c *category) GetCategories(ctx context.Context) ([]entity.Category, error)
 
 func (c *category) StoreCategory(ctx context.Context, request model.CategoryRequest) (*entity.Category, error) {
 
+	existing, err := c.repo.GetCategoryByName(ctx, request.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil && existing.DeletedAt != nil {
+		return nil, fmt.Errorf("a deleted category is named %s, restore it or choose another name", request.Name)
+	}
+
+	if existing != nil {
+		return nil, fmt.Errorf("category already exists")
+	}
+
+	if request.ParentID != nil {
+		parent, err := c.repo.GetCategoryByID(ctx, *request.ParentID)
+		if err != nil {
+			return nil, err
+		}
+
+		if parent == nil {
+			return nil, fmt.Errorf("parent category not found")
+		}
+	}
+
 	category, err := c.repo.StoreCategory(ctx, &entity.Category{
-		Name: request.Name,
+		Name:     request.Name,
+		ParentID: request.ParentID,
 	})
 	if err != nil {
 		return nil, err
@@ -119,11 +151,30 @@ func (c *category) GetCategoryByID(ctx context.Context, id int) (*entity.Categor
 	return &category, nil
 }
 
+// DeleteCategoryByID soft deletes an empty category.
 func (c *category) DeleteCategoryByID(ctx context.Context, id int) error {
 
-	err := c.repo.DeleteCategoryByID(ctx, id)
+	hasChildren, err := c.repo.HasChildren(ctx, id)
 	if err != nil {
-		return err
+		return fmt.Errorf("cannot get subcategories")
+	}
+
+	if hasChildren {
+		return fmt.Errorf("category has subcategories, move or delete them first")
+	}
+
+	hasProducts, err := c.repo.HasProducts(ctx, id)
+	if err != nil {
+		return fmt.Errorf("cannot get products")
+	}
+
+	if hasProducts {
+		return fmt.Errorf("category has products, delete them first")
+	}
+
+	err = c.repo.DeleteCategoryByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("cannot delete category")
 	}
 
 	c.redis.Del(ctx, fmt.Sprintf("category:%d", id))
@@ -149,3 +200,139 @@ func (c *category) UpdateCategory(ctx context.Context, request model.UpdateCateg
 
 	return nil
 }
+
+// GetCategoryTree returns the root categories with their subcategories nested
+// in Children.
+func (c *category) GetCategoryTree(ctx context.Context) ([]*entity.Category, error) {
+
+	categories, err := c.GetCategories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int]*entity.Category, len(categories))
+	for i := range categories {
+		nodes[categories[i].ID] = &categories[i]
+	}
+
+	var roots []*entity.Category
+	for i := range categories {
+		node := &categories[i]
+		if node.ParentID != nil {
+			if parent, ok := nodes[*node.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	return roots, nil
+}
+
+// GetBreadcrumbs returns the path from the root category down to the category.
+func (c *category) GetBreadcrumbs(ctx context.Context, id int) ([]entity.Category, error) {
+
+	breadcrumbs, err := c.repo.GetAncestors(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get breadcrumbs")
+	}
+
+	if len(breadcrumbs) == 0 {
+		return nil, fmt.Errorf("category not found")
+	}
+
+	return breadcrumbs, nil
+}
+
+// MoveCategory moves a category with its subcategories below another parent,
+// refusing moves that would put a category below itself or break the attribute
+// rules of the new parent.
+func (c *category) MoveCategory(ctx context.Context, request model.MoveCategoryRequest) (*entity.Category, error) {
+
+	category, err := c.repo.GetCategoryByID(ctx, request.CategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get category")
+	}
+
+	if category == nil {
+		return nil, fmt.Errorf("category not found")
+	}
+
+	if request.ParentID != nil {
+		parent, err := c.repo.GetCategoryByID(ctx, *request.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get parent category")
+		}
+
+		if parent == nil {
+			return nil, fmt.Errorf("parent category not found")
+		}
+	}
+
+	refused, err := c.repo.MoveCategory(ctx, category.ID, request.ParentID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot move category")
+	}
+
+	if refused != "" {
+		return nil, fmt.Errorf("%s", refused)
+	}
+
+	c.redis.Del(ctx, fmt.Sprintf("category:%d", category.ID))
+	c.redis.Del(ctx, "categories")
+	c.redis.Del(ctx, "product/category")
+
+	moved, err := c.repo.GetCategoryByID(ctx, category.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get category")
+	}
+
+	return moved, nil
+}
+
+func (c *category) GetDeletedCategories(ctx context.Context) ([]entity.Category, error) {
+
+	categories, err := c.repo.GetDeletedCategories(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get deleted categories")
+	}
+
+	return categories, nil
+}
+
+// RestoreCategory brings a deleted category back to the tree. Its parent must
+// not be deleted. Only empty categories are deleted, so no product comes back
+// with it: deleted products are restored one by one with RestoreProduct.
+func (c *category) RestoreCategory(ctx context.Context, id int) (*entity.Category, error) {
+
+	category, err := c.repo.GetDeletedCategoryByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get category")
+	}
+
+	if category == nil {
+		return nil, fmt.Errorf("deleted category not found")
+	}
+
+	if category.ParentID != nil {
+		parent, err := c.repo.GetCategoryByID(ctx, *category.ParentID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get parent category")
+		}
+
+		if parent == nil {
+			return nil, fmt.Errorf("the parent category is deleted, restore it first")
+		}
+	}
+
+	if err := c.repo.RestoreCategory(ctx, category.ID); err != nil {
+		return nil, fmt.Errorf("cannot restore category")
+	}
+
+	c.redis.Del(ctx, fmt.Sprintf("category:%d", category.ID))
+	c.redis.Del(ctx, "categories")
+	c.redis.Del(ctx, "product/category")
+
+	return c.repo.GetCategoryByID(ctx, category.ID)
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
 	"github.com/aldotp/OnlineStore/internal/model"
@@ -10,55 +11,105 @@ import (
 )
 
 type CheckoutService interface {
-	Checkout(ctx context.Context, userID int) (*model.CheckoutResponse, error)
-	History(ctx context.Context, userID int) ([]model.CheckoutHistoryResponse, error)
+	Checkout(ctx context.Context, request model.CheckoutRequest, userID int) (*model.CheckoutResponse, error)
+	History(ctx context.Context, userID int, filter entity.OrderFilter) (*model.CheckoutHistoryListResponse, error)
+	GetOrder(ctx context.Context, userID, id int) (*model.OrderResponse, error)
 }
 
 type checkout struct {
 	orderRepo       *repositories.OrderRepository
 	cartRepo        *repositories.CartRepository
 	orderDetailRepo *repositories.OrderDetailRepository
+	addressRepo     *repositories.AddressRepository
+	productRepo     *repositories.ProductRepository
+	variantRepo     *repositories.ProductVariantRepository
 	paymentSvc      PaymentService
+	shippingSvc     ShippingService
 }
 
-func NewCheckout(orderRepo *repositories.OrderRepository, cartRepo *repositories.CartRepository, orderDetailRepo *repositories.OrderDetailRepository, paymentSvc PaymentService) CheckoutService {
+func NewCheckout(orderRepo *repositories.OrderRepository, cartRepo *repositories.CartRepository, orderDetailRepo *repositories.OrderDetailRepository, addressRepo *repositories.AddressRepository, productRepo *repositories.ProductRepository, variantRepo *repositories.ProductVariantRepository, paymentSvc PaymentService, shippingSvc ShippingService) CheckoutService {
 	return &checkout{
 		orderRepo:       orderRepo,
 		cartRepo:        cartRepo,
 		orderDetailRepo: orderDetailRepo,
+		addressRepo:     addressRepo,
+		productRepo:     productRepo,
+		variantRepo:     variantRepo,
 		paymentSvc:      paymentSvc,
+		shippingSvc:     shippingSvc,
 	}
 }
 
-func (c *checkout) Checkout(ctx context.Context, userID int) (*model.CheckoutResponse, error) {
+func (c *checkout) Checkout(ctx context.Context, request model.CheckoutRequest, userID int) (*model.CheckoutResponse, error) {
+
+	shippingAddress, err := resolveShippingAddress(ctx, c.addressRepo, request.AddressID, request.ShippingAddress, userID)
+	if err != nil {
+		return nil, err
+	}
 
 	// start transaction
 	tx, err := c.orderRepo.BeginTransaction(ctx)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot begin transaction")
 	}
 
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
 
 	cartItems, err := c.cartRepo.GetCartItemsByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get cart items")
 	}
 
+	if len(cartItems) == 0 {
+		return nil, invalidRequest("cart is empty")
+	}
+
+	confirmed := make(map[entity.CartLine]float64, len(request.ConfirmedPrices))
+	for _, price := range request.ConfirmedPrices {
+		confirmed[entity.CartLine{ProductID: price.ProductID, VariantID: price.VariantID}] = price.Price
+	}
+
+	markPriceChanges(cartItems)
+	now := time.Now().UTC()
+	for _, item := range cartItems {
+		if item.ProductDeleted || !item.Product.Visible(now) {
+			return nil, invalidRequest("product %d is no longer available", item.ProductID)
+		}
+
+		// a price that changed again since it was confirmed must be confirmed again
+		price, ok := confirmed[entity.CartLine{ProductID: item.ProductID, VariantID: item.VariantID}]
+		if item.PriceChanged && (!ok || roundAmount(price) != roundAmount(item.UnitPrice())) {
+			return nil, invalidRequest("the price of %s changed, review the cart and confirm the price changes", item.Product.Name)
+		}
+
+		// lines added before the product got variants
+		if item.VariantID == 0 {
+			if _, err := resolveVariant(ctx, c.variantRepo, &item.Product, 0); err != nil {
+				return nil, invalidRequest("select a variant of %s", item.Product.Name)
+			}
+		}
+	}
+
+	shippingMethod, shippingCost, err := c.shippingSvc.Rate(ctx, request.ShippingMethodID, cartItems, shippingAddress)
+	if err != nil {
+		return nil, err
+	}
+
 	var totalAmount float64
 	var count int = 0
 	for _, item := range cartItems {
-		totalAmount += float64(item.Quantity) * item.Product.Price
+		totalAmount += float64(item.Quantity) * item.UnitPrice()
 		count += item.Quantity
 	}
 
+	totalAmount += shippingCost
+
 	order := &entity.Order{
-		UserID:      userID,
-		TotalAmount: totalAmount,
+		UserID:           userID,
+		TotalAmount:      totalAmount,
+		ShippingMethodID: shippingMethod.ID,
+		ShippingCost:     shippingCost,
 	}
 
 	createdOrder, err := c.orderRepo.CreateOrderWithTransaction(ctx, tx, order)
@@ -70,22 +121,43 @@ func (c *checkout) Checkout(ctx context.Context, userID int) (*model.CheckoutRes
 		orderDetail := &entity.OrderDetail{
 			OrderID:   createdOrder.ID,
 			ProductID: item.Product.ID,
+			VariantID: item.VariantID,
 			Quantity:  item.Quantity,
-			Price:     item.Product.Price,
+			Price:     item.UnitPrice(),
 		}
 
 		err := c.orderDetailRepo.CreateOrderDetailWithTransaction(ctx, tx, orderDetail)
 		if err != nil {
 			return nil, fmt.Errorf("cannot create order detail")
 		}
+
+		var inStock bool
+		if item.VariantID != 0 {
+			inStock, err = c.variantRepo.DecreaseStockWithTransaction(ctx, tx, item.VariantID, item.Quantity)
+		} else {
+			inStock, err = c.productRepo.DecreaseStockWithTransaction(ctx, tx, item.Product.ID, item.Quantity)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot update stock")
+		}
+
+		if !inStock {
+			return nil, invalidRequest("insufficient stock for product %s", item.Product.Name)
+		}
+	}
+
+	shippingAddress.OrderID = createdOrder.ID
+	err = c.orderRepo.CreateOrderAddressWithTransaction(ctx, tx, shippingAddress)
+	if err != nil {
+		return nil, fmt.Errorf("cannot store shipping address")
 	}
 
 	paymentStatus := c.paymentSvc.ProcessPayment(ctx, totalAmount)
 	if paymentStatus != "success" {
-		return nil, fmt.Errorf("payment failed")
+		return nil, invalidRequest("payment failed")
 	}
 
-	err = c.orderRepo.UpdateOrderStatusWithTransaction(ctx, tx, createdOrder.ID, "paid")
+	err = c.orderRepo.UpdateOrderStatusWithTransaction(ctx, tx, createdOrder.ID, entity.OrderStatusPaid)
 	if err != nil {
 		return nil, fmt.Errorf("cannot update order status")
 	}
@@ -101,36 +173,57 @@ func (c *checkout) Checkout(ctx context.Context, userID int) (*model.CheckoutRes
 	}
 
 	return &model.CheckoutResponse{
-		CartItems:    cartItems,
-		Total:        count,
-		TotalProduct: count,
-		TotalPrice:   totalAmount,
+		OrderID:         createdOrder.ID,
+		CartItems:       cartItems,
+		Total:           count,
+		TotalProduct:    count,
+		TotalPrice:      totalAmount,
+		ShippingMethod:  shippingMethod.Name,
+		ShippingCost:    shippingCost,
+		ShippingAddress: shippingAddress,
 	}, nil
 
 }
 
-func (c *checkout) History(ctx context.Context, userID int) ([]model.CheckoutHistoryResponse, error) {
+// History returns a page of the orders of the user, newest first, with their
+// lines and shipping address.
+func (c *checkout) History(ctx context.Context, userID int, filter entity.OrderFilter) (*model.CheckoutHistoryListResponse, error) {
 
-	orders, err := c.orderRepo.GetOrdersByUserID(ctx, userID)
+	filter.UserID = userID
+	list, err := listOrders(ctx, c.orderRepo, filter)
 	if err != nil {
-		return nil, fmt.Errorf("cannot get orders")
+		return nil, err
+	}
+
+	orderIDs := make([]int, len(list.Orders))
+	for i, order := range list.Orders {
+		orderIDs[i] = order.ID
 	}
 
-	var checkoutHistoryResponse []model.CheckoutHistoryResponse
+	orderDetails, err := c.orderDetailRepo.GetOrderDetailsByOrderIDs(ctx, orderIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order details")
+	}
 
-	for _, order := range orders {
+	shippingAddresses, err := c.orderRepo.GetOrderAddressesByOrderIDs(ctx, orderIDs...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipping address")
+	}
 
-		orderDetails, err := c.orderDetailRepo.GetOrderDetailsByOrderID(ctx, order.ID)
-		if err != nil {
-			return nil, fmt.Errorf("cannot get order details")
-		}
+	response := &model.CheckoutHistoryListResponse{
+		Orders:     make([]model.CheckoutHistoryResponse, 0, len(list.Orders)),
+		Pagination: list.Pagination,
+	}
+
+	for _, order := range list.Orders {
 
 		var orderDetailResponses []*model.OrderDetail
 
-		for _, detail := range orderDetails {
+		for _, detail := range orderDetails[order.ID] {
 			orderDetailResponses = append(orderDetailResponses, &model.OrderDetail{
 				ID:          detail.ID,
 				ProductID:   detail.ProductID,
+				VariantID:   detail.VariantID,
 				Name:        detail.Product.Name,
 				Description: detail.Product.Description,
 				Quantity:    detail.Quantity,
@@ -138,18 +231,46 @@ func (c *checkout) History(ctx context.Context, userID int) ([]model.CheckoutHis
 			})
 		}
 
-		checkoutHistoryResponse = append(checkoutHistoryResponse, model.CheckoutHistoryResponse{
-			ID:           order.ID,
-			UserID:       order.UserID,
-			TotalProduct: len(orderDetails),
-			TotalPrice:   order.TotalAmount,
-			CreatedAt:    order.CreatedAt.String(),
-			UpdatedAt:    order.UpdatedAt.String(),
-			Status:       order.Status,
-			OrderDetails: orderDetailResponses,
+		response.Orders = append(response.Orders, model.CheckoutHistoryResponse{
+			ID:               order.ID,
+			UserID:           order.UserID,
+			TotalProduct:     len(orderDetails[order.ID]),
+			TotalPrice:       order.TotalAmount,
+			ShippingMethodID: order.ShippingMethodID,
+			ShippingCost:     order.ShippingCost,
+			CreatedAt:        order.CreatedAt.String(),
+			UpdatedAt:        order.UpdatedAt.String(),
+			Status:           order.Status,
+			OrderDetails:     orderDetailResponses,
+			ShippingAddress:  shippingAddresses[order.ID],
 		})
 	}
 
-	return checkoutHistoryResponse, nil
+	return response, nil
+}
+
+// GetOrder returns the order of the user with its lines, the orders of other
+// users are not found.
+func (c *checkout) GetOrder(ctx context.Context, userID, id int) (*model.OrderResponse, error) {
+
+	order, err := c.orderRepo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil || order.UserID != userID {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	details, err := c.orderDetailRepo.GetOrderDetailsByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order details")
+	}
+
+	address, err := c.orderRepo.GetOrderAddressByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipping address")
+	}
 
+	return orderResponse(order, details, address), nil
 }
@@ -0,0 +1,18 @@
+package services
+
+import "fmt"
+
+// InvalidRequestError is returned for the requests that cannot be applied, such
+// as a bad quantity or a product that is not available, as opposed to the
+// internal errors.
+type InvalidRequestError struct {
+	message string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.message
+}
+
+func invalidRequest(format string, args ...any) error {
+	return &InvalidRequestError{message: fmt.Sprintf(format, args...)}
+}
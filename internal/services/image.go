@@ -0,0 +1,293 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/aldotp/OnlineStore/internal/storage"
+	"github.com/go-redis/redis/v8"
+)
+
+// imageExtensions are the accepted image content types with the extension of
+// their files.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// maxImagePixels bounds the decoded size of an upload.
+const maxImagePixels = 50_000_000
+
+type ImageService interface {
+	UploadImage(ctx context.Context, productID int, data []byte) (*model.ProductImage, error)
+	GetImages(ctx context.Context, productIDs ...int) (map[int][]model.ProductImage, error)
+	ReorderImages(ctx context.Context, request model.ReorderImagesRequest) ([]model.ProductImage, error)
+	DeleteImage(ctx context.Context, productID int, imageID int) error
+	DeleteProductImages(ctx context.Context, productID int) error
+}
+
+type productImage struct {
+	repo        *repositories.ProductImageRepository
+	productRepo *repositories.ProductRepository
+	storage     storage.Storage
+	redis       *redis.Client
+	maxSize     int64
+}
+
+func NewImage(repo *repositories.ProductImageRepository, productRepo *repositories.ProductRepository, storage storage.Storage, redis *redis.Client, maxSize int64) ImageService {
+	return &productImage{
+		repo:        repo,
+		productRepo: productRepo,
+		storage:     storage,
+		redis:       redis,
+		maxSize:     maxSize,
+	}
+}
+
+// UploadImage validates the image, stores it with its thumbnails and appends it
+// to the images of the product.
+func (p *productImage) UploadImage(ctx context.Context, productID int, data []byte) (*model.ProductImage, error) {
+
+	product, err := p.productRepo.GetProductByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("image is empty")
+	}
+
+	if p.maxSize > 0 && int64(len(data)) > p.maxSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", p.maxSize)
+	}
+
+	// the content type is detected from the data, the one sent by the client is ignored
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported image type %s", contentType)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image")
+	}
+
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image dimensions are too large")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image")
+	}
+
+	thumbs, err := thumbnails(img, contentType == "image/jpeg")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create thumbnails")
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create image name")
+	}
+
+	image := &entity.ProductImage{
+		ProductID:   productID,
+		Key:         fmt.Sprintf("products/%d/%s%s", productID, token, ext),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       config.Width,
+		Height:      config.Height,
+	}
+
+	if err := p.storage.Put(ctx, image.Key, data, contentType); err != nil {
+		log.Printf("cannot store image %s: %v", image.Key, err)
+		return nil, fmt.Errorf("cannot store image")
+	}
+
+	for name, thumb := range thumbs {
+		key, thumbType := thumbnailKey(image, name)
+		if err := p.storage.Put(ctx, key, thumb, thumbType); err != nil {
+			log.Printf("cannot store thumbnail %s: %v", key, err)
+			p.removeFiles(ctx, image)
+			return nil, fmt.Errorf("cannot store image")
+		}
+	}
+
+	stored, err := p.repo.StoreImage(ctx, image)
+	if err != nil {
+		p.removeFiles(ctx, image)
+		return nil, fmt.Errorf("cannot save image")
+	}
+
+	p.invalidateProduct(ctx, productID)
+
+	response := p.imageResponse(stored)
+	return &response, nil
+}
+
+func (p *productImage) GetImages(ctx context.Context, productIDs ...int) (map[int][]model.ProductImage, error) {
+
+	images, err := p.repo.GetImagesByProductIDs(ctx, productIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make(map[int][]model.ProductImage, len(images))
+	for productID, list := range images {
+		for _, image := range list {
+			responses[productID] = append(responses[productID], p.imageResponse(image))
+		}
+	}
+
+	return responses, nil
+}
+
+// ReorderImages puts the images of the product in the order of the request,
+// which must list each of them once.
+func (p *productImage) ReorderImages(ctx context.Context, request model.ReorderImagesRequest) ([]model.ProductImage, error) {
+
+	images, err := p.repo.GetImagesByProductIDs(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get images")
+	}
+
+	existing := make(map[int]bool, len(images[request.ProductID]))
+	for _, image := range images[request.ProductID] {
+		existing[image.ID] = true
+	}
+
+	if len(request.ImageIDs) != len(existing) {
+		return nil, fmt.Errorf("image_ids must list the %d images of the product", len(existing))
+	}
+
+	seen := make(map[int]bool, len(request.ImageIDs))
+	for _, id := range request.ImageIDs {
+		if !existing[id] || seen[id] {
+			return nil, fmt.Errorf("image %d is unknown or listed twice", id)
+		}
+		seen[id] = true
+	}
+
+	if err := p.repo.ReorderImages(ctx, request.ProductID, request.ImageIDs); err != nil {
+		return nil, fmt.Errorf("cannot reorder images")
+	}
+
+	p.invalidateProduct(ctx, request.ProductID)
+
+	responses, err := p.GetImages(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get images")
+	}
+
+	return responses[request.ProductID], nil
+}
+
+func (p *productImage) DeleteImage(ctx context.Context, productID int, imageID int) error {
+
+	image, err := p.repo.GetImageByID(ctx, imageID)
+	if err != nil {
+		return fmt.Errorf("cannot get image")
+	}
+
+	if image == nil || image.ProductID != productID {
+		return fmt.Errorf("image not found")
+	}
+
+	if err := p.repo.DeleteImage(ctx, image.ID); err != nil {
+		return fmt.Errorf("cannot delete image")
+	}
+
+	p.removeFiles(ctx, image)
+	p.invalidateProduct(ctx, productID)
+
+	return nil
+}
+
+// DeleteProductImages removes all images of a product that is being deleted.
+func (p *productImage) DeleteProductImages(ctx context.Context, productID int) error {
+
+	images, err := p.repo.GetImagesByProductIDs(ctx, productID)
+	if err != nil {
+		return fmt.Errorf("cannot get images")
+	}
+
+	for _, image := range images[productID] {
+		if err := p.repo.DeleteImage(ctx, image.ID); err != nil {
+			return fmt.Errorf("cannot delete image")
+		}
+
+		p.removeFiles(ctx, image)
+	}
+
+	return nil
+}
+
+func (p *productImage) imageResponse(image *entity.ProductImage) model.ProductImage {
+
+	thumbs := make(map[string]string, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		key, _ := thumbnailKey(image, size.Name)
+		thumbs[size.Name] = p.storage.URL(key)
+	}
+
+	return model.ProductImage{
+		ID:         image.ID,
+		URL:        p.storage.URL(image.Key),
+		Thumbnails: thumbs,
+		Width:      image.Width,
+		Height:     image.Height,
+		Position:   image.Position,
+	}
+}
+
+// removeFiles deletes the original and the thumbnails of an image, failures are
+// only logged as the files are no longer referenced.
+func (p *productImage) removeFiles(ctx context.Context, image *entity.ProductImage) {
+
+	keys := []string{image.Key}
+	for _, size := range thumbnailSizes {
+		key, _ := thumbnailKey(image, size.Name)
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		if err := p.storage.Delete(ctx, key); err != nil {
+			log.Printf("cannot delete %s: %v", key, err)
+		}
+	}
+}
+
+func (p *productImage) invalidateProduct(ctx context.Context, productID int) {
+	p.redis.Del(ctx, fmt.Sprintf("product:%d", productID))
+	p.redis.Del(ctx, "products")
+}
+
+// thumbnailKey returns the key and content type of a thumbnail of the image.
+// JPEG images get JPEG thumbnails, the others PNG thumbnails.
+func thumbnailKey(image *entity.ProductImage, name string) (string, string) {
+
+	base := strings.TrimSuffix(image.Key, imageExtensions[image.ContentType])
+	if image.ContentType == "image/jpeg" {
+		return base + "_" + name + ".jpg", "image/jpeg"
+	}
+
+	return base + "_" + name + ".png", "image/png"
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/aldotp/OnlineStore/internal/model"
+)
+
+// Notifier delivers notifications to users, e.g. by email or push.
+type Notifier interface {
+	Notify(ctx context.Context, notification model.Notification) error
+}
+
+type logNotifier struct {
+}
+
+// NewLogNotifier returns a Notifier that writes notifications to the log.
+// Replace it with your actual email or push provider.
+func NewLogNotifier() Notifier {
+	return &logNotifier{}
+}
+
+func (l *logNotifier) Notify(ctx context.Context, notification model.Notification) error {
+
+	data, err := json.Marshal(notification.Data)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("notification %s for user %d: %s", notification.Type, notification.UserID, data)
+	return nil
+}
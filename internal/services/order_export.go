@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/aldotp/OnlineStore/internal/xlsx"
+)
+
+// orderExportColumns are the columns of the CSV and XLSX order exports, one
+// row per order line with the order totals repeated.
+var orderExportColumns = []string{"order_id", "created_at", "user_id", "status", "currency", "product_id", "variant_id", "sku", "product_name", "quantity", "unit_price", "line_total", "order_subtotal", "shipping_cost", "order_total"}
+
+// OrderExportService feeds the orders to accounting, on request and as daily
+// files.
+type OrderExportService interface {
+	Export(ctx context.Context, w io.Writer, format string, from, to time.Time) error
+	WriteDailyFile(ctx context.Context) error
+}
+
+type orderExport struct {
+	repo     *repositories.OrderRepository
+	currency string
+	dir      string
+	format   string
+}
+
+// NewOrderExport labels the amounts with currency. The daily files are written
+// to dir in format, an empty dir disables them.
+func NewOrderExport(repo *repositories.OrderRepository, currency, dir, format string) OrderExportService {
+	if format == "" {
+		format = FormatCSV
+	}
+
+	return &orderExport{
+		repo:     repo,
+		currency: currency,
+		dir:      dir,
+		format:   format,
+	}
+}
+
+// Export writes the orders placed from from until to with their lines.
+func (o *orderExport) Export(ctx context.Context, w io.Writer, format string, from, to time.Time) error {
+
+	if !to.After(from) {
+		return fmt.Errorf("to must be after from")
+	}
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(orderExportColumns); err != nil {
+			return err
+		}
+
+		err := o.repo.ExportOrders(ctx, from, to, func(order *entity.Order) error {
+			for _, row := range orderExportRows(o.orderExport(order)) {
+				record := make([]string, len(row))
+				for i, value := range row {
+					record[i] = csvValue(value)
+				}
+
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		return o.repo.ExportOrders(ctx, from, to, func(order *entity.Order) error {
+			return encoder.Encode(o.orderExport(order))
+		})
+	case FormatXLSX:
+		writer := xlsx.NewWriter(w)
+		if err := writer.AddSheet("Orders"); err != nil {
+			return err
+		}
+
+		header := make([]any, len(orderExportColumns))
+		for i, column := range orderExportColumns {
+			header[i] = column
+		}
+		if err := writer.WriteRow(header...); err != nil {
+			return err
+		}
+
+		var orders int
+		var totals model.OrderExport
+		err := o.repo.ExportOrders(ctx, from, to, func(order *entity.Order) error {
+			export := o.orderExport(order)
+			orders++
+			totals.Subtotal += export.Subtotal
+			totals.ShippingCost += export.ShippingCost
+			totals.TotalAmount += export.TotalAmount
+
+			for _, row := range orderExportRows(export) {
+				if err := writer.WriteRow(row...); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := writer.AddSheet("Totals"); err != nil {
+			return err
+		}
+		if err := writer.WriteRow("currency", "orders", "subtotal", "shipping_cost", "total"); err != nil {
+			return err
+		}
+		if err := writer.WriteRow(o.currency, orders, roundAmount(totals.Subtotal), roundAmount(totals.ShippingCost), roundAmount(totals.TotalAmount)); err != nil {
+			return err
+		}
+
+		return writer.Close()
+	default:
+		return fmt.Errorf("format must be csv, jsonl or xlsx")
+	}
+}
+
+// WriteDailyFile writes the orders of each day (UTC) to
+// orders-YYYY-MM-DD.{format}, from the day after the last file in the directory
+// until the previous day, so the days missed while the service was down are
+// exported too. Without files only the previous day is written. A file that
+// already exists is kept, so the job can run more than once a day.
+func (o *orderExport) WriteDailyFile(ctx context.Context) error {
+
+	if o.dir == "" {
+		return nil
+	}
+
+	yesterday := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+
+	day, err := o.firstMissingDay(yesterday)
+	if err != nil {
+		return err
+	}
+
+	for ; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		if err := o.writeDayFile(ctx, day); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dailyFilePath returns the path of the export file of day.
+func (o *orderExport) dailyFilePath(day time.Time) string {
+	return filepath.Join(o.dir, fmt.Sprintf("orders-%s.%s", day.Format("2006-01-02"), o.format))
+}
+
+// firstMissingDay returns the day after the last daily file in the directory,
+// yesterday when it has none.
+func (o *orderExport) firstMissingDay(yesterday time.Time) (time.Time, error) {
+
+	entries, err := os.ReadDir(o.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return yesterday, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read export directory: %w", err)
+	}
+
+	var last time.Time
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), "orders-")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		name, ok = strings.CutSuffix(name, "."+o.format)
+		if !ok {
+			continue
+		}
+
+		day, err := time.Parse("2006-01-02", name)
+		if err == nil && day.After(last) {
+			last = day
+		}
+	}
+
+	if last.IsZero() {
+		return yesterday, nil
+	}
+
+	return last.AddDate(0, 0, 1), nil
+}
+
+// writeDayFile writes the orders of day unless its file exists.
+func (o *orderExport) writeDayFile(ctx context.Context, day time.Time) error {
+
+	path := o.dailyFilePath(day)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot check export file: %w", err)
+	}
+
+	if err := os.MkdirAll(o.dir, 0o755); err != nil {
+		return fmt.Errorf("cannot create export directory: %w", err)
+	}
+
+	// the file only gets its name once complete
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("cannot create export file: %w", err)
+	}
+
+	err = o.Export(ctx, f, o.format, day, day.AddDate(0, 0, 1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot export orders of %s: %w", day.Format("2006-01-02"), err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (o *orderExport) orderExport(order *entity.Order) model.OrderExport {
+
+	export := model.OrderExport{
+		ID:           order.ID,
+		UserID:       order.UserID,
+		Status:       order.Status,
+		Currency:     o.currency,
+		ShippingCost: order.ShippingCost,
+		TotalAmount:  order.TotalAmount,
+		CreatedAt:    order.CreatedAt,
+		Items:        make([]model.OrderExportItem, 0, len(order.OrderDetails)),
+	}
+
+	for _, detail := range order.OrderDetails {
+		lineTotal := roundAmount(float64(detail.Quantity) * detail.Price)
+		export.Subtotal += lineTotal
+		export.Items = append(export.Items, model.OrderExportItem{
+			ProductID: detail.ProductID,
+			VariantID: detail.VariantID,
+			SKU:       detail.SKU,
+			Name:      detail.Product.Name,
+			Quantity:  detail.Quantity,
+			UnitPrice: detail.Price,
+			LineTotal: lineTotal,
+		})
+	}
+	export.Subtotal = roundAmount(export.Subtotal)
+
+	return export
+}
+
+// orderExportRows returns the rows of order in orderExportColumns, an order
+// without lines still gets a row.
+func orderExportRows(order model.OrderExport) [][]any {
+
+	row := func(item *model.OrderExportItem) []any {
+		values := []any{order.ID, order.CreatedAt, order.UserID, order.Status, order.Currency, nil, nil, nil, nil, nil, nil, nil, order.Subtotal, order.ShippingCost, order.TotalAmount}
+		if item != nil {
+			var variantID any
+			if item.VariantID != 0 {
+				variantID = item.VariantID
+			}
+			copy(values[5:12], []any{item.ProductID, variantID, item.SKU, item.Name, item.Quantity, item.UnitPrice, item.LineTotal})
+		}
+		return values
+	}
+
+	if len(order.Items) == 0 {
+		return [][]any{row(nil)}
+	}
+
+	rows := make([][]any, len(order.Items))
+	for i := range order.Items {
+		rows[i] = row(&order.Items[i])
+	}
+
+	return rows
+}
+
+func csvValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
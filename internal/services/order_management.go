@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+// maxBulkOrders bounds the orders of one bulk status change.
+const maxBulkOrders = 100
+
+// orderTransitions lists the statuses an admin can move an order to from its
+// current status. Orders are shipped by creating their shipments, which keeps
+// the shipped quantities right, so only a shipped order can be marked delivered
+// by hand. Delivered and cancelled orders are final.
+var orderTransitions = map[string][]string{
+	entity.OrderStatusPending: {entity.OrderStatusPaid, entity.OrderStatusCancelled},
+	entity.OrderStatusPaid:    {entity.OrderStatusCancelled},
+	entity.OrderStatusShipped: {entity.OrderStatusDelivered},
+}
+
+// OrderManagementService lets admins browse every order, annotate them and
+// change their status.
+type OrderManagementService interface {
+	ListOrders(ctx context.Context, filter entity.OrderFilter) (*model.OrderListResponse, error)
+	GetOrder(ctx context.Context, id int) (*model.OrderResponse, error)
+	AddNote(ctx context.Context, authorID int, request model.OrderNoteRequest) (*entity.OrderNote, error)
+	ChangeStatus(ctx context.Context, authorID int, request model.OrderStatusRequest) (*model.OrderStatusResult, error)
+}
+
+type orderManagement struct {
+	orderRepo       *repositories.OrderRepository
+	orderDetailRepo *repositories.OrderDetailRepository
+	userRepo        *repositories.UserRepository
+	reportRepo      *repositories.ReportRepository
+	paymentSvc      PaymentService
+}
+
+func NewOrderManagement(orderRepo *repositories.OrderRepository, orderDetailRepo *repositories.OrderDetailRepository, userRepo *repositories.UserRepository, reportRepo *repositories.ReportRepository, paymentSvc PaymentService) OrderManagementService {
+	return &orderManagement{
+		orderRepo:       orderRepo,
+		orderDetailRepo: orderDetailRepo,
+		userRepo:        userRepo,
+		reportRepo:      reportRepo,
+		paymentSvc:      paymentSvc,
+	}
+}
+
+func (o *orderManagement) ListOrders(ctx context.Context, filter entity.OrderFilter) (*model.OrderListResponse, error) {
+	return listOrders(ctx, o.orderRepo, filter)
+}
+
+// GetOrder returns the order with its customer, lines and notes.
+func (o *orderManagement) GetOrder(ctx context.Context, id int) (*model.OrderResponse, error) {
+
+	order, err := o.orderRepo.GetOrderByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	details, err := o.orderDetailRepo.GetOrderDetailsByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order details")
+	}
+
+	address, err := o.orderRepo.GetOrderAddressByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipping address")
+	}
+
+	notes, err := o.orderRepo.GetOrderNotes(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order notes")
+	}
+
+	response := orderResponse(order, details, address)
+	response.Notes = notes
+
+	if order.UserID != 0 {
+		user, err := o.userRepo.GetUserByID(ctx, order.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get customer")
+		}
+
+		if user != nil {
+			response.Customer = &model.OrderCustomer{ID: user.ID, Username: user.Username, Email: user.Email}
+		}
+	}
+
+	return response, nil
+}
+
+func (o *orderManagement) AddNote(ctx context.Context, authorID int, request model.OrderNoteRequest) (*entity.OrderNote, error) {
+
+	text := strings.TrimSpace(request.Note)
+	if text == "" {
+		return nil, fmt.Errorf("note is required")
+	}
+
+	order, err := o.orderRepo.GetOrderByID(ctx, request.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	note := &entity.OrderNote{OrderID: order.ID, AuthorID: authorID, Note: text}
+	if err := o.orderRepo.StoreOrderNote(ctx, nil, note); err != nil {
+		return nil, fmt.Errorf("cannot store note")
+	}
+
+	return note, nil
+}
+
+// ChangeStatus moves every order it can to the status and reports the others.
+// Each change is recorded as a note. Cancelled orders are put back in stock and
+// refunded when they were paid.
+func (o *orderManagement) ChangeStatus(ctx context.Context, authorID int, request model.OrderStatusRequest) (*model.OrderStatusResult, error) {
+
+	if !validOrderStatus(request.Status) {
+		return nil, fmt.Errorf("invalid status %s", request.Status)
+	}
+
+	if len(request.OrderIDs) == 0 {
+		return nil, fmt.Errorf("order_ids is required")
+	}
+
+	if len(request.OrderIDs) > maxBulkOrders {
+		return nil, fmt.Errorf("at most %d orders can be changed at once", maxBulkOrders)
+	}
+
+	result := &model.OrderStatusResult{Updated: []int{}, Failed: []model.OrderStatusFailure{}}
+	seen := make(map[int]bool, len(request.OrderIDs))
+	for _, id := range request.OrderIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if err := o.changeStatus(ctx, authorID, id, request.Status, strings.TrimSpace(request.Note)); err != nil {
+			result.Failed = append(result.Failed, model.OrderStatusFailure{OrderID: id, Message: err.Error()})
+			continue
+		}
+
+		result.Updated = append(result.Updated, id)
+	}
+
+	return result, nil
+}
+
+func (o *orderManagement) changeStatus(ctx context.Context, authorID, id int, status, text string) error {
+
+	order, err := o.orderRepo.GetOrderByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("cannot get order")
+	}
+
+	if order == nil {
+		return fmt.Errorf("order not found")
+	}
+
+	if order.Status == status {
+		return fmt.Errorf("order is already %s", status)
+	}
+
+	allowed := false
+	for _, next := range orderTransitions[order.Status] {
+		allowed = allowed || next == status
+	}
+
+	if !allowed {
+		return fmt.Errorf("cannot change a %s order to %s", order.Status, status)
+	}
+
+	tx, err := o.orderRepo.BeginTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	updated, err := o.orderRepo.UpdateOrderStatusFromWithTransaction(ctx, tx, order.ID, order.Status, status)
+	if err != nil {
+		return fmt.Errorf("cannot update order status")
+	}
+
+	if !updated {
+		return fmt.Errorf("order status changed meanwhile, try again")
+	}
+
+	if status == entity.OrderStatusCancelled {
+		if err := o.orderRepo.RestockOrderWithTransaction(ctx, tx, order.ID); err != nil {
+			return fmt.Errorf("cannot restock order")
+		}
+	}
+
+	message := fmt.Sprintf("status changed from %s to %s", order.Status, status)
+	if text != "" {
+		message += ": " + text
+	}
+
+	if err := o.orderRepo.StoreOrderNote(ctx, tx, &entity.OrderNote{OrderID: order.ID, AuthorID: authorID, Note: message}); err != nil {
+		return fmt.Errorf("cannot store note")
+	}
+
+	// the refund cannot be rolled back with the transaction, it is made once
+	// the cancellation is committed and its intent is recorded with it
+	refund := status == entity.OrderStatusCancelled && order.Status != entity.OrderStatusPending
+	if refund {
+		note := fmt.Sprintf("refund of %.2f pending", order.TotalAmount)
+		if err := o.orderRepo.StoreOrderNote(ctx, tx, &entity.OrderNote{OrderID: order.ID, AuthorID: authorID, Note: note}); err != nil {
+			return fmt.Errorf("cannot store note")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed")
+	}
+
+	// paid and cancelled orders move in and out of the sales reports
+	if err := o.reportRepo.ReopenSalesDays(ctx, order.CreatedAt); err != nil {
+		log.Printf("cannot reopen sales of order %d: %v", order.ID, err)
+	}
+
+	if refund {
+		return o.refund(ctx, authorID, order)
+	}
+
+	return nil
+}
+
+// refund refunds a cancelled order and records the outcome in its notes. A
+// failed refund leaves the pending note for an admin to settle with the payment
+// gateway.
+func (o *orderManagement) refund(ctx context.Context, authorID int, order *entity.Order) error {
+
+	note := fmt.Sprintf("refund of %.2f done", order.TotalAmount)
+	var failure error
+	if o.paymentSvc.Refund(ctx, order.ID, order.TotalAmount) != "success" {
+		note = fmt.Sprintf("refund of %.2f failed, settle it with the payment gateway", order.TotalAmount)
+		failure = fmt.Errorf("order cancelled but refund failed, see its notes")
+	}
+
+	if err := o.orderRepo.StoreOrderNote(ctx, nil, &entity.OrderNote{OrderID: order.ID, AuthorID: authorID, Note: note}); err != nil {
+		log.Printf("cannot store refund note of order %d: %v", order.ID, err)
+	}
+
+	return failure
+}
+
+// listOrders returns the page of filter, 20 orders by default.
+func listOrders(ctx context.Context, repo *repositories.OrderRepository, filter entity.OrderFilter) (*model.OrderListResponse, error) {
+
+	if filter.Status != "" && !validOrderStatus(filter.Status) {
+		return nil, fmt.Errorf("invalid status %s", filter.Status)
+	}
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+
+	if filter.PerPage <= 0 {
+		filter.PerPage = 20
+	}
+
+	if filter.PerPage > 100 {
+		return nil, fmt.Errorf("per_page must be at most 100")
+	}
+
+	orders, total, err := repo.ListOrders(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get orders")
+	}
+
+	return &model.OrderListResponse{
+		Orders: orders,
+		Pagination: model.Pagination{
+			Page:       filter.Page,
+			PerPage:    filter.PerPage,
+			Total:      total,
+			TotalPages: (total + filter.PerPage - 1) / filter.PerPage,
+		},
+	}, nil
+}
+
+func orderResponse(order *entity.Order, details []*entity.OrderDetail, address *entity.OrderAddress) *model.OrderResponse {
+
+	response := &model.OrderResponse{
+		ID:               order.ID,
+		UserID:           order.UserID,
+		Status:           order.Status,
+		TotalAmount:      order.TotalAmount,
+		ShippingMethodID: order.ShippingMethodID,
+		ShippingCost:     order.ShippingCost,
+		CreatedAt:        order.CreatedAt,
+		UpdatedAt:        order.UpdatedAt,
+		ShippingAddress:  address,
+		Items:            make([]*model.OrderDetail, 0, len(details)),
+	}
+
+	for _, detail := range details {
+		item := &model.OrderDetail{
+			ID:        detail.ID,
+			ProductID: detail.ProductID,
+			VariantID: detail.VariantID,
+			Quantity:  detail.Quantity,
+			Price:     detail.Price,
+		}
+
+		if detail.Product != nil {
+			item.Name = detail.Product.Name
+			item.Description = detail.Product.Description
+		}
+
+		response.Items = append(response.Items, item)
+	}
+
+	return response
+}
+
+func validOrderStatus(status string) bool {
+	switch status {
+	case entity.OrderStatusPending, entity.OrderStatusPaid, entity.OrderStatusPartiallyShipped, entity.OrderStatusShipped, entity.OrderStatusDelivered, entity.OrderStatusCancelled:
+		return true
+	}
+	return false
+}
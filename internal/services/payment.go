@@ -4,6 +4,7 @@ import "context"
 
 type PaymentService interface {
 	ProcessPayment(ctx context.Context, amount float64) string
+	Refund(ctx context.Context, orderID int, amount float64) string
 }
 
 type payment struct {
@@ -23,3 +24,12 @@ func (p *payment) ProcessPayment(ctx context.Context, amount float64) string {
 	}
 	return "failure"
 }
+
+// Refund simulates returning an amount of a paid order through the payment gateway.
+func (p *payment) Refund(ctx context.Context, orderID int, amount float64) string {
+	// Replace this with the refund call of your payment gateway
+	if orderID > 0 && amount > 0 {
+		return "success"
+	}
+	return "failure"
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/go-redis/redis/v8"
+)
+
+type PriceService interface {
+	GetTimeline(ctx context.Context, productID int, includeHidden bool) (*model.PriceTimeline, error)
+	SchedulePrice(ctx context.Context, request model.PriceScheduleRequest) (*entity.PriceSchedule, error)
+	CancelSchedule(ctx context.Context, productID int, scheduleID int) error
+	ApplySchedules(ctx context.Context) error
+}
+
+type price struct {
+	repo        *repositories.PriceRepository
+	productRepo *repositories.ProductRepository
+	redis       *redis.Client
+}
+
+func NewPrice(repo *repositories.PriceRepository, productRepo *repositories.ProductRepository, redis *redis.Client) PriceService {
+	return &price{
+		repo:        repo,
+		productRepo: productRepo,
+		redis:       redis,
+	}
+}
+
+// GetTimeline returns the past prices of a product and its scheduled changes.
+func (p *price) GetTimeline(ctx context.Context, productID int, includeHidden bool) (*model.PriceTimeline, error) {
+
+	product, err := p.productRepo.GetProductByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil || (!includeHidden && !product.Visible(time.Now().UTC())) {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	history, err := p.repo.GetPriceHistory(ctx, product.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get price history")
+	}
+
+	schedules, err := p.repo.GetSchedules(ctx, product.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get price schedules")
+	}
+
+	timeline := &model.PriceTimeline{
+		ProductID: product.ID,
+		Price:     product.Price,
+		History:   history,
+		Schedules: schedules,
+	}
+
+	for _, schedule := range schedules {
+		if schedule.Status == entity.PriceScheduleActive {
+			timeline.WasPrice, _ = wasPrice(product.Price, schedule)
+		}
+	}
+
+	return timeline, nil
+}
+
+// SchedulePrice schedules a price change of a product. Schedules of a product
+// cannot overlap.
+func (p *price) SchedulePrice(ctx context.Context, request model.PriceScheduleRequest) (*entity.PriceSchedule, error) {
+
+	if request.Price <= 0 {
+		return nil, fmt.Errorf("price must be greater than 0")
+	}
+
+	if request.StartsAt.IsZero() {
+		return nil, fmt.Errorf("starts_at is required")
+	}
+
+	if request.EndsAt != nil && !request.EndsAt.After(request.StartsAt) {
+		return nil, fmt.Errorf("ends_at must be after starts_at")
+	}
+
+	if request.EndsAt != nil && !request.EndsAt.After(time.Now()) {
+		return nil, fmt.Errorf("ends_at must be in the future")
+	}
+
+	product, err := p.productRepo.GetProductByID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	schedule := &entity.PriceSchedule{
+		ProductID: product.ID,
+		Price:     request.Price,
+		StartsAt:  request.StartsAt.UTC(),
+	}
+
+	if request.EndsAt != nil {
+		endsAt := request.EndsAt.UTC()
+		schedule.EndsAt = &endsAt
+	}
+
+	stored, err := p.repo.StoreSchedule(ctx, schedule)
+	if err != nil {
+		return nil, fmt.Errorf("cannot store price schedule")
+	}
+
+	if !stored {
+		return nil, fmt.Errorf("the schedule overlaps another schedule of the product")
+	}
+
+	return schedule, nil
+}
+
+// CancelSchedule cancels a schedule of the product that has not started yet.
+func (p *price) CancelSchedule(ctx context.Context, productID int, scheduleID int) error {
+
+	schedule, err := p.repo.GetScheduleByID(ctx, scheduleID)
+	if err != nil {
+		return fmt.Errorf("cannot get price schedule")
+	}
+
+	if schedule == nil || schedule.ProductID != productID {
+		return fmt.Errorf("price schedule not found")
+	}
+
+	cancelled, err := p.repo.CancelSchedule(ctx, schedule.ID)
+	if err != nil {
+		return fmt.Errorf("cannot cancel price schedule")
+	}
+
+	if !cancelled {
+		return fmt.Errorf("only pending schedules can be cancelled")
+	}
+
+	return nil
+}
+
+// ApplySchedules starts and ends the due schedules and invalidates the caches
+// of the repriced products.
+func (p *price) ApplySchedules(ctx context.Context) error {
+
+	ids, err := p.repo.ApplySchedules(ctx, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("cannot apply price schedules: %w", err)
+	}
+
+	for _, id := range ids {
+		p.redis.Del(ctx, fmt.Sprintf("product:%d", id))
+	}
+
+	if len(ids) > 0 {
+		p.redis.Del(ctx, "products")
+		p.redis.Del(ctx, "product/category")
+	}
+
+	return nil
+}
+
+// wasPrice returns the regular price and the end of the running sale of a
+// product, nil when the schedule does not lower its current price.
+func wasPrice(current float64, schedule *entity.PriceSchedule) (*float64, *time.Time) {
+
+	if schedule == nil || schedule.RegularPrice == nil || schedule.Price != current || *schedule.RegularPrice <= current {
+		return nil, nil
+	}
+
+	return schedule.RegularPrice, schedule.EndsAt
+}
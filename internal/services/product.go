@@ -4,38 +4,58 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/aldotp/OnlineStore/internal/entity"
 	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/replica"
 	"github.com/aldotp/OnlineStore/internal/repositories"
 	"github.com/go-redis/redis/v8"
 )
 
 type ProductService interface {
-	GetProductByCategoryID(ctx context.Context, id int) (*model.ProductByCategoryResponse, error)
+	GetProductByCategoryID(ctx context.Context, id int, includeDescendants bool, includeHidden bool) (*model.ProductByCategoryResponse, error)
 	StoreProduct(ctx context.Context, request model.ProductRequest) (*model.ProductResponse, error)
 	UpdateProduct(ctx context.Context, request model.UpdateProductRequest) error
 	DeleteProduct(ctx context.Context, request model.DeleteProductRequest) error
-	GetProducts(ctx context.Context) ([]model.ProductResponse, error)
-	GetProductByID(ctx context.Context, id int) (*model.ProductResponse, error)
+	GetProducts(ctx context.Context, includeHidden bool) ([]model.ProductResponse, error)
+	GetProductByID(ctx context.Context, id int, includeHidden bool) (*model.ProductResponse, error)
+	SearchProducts(ctx context.Context, filter entity.ProductFilter) (*model.ProductSearchResponse, error)
+	GetDeletedProducts(ctx context.Context) ([]entity.Product, error)
+	RestoreProduct(ctx context.Context, id int) (*model.ProductResponse, error)
+	SetPublishing(ctx context.Context, request model.PublishingRequest) (*model.ProductResponse, error)
+	ApplySchedule(ctx context.Context) error
 }
 
 type product struct {
 	repo         *repositories.ProductRepository
 	repoCategory *repositories.CategoryRepository
+	repoReview   *repositories.ReviewRepository
+	repoVariant  *repositories.ProductVariantRepository
+	repoAttr     *repositories.AttributeRepository
+	repoPrice    *repositories.PriceRepository
+	imageSvc     ImageService
 	redis        *redis.Client
 }
 
-func NewProduct(repo *repositories.ProductRepository, repoCategory *repositories.CategoryRepository, redis *redis.Client) ProductService {
+func NewProduct(repo *repositories.ProductRepository, repoCategory *repositories.CategoryRepository, repoReview *repositories.ReviewRepository, repoVariant *repositories.ProductVariantRepository, repoAttr *repositories.AttributeRepository, repoPrice *repositories.PriceRepository, imageSvc ImageService, redis *redis.Client) ProductService {
 	return &product{
 		repo:         repo,
 		repoCategory: repoCategory,
+		repoReview:   repoReview,
+		repoVariant:  repoVariant,
+		repoAttr:     repoAttr,
+		repoPrice:    repoPrice,
+		imageSvc:     imageSvc,
 		redis:        redis,
 	}
 }
 
-func (p *product) GetProductByCategoryID(ctx context.Context, id int) (*model.ProductByCategoryResponse, error) {
+// GetProductByCategoryID returns the products customers see, and the drafts and
+// unpublished products as well with includeHidden.
+func (p *product) GetProductByCategoryID(ctx context.Context, id int, includeDescendants bool, includeHidden bool) (*model.ProductByCategoryResponse, error) {
 
 	category, err := p.repoCategory.GetCategoryByID(ctx, id)
 	if err != nil {
@@ -46,7 +66,7 @@ func (p *product) GetProductByCategoryID(ctx context.Context, id int) (*model.Pr
 		return nil, fmt.Errorf("category not found")
 	}
 
-	categoryWithProduct, err := p.repo.GetProductsByCategoryID(ctx, category)
+	categoryWithProduct, err := p.repo.GetProductsByCategoryID(ctx, category, includeDescendants, includeHidden)
 	if err != nil {
 		return nil, err
 	}
@@ -72,11 +92,47 @@ func (p *product) StoreProduct(ctx context.Context, request model.ProductRequest
 		return nil, fmt.Errorf("category id not found")
 	}
 
+	definitions, err := p.repoAttr.GetAttributesByCategoryID(ctx, request.CategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attributes")
+	}
+
+	attributes, err := validateAttributes(definitions, request.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := publishingStatus(request.Status, request.PublishAt, request.UnpublishAt)
+	if err != nil {
+		return nil, err
+	}
+
+	sku := strings.TrimSpace(request.SKU)
+	if sku != "" {
+		existing, err := p.repo.GetProductsBySKUs(ctx, sku)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing[strings.ToLower(sku)] != nil {
+			return nil, fmt.Errorf("sku %s is already used", sku)
+		}
+	}
+
 	product := entity.Product{
+		SKU:         sku,
+		Status:      status,
+		PublishAt:   request.PublishAt,
+		UnpublishAt: request.UnpublishAt,
 		Name:        request.Name,
 		Description: request.Description,
 		Price:       request.Price,
 		CategoryID:  request.CategoryID,
+		Weight:      request.Weight,
+		Length:      request.Length,
+		Width:       request.Width,
+		Height:      request.Height,
+		Stock:       request.Stock,
 	}
 
 	insertedProduct, err := p.repo.StoreProduct(ctx, product)
@@ -84,16 +140,13 @@ func (p *product) StoreProduct(ctx context.Context, request model.ProductRequest
 		return nil, err
 	}
 
-	response := &model.ProductResponse{
-		ID:          insertedProduct.ID,
-		Name:        insertedProduct.Name,
-		Description: insertedProduct.Description,
-		Price:       insertedProduct.Price,
-		CategoryID:  insertedProduct.CategoryID,
-		CreatedAt:   insertedProduct.CreatedAt.String(),
-		UpdatedAt:   insertedProduct.UpdatedAt.String(),
+	if err := p.repoAttr.ReplaceProductAttributes(ctx, insertedProduct.ID, attributes); err != nil {
+		return nil, fmt.Errorf("cannot store attributes")
 	}
 
+	response := productResponse(insertedProduct, entity.RatingSummary{})
+	response.Attributes = attributeMap(attributes)
+
 	p.redis.Del(ctx, "products")
 	p.redis.Del(ctx, "product/category")
 
@@ -111,16 +164,41 @@ func (p *product) UpdateProduct(ctx context.Context, request model.UpdateProduct
 		return fmt.Errorf("product not found")
 	}
 
+	// attributes are only replaced when sent
+	var attributes []entity.ProductAttribute
+	if request.Attributes != nil {
+		definitions, err := p.repoAttr.GetAttributesByCategoryID(ctx, product.CategoryID)
+		if err != nil {
+			return fmt.Errorf("cannot get attributes")
+		}
+
+		attributes, err = validateAttributes(definitions, request.Attributes)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = p.repo.UpdateProduct(ctx, &entity.Product{
 		ID:          product.ID,
 		Name:        request.Name,
 		Description: request.Description,
 		Price:       request.Price,
+		Weight:      request.Weight,
+		Length:      request.Length,
+		Width:       request.Width,
+		Height:      request.Height,
+		Stock:       request.Stock,
 	})
 	if err != nil {
 		return err
 	}
 
+	if request.Attributes != nil {
+		if err := p.repoAttr.ReplaceProductAttributes(ctx, product.ID, attributes); err != nil {
+			return fmt.Errorf("cannot update attributes")
+		}
+	}
+
 	p.redis.Del(ctx, fmt.Sprintf("product:%d", request.ProductID))
 	p.redis.Del(ctx, "products")
 
@@ -146,35 +224,85 @@ func (p *product) DeleteProduct(ctx context.Context, request model.DeleteProduct
 
 	p.redis.Del(ctx, fmt.Sprintf("product:%d", request.ProductID))
 	p.redis.Del(ctx, "products")
+	p.redis.Del(ctx, "product/category")
 
 	return nil
 
 }
 
-func (p *product) GetProducts(ctx context.Context) ([]model.ProductResponse, error) {
+func (p *product) GetDeletedProducts(ctx context.Context) ([]entity.Product, error) {
+
+	products, err := p.repo.GetDeletedProducts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get deleted products")
+	}
+
+	return products, nil
+}
+
+// RestoreProduct brings a deleted product back to the catalog with its images,
+// variants and attributes. Its category must not be deleted.
+func (p *product) RestoreProduct(ctx context.Context, id int) (*model.ProductResponse, error) {
+
+	product, err := p.repo.GetDeletedProductByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil {
+		return nil, fmt.Errorf("deleted product not found")
+	}
+
+	category, err := p.repoCategory.GetCategoryByID(ctx, product.CategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get category")
+	}
+
+	if category == nil {
+		return nil, fmt.Errorf("the category of the product is deleted, restore it first")
+	}
+
+	if err := p.repo.RestoreProduct(ctx, product.ID); err != nil {
+		return nil, fmt.Errorf("cannot restore product")
+	}
+
+	p.redis.Del(ctx, fmt.Sprintf("product:%d", product.ID))
+	p.redis.Del(ctx, "products")
+	p.redis.Del(ctx, "product/category")
+
+	return p.GetProductByID(ctx, product.ID, true)
+}
+
+// GetProducts returns the products customers see from the cache. With
+// includeHidden the drafts and unpublished products are loaded as well,
+// bypassing the cache.
+func (p *product) GetProducts(ctx context.Context, includeHidden bool) ([]model.ProductResponse, error) {
+
+	if includeHidden {
+		products, err := p.repo.GetAllProducts(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+
+		return p.productResponses(ctx, products)
+	}
+
 	cachedProducts, err := p.redis.Get(ctx, "products").Result()
 	if err != nil && err != redis.Nil {
 		return nil, err
 	}
 
 	if err == redis.Nil {
-		products, err := p.repo.GetAllProducts(ctx)
+		// the cache is shared by every user for hours, it is filled from the
+		// primary so that a lagging replica cannot put stale products in it
+		products, err := p.repo.GetAllProducts(replica.WithPrimary(ctx), false)
 		if err != nil {
 			return nil, err
 		}
 
-		responses := make([]model.ProductResponse, len(products))
-
-		for i, product := range products {
-			responses[i] = model.ProductResponse{
-				ID:          product.ID,
-				Name:        product.Name,
-				Description: product.Description,
-				Price:       product.Price,
-				CategoryID:  product.CategoryID,
-				CreatedAt:   product.CreatedAt.String(),
-				UpdatedAt:   product.UpdatedAt.String(),
-			}
+		responses, err := p.productResponses(ctx, products)
+		if err != nil {
+			return nil, err
 		}
 
 		productJSON, err := json.Marshal(responses)
@@ -199,7 +327,26 @@ func (p *product) GetProducts(ctx context.Context) ([]model.ProductResponse, err
 	return responses, nil
 }
 
-func (p *product) GetProductByID(ctx context.Context, id int) (*model.ProductResponse, error) {
+// GetProductByID returns the product when customers see it, or in any state
+// with includeHidden. The cached product is checked against the schedule, so it
+// disappears on time even before the scheduler runs.
+func (p *product) GetProductByID(ctx context.Context, id int, includeHidden bool) (*model.ProductResponse, error) {
+
+	response, err := p.loadProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !includeHidden && !entity.ProductVisible(response.Status, response.PublishAt, response.UnpublishAt, time.Now().UTC()) {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	return response, nil
+}
+
+// loadProduct returns the product with its options and variants, from the
+// cache when possible.
+func (p *product) loadProduct(ctx context.Context, id int) (*model.ProductResponse, error) {
 
 	cachedProduct, err := p.redis.Get(ctx, fmt.Sprintf("product:%d", id)).Result()
 	if err != nil && err != redis.Nil {
@@ -216,17 +363,23 @@ func (p *product) GetProductByID(ctx context.Context, id int) (*model.ProductRes
 			return nil, fmt.Errorf("product not found")
 		}
 
-		productResponse := &model.ProductResponse{
-			ID:          product.ID,
-			Name:        product.Name,
-			Description: product.Description,
-			Price:       product.Price,
-			CategoryID:  product.CategoryID,
-			CreatedAt:   product.CreatedAt.String(),
-			UpdatedAt:   product.UpdatedAt.String(),
+		responses, err := p.productResponses(ctx, []entity.Product{*product})
+		if err != nil {
+			return nil, err
+		}
+		response := &responses[0]
+
+		response.Options, err = p.repoVariant.GetOptionsByProductID(ctx, product.ID)
+		if err != nil {
+			return nil, err
 		}
 
-		productJSON, err := json.Marshal(productResponse)
+		response.Variants, err = p.repoVariant.GetVariantsByProductID(ctx, product.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		productJSON, err := json.Marshal(response)
 		if err != nil {
 			return nil, err
 		}
@@ -236,7 +389,7 @@ func (p *product) GetProductByID(ctx context.Context, id int) (*model.ProductRes
 			return nil, err
 		}
 
-		return productResponse, nil
+		return response, nil
 
 	}
 
@@ -249,3 +402,213 @@ func (p *product) GetProductByID(ctx context.Context, id int) (*model.ProductRes
 	return &productResponse, nil
 
 }
+
+// SetPublishing changes the status and the publishing schedule of a product.
+func (p *product) SetPublishing(ctx context.Context, request model.PublishingRequest) (*model.ProductResponse, error) {
+
+	product, err := p.repo.GetProductByID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	if request.Status == "" {
+		request.Status = product.Status
+	}
+
+	status, err := publishingStatus(request.Status, request.PublishAt, request.UnpublishAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.repo.SetPublishing(ctx, product.ID, status, request.PublishAt, request.UnpublishAt); err != nil {
+		return nil, fmt.Errorf("cannot update publishing")
+	}
+
+	p.invalidateProducts(ctx, product.ID)
+
+	return p.GetProductByID(ctx, product.ID, true)
+}
+
+// ApplySchedule publishes and unpublishes the products whose scheduled time has
+// passed and invalidates their caches.
+func (p *product) ApplySchedule(ctx context.Context) error {
+
+	ids, err := p.repo.ApplySchedule(ctx, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("cannot apply publishing schedule: %w", err)
+	}
+
+	if len(ids) > 0 {
+		p.invalidateProducts(ctx, ids...)
+	}
+
+	return nil
+}
+
+// invalidateProducts drops the cached products and the product lists.
+func (p *product) invalidateProducts(ctx context.Context, ids ...int) {
+
+	for _, id := range ids {
+		p.redis.Del(ctx, fmt.Sprintf("product:%d", id))
+	}
+
+	p.redis.Del(ctx, "products")
+	p.redis.Del(ctx, "product/category")
+}
+
+// publishingStatus validates the status and the schedule of a product. An
+// empty status means draft when a publication is scheduled, published otherwise.
+func publishingStatus(status string, publishAt, unpublishAt *time.Time) (string, error) {
+
+	if status == "" {
+		status = entity.ProductPublished
+		if publishAt != nil {
+			status = entity.ProductDraft
+		}
+	}
+
+	switch status {
+	case entity.ProductDraft, entity.ProductPublished, entity.ProductUnpublished:
+	default:
+		return "", fmt.Errorf("status must be draft, published or unpublished")
+	}
+
+	if status == entity.ProductPublished && publishAt != nil {
+		return "", fmt.Errorf("publish_at can only be set on drafts and unpublished products")
+	}
+
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return "", fmt.Errorf("unpublish_at must be after publish_at")
+	}
+
+	return status, nil
+}
+
+// SearchProducts returns the products matching filter with the facets of the
+// filterable attributes of the result set.
+func (p *product) SearchProducts(ctx context.Context, filter entity.ProductFilter) (*model.ProductSearchResponse, error) {
+
+	codes := make([]string, 0, len(filter.Attributes))
+	for code := range filter.Attributes {
+		codes = append(codes, code)
+	}
+
+	// codes are unique within a category tree only, they are resolved in the
+	// tree of the searched category
+	definitions, err := p.repoAttr.GetAttributesByCodesInTree(ctx, filter.CategoryID, codes...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get attributes")
+	}
+
+	byCode := make(map[string]entity.Attribute, len(definitions))
+	filter.AttributeIDs = make(map[string]int, len(definitions))
+	for _, definition := range definitions {
+		if _, ok := byCode[definition.Code]; ok {
+			return nil, fmt.Errorf("attribute %s is defined by several categories, search in one of them with category_id", definition.Code)
+		}
+		byCode[definition.Code] = definition
+		filter.AttributeIDs[definition.Code] = definition.ID
+	}
+
+	// filter values are matched against the canonical stored values
+	for code, values := range filter.Attributes {
+		definition, ok := byCode[code]
+		if !ok {
+			return nil, fmt.Errorf("unknown attribute %s", code)
+		}
+
+		for i, value := range values {
+			canonical, err := canonicalAttributeValue(definition, value)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = canonical
+		}
+	}
+
+	products, err := p.repo.SearchProducts(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("cannot search products")
+	}
+
+	responses, err := p.productResponses(ctx, products)
+	if err != nil {
+		return nil, err
+	}
+
+	facets, err := p.repoAttr.GetFacets(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get facets")
+	}
+
+	return &model.ProductSearchResponse{
+		Products: responses,
+		Facets:   facets,
+	}, nil
+}
+
+// productResponses loads the ratings, images, attributes and sales of the products.
+func (p *product) productResponses(ctx context.Context, products []entity.Product) ([]model.ProductResponse, error) {
+
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	ratings, err := p.repoReview.GetRatingSummaries(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := p.imageSvc.GetImages(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := p.repoAttr.GetProductAttributes(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	sales, err := p.repoPrice.GetActiveSchedules(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]model.ProductResponse, len(products))
+	for i, product := range products {
+		responses[i] = *productResponse(&product, ratings[product.ID])
+		responses[i].Images = images[product.ID]
+		responses[i].Attributes = attributeMap(attributes[product.ID])
+		responses[i].WasPrice, responses[i].SaleEndsAt = wasPrice(product.Price, sales[product.ID])
+	}
+
+	return responses, nil
+}
+
+func productResponse(product *entity.Product, rating entity.RatingSummary) *model.ProductResponse {
+	return &model.ProductResponse{
+		ID:            product.ID,
+		SKU:           product.SKU,
+		Name:          product.Name,
+		Description:   product.Description,
+		Price:         product.Price,
+		CategoryID:    product.CategoryID,
+		Weight:        product.Weight,
+		Length:        product.Length,
+		Width:         product.Width,
+		Height:        product.Height,
+		Stock:         product.Stock,
+		Status:        product.Status,
+		PublishAt:     product.PublishAt,
+		UnpublishAt:   product.UnpublishAt,
+		AverageRating: math.Round(rating.Average*100) / 100,
+		ReviewCount:   rating.Count,
+		CreatedAt:     product.CreatedAt.String(),
+		UpdatedAt:     product.UpdatedAt.String(),
+	}
+}
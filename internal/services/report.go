@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+// Intervals of the sales report.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+const dateLayout = "2006-01-02"
+
+// ReportService reports the sales from the daily rollups of the report
+// timezones. Rollup keeps them up to date, days missing from a report are
+// rolled up on the fly.
+type ReportService interface {
+	Sales(ctx context.Context, request model.ReportRequest) (*model.SalesReport, error)
+	TopProducts(ctx context.Context, request model.ReportRequest) (*model.TopSellersReport, error)
+	TopCategories(ctx context.Context, request model.ReportRequest) (*model.TopSellersReport, error)
+	Rollup(ctx context.Context) error
+}
+
+type report struct {
+	repo      *repositories.ReportRepository
+	timezones []string
+	locations map[string]*time.Location
+}
+
+// NewReport rolls up the sales by local day of each timezone, the first one is
+// the default of the reports. Without timezones the days are in UTC.
+func NewReport(repo *repositories.ReportRepository, timezones []string) (ReportService, error) {
+
+	if len(timezones) == 0 {
+		timezones = []string{"UTC"}
+	}
+
+	locations := make(map[string]*time.Location, len(timezones))
+	for _, timezone := range timezones {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid report timezone %q: %w", timezone, err)
+		}
+		locations[timezone] = location
+	}
+
+	return &report{
+		repo:      repo,
+		timezones: timezones,
+		locations: locations,
+	}, nil
+}
+
+// Sales sums the orders of each bucket of the interval, weeks start on Monday.
+// Customers ordering on several days of a bucket are counted on each day.
+func (r *report) Sales(ctx context.Context, request model.ReportRequest) (*model.SalesReport, error) {
+
+	timezone, first, last, err := r.period(request)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := request.Interval
+	if interval == "" {
+		interval = IntervalDay
+	}
+
+	var bucketStart func(time.Time) time.Time
+	switch interval {
+	case IntervalDay:
+		bucketStart = func(day time.Time) time.Time { return day }
+	case IntervalWeek:
+		bucketStart = func(day time.Time) time.Time { return day.AddDate(0, 0, -(int(day.Weekday())+6)%7) }
+	case IntervalMonth:
+		bucketStart = func(day time.Time) time.Time { return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC) }
+	default:
+		return nil, fmt.Errorf("interval must be day, week or month")
+	}
+
+	days, err := r.salesDays(ctx, timezone, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.SalesReport{
+		Timezone: timezone,
+		Interval: interval,
+		From:     first.Format(dateLayout),
+		To:       last.Format(dateLayout),
+		Buckets:  []model.SalesBucket{},
+	}
+
+	for _, day := range days {
+		start := bucketStart(day.Day).Format(dateLayout)
+		if n := len(response.Buckets); n == 0 || response.Buckets[n-1].Start != start {
+			response.Buckets = append(response.Buckets, model.SalesBucket{Start: start})
+		}
+
+		addSalesDay(&response.Buckets[len(response.Buckets)-1].SalesTotals, day)
+		addSalesDay(&response.SalesTotals, day)
+	}
+
+	for i := range response.Buckets {
+		finishSalesTotals(&response.Buckets[i].SalesTotals)
+	}
+	finishSalesTotals(&response.SalesTotals)
+
+	return response, nil
+}
+
+// TopProducts ranks the products by the revenue of their lines, or their units.
+func (r *report) TopProducts(ctx context.Context, request model.ReportRequest) (*model.TopSellersReport, error) {
+	return r.topSellers(ctx, request, r.repo.GetTopProducts)
+}
+
+// TopCategories ranks the categories by the sales of their products.
+func (r *report) TopCategories(ctx context.Context, request model.ReportRequest) (*model.TopSellersReport, error) {
+	return r.topSellers(ctx, request, r.repo.GetTopCategories)
+}
+
+func (r *report) topSellers(ctx context.Context, request model.ReportRequest, rank func(context.Context, string, time.Time, time.Time, bool, int) ([]entity.TopSeller, error)) (*model.TopSellersReport, error) {
+
+	timezone, first, last, err := r.period(request)
+	if err != nil {
+		return nil, err
+	}
+
+	sortBy := request.Sort
+	if sortBy == "" {
+		sortBy = "revenue"
+	}
+
+	if sortBy != "revenue" && sortBy != "units" {
+		return nil, fmt.Errorf("sort must be revenue or units")
+	}
+
+	limit := request.Limit
+	if limit <= 0 {
+		limit = 10
+	}
+
+	if limit > 100 {
+		return nil, fmt.Errorf("limit must be at most 100")
+	}
+
+	if _, err := r.salesDays(ctx, timezone, first, last); err != nil {
+		return nil, err
+	}
+
+	items, err := rank(ctx, timezone, first, last, sortBy == "units", limit)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get top sellers")
+	}
+
+	for i := range items {
+		items[i].Revenue = roundAmount(items[i].Revenue)
+	}
+
+	return &model.TopSellersReport{
+		Timezone: timezone,
+		From:     first.Format(dateLayout),
+		To:       last.Format(dateLayout),
+		Sort:     sortBy,
+		Items:    items,
+	}, nil
+}
+
+// Rollup computes the days of every timezone rolled up before they ended, and
+// the days since the last one rolled up, starting from the first sale.
+func (r *report) Rollup(ctx context.Context) error {
+
+	for _, timezone := range r.timezones {
+		location := r.locations[timezone]
+
+		days, err := r.repo.GetOpenSalesDays(ctx, timezone)
+		if err != nil {
+			return fmt.Errorf("cannot get open days of %s: %w", timezone, err)
+		}
+
+		last, err := r.repo.GetLastSalesDay(ctx, timezone)
+		if err != nil {
+			return fmt.Errorf("cannot get last day of %s: %w", timezone, err)
+		}
+
+		var next time.Time
+		if last != nil {
+			next = last.AddDate(0, 0, 1)
+		} else {
+			first, err := r.repo.GetFirstOrderTime(ctx)
+			if err != nil {
+				return fmt.Errorf("cannot get first sale: %w", err)
+			}
+			if first == nil {
+				continue
+			}
+			next = localDay(*first, location)
+		}
+
+		for today := localDay(time.Now(), location); !next.After(today); next = next.AddDate(0, 0, 1) {
+			days = append(days, next)
+		}
+
+		for _, day := range days {
+			if _, err := r.rollupDay(ctx, timezone, day); err != nil {
+				return fmt.Errorf("cannot roll up %s of %s: %w", day.Format(dateLayout), timezone, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// period returns the timezone of the request and its first and last days.
+func (r *report) period(request model.ReportRequest) (string, time.Time, time.Time, error) {
+
+	timezone := request.Timezone
+	if timezone == "" {
+		timezone = r.timezones[0]
+	}
+
+	if _, ok := r.locations[timezone]; !ok {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("timezone must be one of %s", strings.Join(r.timezones, ", "))
+	}
+
+	first := time.Date(request.From.Year(), request.From.Month(), request.From.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(request.To.Year(), request.To.Month(), request.To.Day(), 0, 0, 0, 0, time.UTC)
+	if !end.After(first) {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("to must be after from")
+	}
+
+	return timezone, first, end.AddDate(0, 0, -1), nil
+}
+
+// salesDays returns the rollups of the days from first to last, rolling up
+// the days that are missing. Days to come are left out.
+func (r *report) salesDays(ctx context.Context, timezone string, first, last time.Time) ([]entity.SalesDay, error) {
+
+	stored, err := r.repo.GetSalesDays(ctx, timezone, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get sales")
+	}
+
+	byDay := make(map[string]entity.SalesDay, len(stored))
+	for _, day := range stored {
+		byDay[day.Day.Format(dateLayout)] = day
+	}
+
+	// the days before the first sale have no rollups and are empty
+	firstSale := last.AddDate(0, 0, 1)
+	if len(stored) < int(last.Sub(first).Hours()/24)+1 {
+		firstOrder, err := r.repo.GetFirstOrderTime(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get sales")
+		}
+		if firstOrder != nil {
+			firstSale = localDay(*firstOrder, r.locations[timezone])
+		}
+	}
+
+	today := localDay(time.Now(), r.locations[timezone])
+	var days []entity.SalesDay
+	for day := first; !day.After(last) && !day.After(today); day = day.AddDate(0, 0, 1) {
+		salesDay, ok := byDay[day.Format(dateLayout)]
+		if !ok && !day.Before(firstSale) {
+			rolledUp, err := r.rollupDay(ctx, timezone, day)
+			if err != nil {
+				return nil, fmt.Errorf("cannot compute sales")
+			}
+			salesDay = *rolledUp
+		}
+
+		salesDay.Timezone = timezone
+		salesDay.Day = day
+		days = append(days, salesDay)
+	}
+
+	return days, nil
+}
+
+// rollupDay computes and stores the rollups of the local day.
+func (r *report) rollupDay(ctx context.Context, timezone string, day time.Time) (*entity.SalesDay, error) {
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, r.locations[timezone])
+	end := start.AddDate(0, 0, 1)
+
+	salesDay, products, err := r.repo.ComputeSalesDay(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	salesDay.Timezone = timezone
+	salesDay.Day = day
+	salesDay.Final = !time.Now().Before(end)
+
+	if err := r.repo.StoreSalesDay(ctx, salesDay, products); err != nil {
+		return nil, err
+	}
+
+	return salesDay, nil
+}
+
+func addSalesDay(totals *model.SalesTotals, day entity.SalesDay) {
+	totals.Orders += day.Orders
+	totals.Revenue += day.Revenue
+	totals.Units += day.Units
+	totals.NewCustomers += day.NewCustomers
+	totals.ReturningCustomers += day.ReturningCustomers
+}
+
+func finishSalesTotals(totals *model.SalesTotals) {
+	totals.Revenue = roundAmount(totals.Revenue)
+	if totals.Orders > 0 {
+		totals.AverageOrderValue = roundAmount(totals.Revenue / float64(totals.Orders))
+	}
+}
+
+// localDay returns the date of t in location, as midnight UTC.
+func localDay(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
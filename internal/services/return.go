@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+type ReturnService interface {
+	RequestReturn(ctx context.Context, request model.ReturnRequest, userID int) (*entity.Return, error)
+	GetUserReturns(ctx context.Context, userID int) ([]entity.Return, error)
+	GetUserReturnByID(ctx context.Context, id int, userID int) (*entity.Return, error)
+	GetReturns(ctx context.Context, status string) ([]entity.Return, error)
+	GetReturnByID(ctx context.Context, id int) (*entity.Return, error)
+	Approve(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error)
+	Reject(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error)
+	Receive(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error)
+	Refund(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error)
+}
+
+type rma struct {
+	repo            *repositories.ReturnRepository
+	orderRepo       *repositories.OrderRepository
+	orderDetailRepo *repositories.OrderDetailRepository
+	productRepo     *repositories.ProductRepository
+	variantRepo     *repositories.ProductVariantRepository
+	reportRepo      *repositories.ReportRepository
+	paymentSvc      PaymentService
+}
+
+func NewReturn(repo *repositories.ReturnRepository, orderRepo *repositories.OrderRepository, orderDetailRepo *repositories.OrderDetailRepository, productRepo *repositories.ProductRepository, variantRepo *repositories.ProductVariantRepository, reportRepo *repositories.ReportRepository, paymentSvc PaymentService) ReturnService {
+	return &rma{
+		repo:            repo,
+		orderRepo:       orderRepo,
+		orderDetailRepo: orderDetailRepo,
+		productRepo:     productRepo,
+		variantRepo:     variantRepo,
+		reportRepo:      reportRepo,
+		paymentSvc:      paymentSvc,
+	}
+}
+
+func (r *rma) RequestReturn(ctx context.Context, request model.ReturnRequest, userID int) (*entity.Return, error) {
+
+	if len(request.Items) == 0 {
+		return nil, fmt.Errorf("items are required")
+	}
+
+	tx, err := r.repo.BeginTransaction(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	// the order stays locked until the return is stored, so that concurrent
+	// requests cannot return the same items twice
+	order, err := r.orderRepo.GetOrderForUpdateWithTransaction(ctx, tx, request.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil || order.UserID != userID {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	if order.Status != entity.OrderStatusDelivered {
+		return nil, fmt.Errorf("only delivered orders can be returned")
+	}
+
+	orderDetails, err := r.orderDetailRepo.GetOrderDetailsByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order details")
+	}
+
+	returned, err := r.repo.GetReturnedQuantitiesWithTransaction(ctx, tx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get returned quantities")
+	}
+
+	details := make(map[int]*entity.OrderDetail)
+	for _, detail := range orderDetails {
+		details[detail.ID] = detail
+	}
+
+	var items []entity.ReturnItem
+	for _, item := range request.Items {
+		detail, ok := details[item.OrderDetailID]
+		if !ok {
+			return nil, fmt.Errorf("order detail %d does not belong to order", item.OrderDetailID)
+		}
+
+		if item.Quantity <= 0 || item.Quantity > detail.Quantity-returned[detail.ID] {
+			return nil, fmt.Errorf("invalid quantity for order detail %d", item.OrderDetailID)
+		}
+
+		returned[detail.ID] += item.Quantity
+		items = append(items, entity.ReturnItem{
+			OrderDetailID: detail.ID,
+			ProductID:     detail.ProductID,
+			Quantity:      item.Quantity,
+			Price:         detail.Price,
+		})
+	}
+
+	ret := &entity.Return{
+		OrderID: order.ID,
+		UserID:  userID,
+		Status:  entity.ReturnStatusRequested,
+		Reason:  request.Reason,
+		Items:   items,
+	}
+
+	created, err := r.repo.CreateReturnWithTransaction(ctx, tx, ret, &entity.ReturnHistory{
+		OrderID: order.ID,
+		Action:  entity.ReturnStatusRequested,
+		Note:    request.Reason,
+		ActorID: userID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create return")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("transaction commit failed")
+	}
+
+	return created, nil
+}
+
+func (r *rma) GetUserReturns(ctx context.Context, userID int) ([]entity.Return, error) {
+
+	returns, err := r.repo.GetReturnsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get returns")
+	}
+
+	return returns, nil
+}
+
+func (r *rma) GetUserReturnByID(ctx context.Context, id int, userID int) (*entity.Return, error) {
+
+	ret, err := r.GetReturnByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.UserID != userID {
+		return nil, fmt.Errorf("return not found")
+	}
+
+	return ret, nil
+}
+
+func (r *rma) GetReturns(ctx context.Context, status string) ([]entity.Return, error) {
+
+	returns, err := r.repo.GetReturns(ctx, status)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get returns")
+	}
+
+	return returns, nil
+}
+
+func (r *rma) GetReturnByID(ctx context.Context, id int) (*entity.Return, error) {
+
+	ret, err := r.repo.GetReturnByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get return")
+	}
+
+	if ret == nil {
+		return nil, fmt.Errorf("return not found")
+	}
+
+	return ret, nil
+}
+
+// Approve accepts a requested return. The approved amount defaults to the value of
+// the returned items and cannot exceed it.
+func (r *rma) Approve(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error) {
+
+	tx, ret, err := r.lock(ctx, request.ReturnID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if ret.Status != entity.ReturnStatusRequested {
+		return nil, fmt.Errorf("return cannot be approved in status %s", ret.Status)
+	}
+
+	if err := r.checkReturnedQuantities(ctx, tx, ret); err != nil {
+		return nil, err
+	}
+
+	var value float64
+	for _, item := range ret.Items {
+		value += item.Price * float64(item.Quantity)
+	}
+
+	amount := request.Amount
+	if amount == 0 {
+		amount = value
+	}
+
+	if amount < 0 || amount > value {
+		return nil, fmt.Errorf("approved amount must be between 0 and %.2f", value)
+	}
+
+	ret.Status = entity.ReturnStatusApproved
+	ret.ApprovedAmount = amount
+
+	return r.update(ctx, tx, ret, request.Note, amount, adminID)
+}
+
+func (r *rma) Reject(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error) {
+
+	tx, ret, err := r.lock(ctx, request.ReturnID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if ret.Status != entity.ReturnStatusRequested {
+		return nil, fmt.Errorf("return cannot be rejected in status %s", ret.Status)
+	}
+
+	ret.Status = entity.ReturnStatusRejected
+
+	return r.update(ctx, tx, ret, request.Note, 0, adminID)
+}
+
+// Receive marks the items of an approved return as back in the warehouse and
+// optionally puts them back in stock, once. Returns refunded before their items
+// arrive keep their refund status.
+func (r *rma) Receive(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error) {
+
+	tx, ret, err := r.lock(ctx, request.ReturnID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	switch ret.Status {
+	case entity.ReturnStatusApproved, entity.ReturnStatusPartiallyRefunded, entity.ReturnStatusRefunded:
+	default:
+		return nil, fmt.Errorf("return cannot be received in status %s", ret.Status)
+	}
+
+	if ret.ReceivedAt != nil {
+		return nil, fmt.Errorf("return was already received")
+	}
+
+	if request.Restock {
+		details, err := r.orderDetailRepo.GetOrderDetailsByOrderID(ctx, ret.OrderID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get order details")
+		}
+
+		variants := make(map[int]int, len(details))
+		for _, detail := range details {
+			variants[detail.ID] = detail.VariantID
+		}
+
+		for _, item := range ret.Items {
+			if variantID := variants[item.OrderDetailID]; variantID != 0 {
+				err = r.variantRepo.IncreaseStockWithTransaction(ctx, tx, variantID, item.Quantity)
+			} else {
+				err = r.productRepo.IncreaseStockWithTransaction(ctx, tx, item.ProductID, item.Quantity)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("cannot restock product %d", item.ProductID)
+			}
+		}
+	}
+
+	note := request.Note
+	if request.Restock {
+		note = strings.TrimSpace("items restocked. " + note)
+	}
+
+	receivedAt := time.Now().UTC()
+	ret.ReceivedAt = &receivedAt
+	if ret.Status == entity.ReturnStatusApproved {
+		ret.Status = entity.ReturnStatusReceived
+	}
+
+	err = r.repo.UpdateReturnWithTransaction(ctx, tx, ret, &entity.ReturnHistory{
+		ReturnID: ret.ID,
+		OrderID:  ret.OrderID,
+		Action:   entity.ReturnStatusReceived,
+		Note:     note,
+		ActorID:  adminID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot update return")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("transaction commit failed")
+	}
+
+	return r.GetReturnByID(ctx, ret.ID)
+}
+
+// Refund pays back part or all of the outstanding approved amount through the
+// payment service. The return stays locked from the check of the outstanding
+// amount until the refund is recorded.
+func (r *rma) Refund(ctx context.Context, request model.ReturnDecisionRequest, adminID int) (*entity.Return, error) {
+
+	tx, ret, err := r.lock(ctx, request.ReturnID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	switch ret.Status {
+	case entity.ReturnStatusApproved, entity.ReturnStatusReceived, entity.ReturnStatusPartiallyRefunded:
+	default:
+		return nil, fmt.Errorf("return cannot be refunded in status %s", ret.Status)
+	}
+
+	if err := r.checkReturnedQuantities(ctx, tx, ret); err != nil {
+		return nil, err
+	}
+
+	outstanding := roundAmount(ret.ApprovedAmount - ret.RefundedAmount)
+
+	amount := request.Amount
+	if amount == 0 {
+		amount = outstanding
+	}
+
+	if amount <= 0 || amount > outstanding {
+		return nil, fmt.Errorf("refund amount must be between 0 and %.2f", outstanding)
+	}
+
+	if r.paymentSvc.Refund(ctx, ret.OrderID, amount) != "success" {
+		return nil, fmt.Errorf("refund failed")
+	}
+
+	ret.RefundedAmount = roundAmount(ret.RefundedAmount + amount)
+	ret.Status = entity.ReturnStatusPartiallyRefunded
+	if ret.RefundedAmount >= ret.ApprovedAmount {
+		ret.Status = entity.ReturnStatusRefunded
+	}
+
+	refund := &entity.Refund{
+		ReturnID: ret.ID,
+		OrderID:  ret.OrderID,
+		Amount:   amount,
+		Status:   "success",
+	}
+
+	err = r.repo.CreateRefundWithTransaction(ctx, tx, refund, ret, &entity.ReturnHistory{
+		ReturnID: ret.ID,
+		OrderID:  ret.OrderID,
+		Action:   ret.Status,
+		Note:     request.Note,
+		Amount:   amount,
+		ActorID:  adminID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot store refund")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("transaction commit failed")
+	}
+
+	// the refund is taken off the sales of the day of the order
+	order, err := r.orderRepo.GetOrderByID(ctx, ret.OrderID)
+	if err == nil && order != nil {
+		err = r.reportRepo.ReopenSalesDays(ctx, order.CreatedAt)
+	}
+	if err != nil {
+		log.Printf("cannot reopen sales of order %d: %v", ret.OrderID, err)
+	}
+
+	return r.GetReturnByID(ctx, ret.ID)
+}
+
+// lock begins a transaction holding the return until it ends, so that
+// concurrent decisions on the return run one after the other.
+func (r *rma) lock(ctx context.Context, id int) (*sql.Tx, *entity.Return, error) {
+
+	tx, err := r.repo.BeginTransaction(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot begin transaction")
+	}
+
+	ret, err := r.repo.GetReturnForUpdateWithTransaction(ctx, tx, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, fmt.Errorf("cannot get return")
+	}
+
+	if ret == nil {
+		tx.Rollback()
+		return nil, nil, fmt.Errorf("return not found")
+	}
+
+	return tx, ret, nil
+}
+
+// checkReturnedQuantities locks the order of the return and checks that its
+// returns which are not rejected, this one included, do not return more items
+// than were ordered.
+func (r *rma) checkReturnedQuantities(ctx context.Context, tx *sql.Tx, ret *entity.Return) error {
+
+	order, err := r.orderRepo.GetOrderForUpdateWithTransaction(ctx, tx, ret.OrderID)
+	if err != nil || order == nil {
+		return fmt.Errorf("cannot get order")
+	}
+
+	orderDetails, err := r.orderDetailRepo.GetOrderDetailsByOrderID(ctx, order.ID)
+	if err != nil {
+		return fmt.Errorf("cannot get order details")
+	}
+
+	returned, err := r.repo.GetReturnedQuantitiesWithTransaction(ctx, tx, order.ID)
+	if err != nil {
+		return fmt.Errorf("cannot get returned quantities")
+	}
+
+	ordered := make(map[int]int, len(orderDetails))
+	for _, detail := range orderDetails {
+		ordered[detail.ID] = detail.Quantity
+	}
+
+	for _, item := range ret.Items {
+		if returned[item.OrderDetailID] > ordered[item.OrderDetailID] {
+			return fmt.Errorf("order detail %d is returned more times than it was ordered", item.OrderDetailID)
+		}
+	}
+
+	return nil
+}
+
+func (r *rma) update(ctx context.Context, tx *sql.Tx, ret *entity.Return, note string, amount float64, actorID int) (*entity.Return, error) {
+
+	err := r.repo.UpdateReturnWithTransaction(ctx, tx, ret, &entity.ReturnHistory{
+		ReturnID: ret.ID,
+		OrderID:  ret.OrderID,
+		Action:   ret.Status,
+		Note:     note,
+		Amount:   amount,
+		ActorID:  actorID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot update return")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("transaction commit failed")
+	}
+
+	return r.GetReturnByID(ctx, ret.ID)
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/go-redis/redis/v8"
+)
+
+// purchasedOrderStatuses are the statuses of orders that were paid for.
+var purchasedOrderStatuses = []string{
+	entity.OrderStatusPaid,
+	entity.OrderStatusPartiallyShipped,
+	entity.OrderStatusShipped,
+	entity.OrderStatusDelivered,
+}
+
+type ReviewService interface {
+	GetProductReviews(ctx context.Context, productID int) ([]*entity.Review, error)
+	StoreReview(ctx context.Context, request model.ReviewRequest, userID int) (*entity.Review, error)
+	UpdateReview(ctx context.Context, request model.ReviewRequest, userID int) (*entity.Review, error)
+	DeleteReview(ctx context.Context, productID int, userID int) error
+
+	GetReviews(ctx context.Context, status string) ([]*entity.Review, error)
+	Approve(ctx context.Context, id int) (*entity.Review, error)
+	Reject(ctx context.Context, id int) (*entity.Review, error)
+}
+
+type review struct {
+	repo        *repositories.ReviewRepository
+	productRepo *repositories.ProductRepository
+	redis       *redis.Client
+}
+
+func NewReview(repo *repositories.ReviewRepository, productRepo *repositories.ProductRepository, redis *redis.Client) ReviewService {
+	return &review{
+		repo:        repo,
+		productRepo: productRepo,
+		redis:       redis,
+	}
+}
+
+func (r *review) GetProductReviews(ctx context.Context, productID int) ([]*entity.Review, error) {
+
+	reviews, err := r.repo.GetReviewsByProductID(ctx, productID, entity.ReviewStatusApproved)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get reviews")
+	}
+
+	return reviews, nil
+}
+
+// StoreReview creates the user's review of the product, pending moderation.
+func (r *review) StoreReview(ctx context.Context, request model.ReviewRequest, userID int) (*entity.Review, error) {
+
+	if err := validateReview(&request); err != nil {
+		return nil, err
+	}
+
+	product, err := r.productRepo.GetProductByID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil || !product.Visible(time.Now().UTC()) {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	existing, err := r.repo.GetReviewByUserAndProduct(ctx, userID, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get review")
+	}
+
+	if existing != nil {
+		return nil, fmt.Errorf("you already reviewed this product")
+	}
+
+	verified, err := r.repo.HasPurchased(ctx, userID, request.ProductID, purchasedOrderStatuses...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify purchase")
+	}
+
+	review, err := r.repo.StoreReview(ctx, &entity.Review{
+		ProductID: request.ProductID,
+		UserID:    userID,
+		Rating:    request.Rating,
+		Title:     request.Title,
+		Body:      request.Body,
+		Verified:  verified,
+		Status:    entity.ReviewStatusPending,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot store review")
+	}
+
+	return review, nil
+}
+
+// UpdateReview changes the user's review of the product and sends it back to moderation.
+func (r *review) UpdateReview(ctx context.Context, request model.ReviewRequest, userID int) (*entity.Review, error) {
+
+	if err := validateReview(&request); err != nil {
+		return nil, err
+	}
+
+	review, err := r.ownReview(ctx, request.ProductID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := r.repo.HasPurchased(ctx, userID, request.ProductID, purchasedOrderStatuses...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot verify purchase")
+	}
+
+	wasApproved := review.Status == entity.ReviewStatusApproved
+
+	review.Rating = request.Rating
+	review.Title = request.Title
+	review.Body = request.Body
+	review.Verified = verified
+	review.Status = entity.ReviewStatusPending
+
+	if err := r.repo.UpdateReview(ctx, review); err != nil {
+		return nil, fmt.Errorf("cannot update review")
+	}
+
+	if wasApproved {
+		r.invalidateProduct(ctx, review.ProductID)
+	}
+
+	return review, nil
+}
+
+func (r *review) DeleteReview(ctx context.Context, productID int, userID int) error {
+
+	review, err := r.ownReview(ctx, productID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := r.repo.DeleteReview(ctx, review.ID); err != nil {
+		return fmt.Errorf("cannot delete review")
+	}
+
+	if review.Status == entity.ReviewStatusApproved {
+		r.invalidateProduct(ctx, review.ProductID)
+	}
+
+	return nil
+}
+
+func (r *review) GetReviews(ctx context.Context, status string) ([]*entity.Review, error) {
+
+	reviews, err := r.repo.GetReviews(ctx, status)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get reviews")
+	}
+
+	return reviews, nil
+}
+
+func (r *review) Approve(ctx context.Context, id int) (*entity.Review, error) {
+	return r.moderate(ctx, id, entity.ReviewStatusApproved)
+}
+
+func (r *review) Reject(ctx context.Context, id int) (*entity.Review, error) {
+	return r.moderate(ctx, id, entity.ReviewStatusRejected)
+}
+
+// moderate sets the status of the review and refreshes the cached rating of its product.
+func (r *review) moderate(ctx context.Context, id int, status string) (*entity.Review, error) {
+
+	review, err := r.repo.GetReviewByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get review")
+	}
+
+	if review == nil {
+		return nil, fmt.Errorf("review not found")
+	}
+
+	if review.Status == status {
+		return review, nil
+	}
+
+	if err := r.repo.UpdateReviewStatus(ctx, id, status); err != nil {
+		return nil, fmt.Errorf("cannot update review")
+	}
+
+	review.Status = status
+	r.invalidateProduct(ctx, review.ProductID)
+
+	return review, nil
+}
+
+func (r *review) ownReview(ctx context.Context, productID int, userID int) (*entity.Review, error) {
+
+	review, err := r.repo.GetReviewByUserAndProduct(ctx, userID, productID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get review")
+	}
+
+	if review == nil {
+		return nil, fmt.Errorf("review not found")
+	}
+
+	return review, nil
+}
+
+func (r *review) invalidateProduct(ctx context.Context, productID int) {
+	r.redis.Del(ctx, fmt.Sprintf("product:%d", productID))
+	r.redis.Del(ctx, "products")
+}
+
+func validateReview(request *model.ReviewRequest) error {
+
+	request.Title = strings.TrimSpace(request.Title)
+	request.Body = strings.TrimSpace(request.Body)
+
+	if request.Rating < 1 || request.Rating > 5 {
+		return fmt.Errorf("rating must be between 1 and 5")
+	}
+
+	if request.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+
+	if len(request.Title) > 255 {
+		return fmt.Errorf("title must be at most 255 characters")
+	}
+
+	return nil
+}
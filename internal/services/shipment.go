@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+type ShipmentService interface {
+	CreateShipment(ctx context.Context, request model.ShipmentRequest) (*entity.Shipment, error)
+	GetShipments(ctx context.Context, orderID int) ([]entity.Shipment, error)
+	GetUserShipments(ctx context.Context, orderID int, userID int) ([]entity.Shipment, error)
+	HandleCarrierUpdate(ctx context.Context, carrierCode string, payload []byte) error
+	RegisterCarrierParser(carrierCode string, parser CarrierStatusParser)
+}
+
+type shipment struct {
+	repo            *repositories.ShipmentRepository
+	orderRepo       *repositories.OrderRepository
+	orderDetailRepo *repositories.OrderDetailRepository
+
+	mu            sync.RWMutex
+	parsers       map[string]CarrierStatusParser
+	defaultParser CarrierStatusParser
+}
+
+func NewShipment(repo *repositories.ShipmentRepository, orderRepo *repositories.OrderRepository, orderDetailRepo *repositories.OrderDetailRepository) ShipmentService {
+	return &shipment{
+		repo:            repo,
+		orderRepo:       orderRepo,
+		orderDetailRepo: orderDetailRepo,
+		parsers:         make(map[string]CarrierStatusParser),
+		defaultParser:   NewGenericCarrierParser(),
+	}
+}
+
+func (s *shipment) RegisterCarrierParser(carrierCode string, parser CarrierStatusParser) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.parsers[strings.ToLower(carrierCode)] = parser
+}
+
+func (s *shipment) CreateShipment(ctx context.Context, request model.ShipmentRequest) (*entity.Shipment, error) {
+
+	if strings.TrimSpace(request.CarrierCode) == "" || strings.TrimSpace(request.TrackingNumber) == "" {
+		return nil, invalidRequest("carrier code and tracking number are required")
+	}
+
+	tx, err := s.orderRepo.BeginTransaction(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	// the lock keeps concurrent shipments of the order from shipping the same items
+	order, err := s.orderRepo.GetOrderForUpdateWithTransaction(ctx, tx, request.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil {
+		return nil, invalidRequest("order not found")
+	}
+
+	if order.Status != entity.OrderStatusPaid && order.Status != entity.OrderStatusPartiallyShipped {
+		return nil, invalidRequest("order cannot be shipped in status %s", order.Status)
+	}
+
+	orderDetails, err := s.orderDetailRepo.GetOrderDetailsByOrderID(ctx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order details")
+	}
+
+	shipped, err := s.repo.GetShippedQuantitiesWithTransaction(ctx, tx, order.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipped quantities")
+	}
+
+	remaining := make(map[int]int)
+	for _, detail := range orderDetails {
+		remaining[detail.ID] = detail.Quantity - shipped[detail.ID]
+	}
+
+	var items []entity.ShipmentItem
+	if len(request.Items) == 0 {
+		for _, detail := range orderDetails {
+			if remaining[detail.ID] > 0 {
+				items = append(items, entity.ShipmentItem{OrderDetailID: detail.ID, Quantity: remaining[detail.ID]})
+				remaining[detail.ID] = 0
+			}
+		}
+	} else {
+		for _, item := range request.Items {
+			left, ok := remaining[item.OrderDetailID]
+			if !ok {
+				return nil, invalidRequest("order detail %d does not belong to order", item.OrderDetailID)
+			}
+
+			if item.Quantity <= 0 || item.Quantity > left {
+				return nil, invalidRequest("invalid quantity for order detail %d", item.OrderDetailID)
+			}
+
+			remaining[item.OrderDetailID] -= item.Quantity
+			items = append(items, entity.ShipmentItem{OrderDetailID: item.OrderDetailID, Quantity: item.Quantity})
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, invalidRequest("nothing left to ship")
+	}
+
+	orderStatus := entity.OrderStatusShipped
+	for _, left := range remaining {
+		if left > 0 {
+			orderStatus = entity.OrderStatusPartiallyShipped
+			break
+		}
+	}
+
+	created, err := s.repo.CreateShipmentWithTransaction(ctx, tx, &entity.Shipment{
+		OrderID:        order.ID,
+		CarrierCode:    strings.ToLower(request.CarrierCode),
+		TrackingNumber: request.TrackingNumber,
+		Status:         entity.ShipmentStatusShipped,
+		Items:          items,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create shipment")
+	}
+
+	err = s.orderRepo.UpdateOrderStatusWithTransaction(ctx, tx, order.ID, orderStatus)
+	if err != nil {
+		return nil, fmt.Errorf("cannot update order status")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("transaction commit failed")
+	}
+
+	return created, nil
+}
+
+func (s *shipment) GetShipments(ctx context.Context, orderID int) ([]entity.Shipment, error) {
+
+	shipments, err := s.repo.GetShipmentsByOrderID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipments")
+	}
+
+	return shipments, nil
+}
+
+func (s *shipment) GetUserShipments(ctx context.Context, orderID int, userID int) ([]entity.Shipment, error) {
+
+	order, err := s.orderRepo.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get order")
+	}
+
+	if order == nil || order.UserID != userID {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	return s.GetShipments(ctx, orderID)
+}
+
+// HandleCarrierUpdate applies the status updates of a carrier webhook. Updates for
+// unknown tracking numbers are skipped so one bad event does not block the batch.
+// Updates older than the latest event of their shipment are only recorded, so
+// events delivered out of order cannot move a shipment back.
+func (s *shipment) HandleCarrierUpdate(ctx context.Context, carrierCode string, payload []byte) error {
+
+	carrierCode = strings.ToLower(carrierCode)
+
+	s.mu.RLock()
+	parser, ok := s.parsers[carrierCode]
+	s.mu.RUnlock()
+	if !ok {
+		parser = s.defaultParser
+	}
+
+	updates, err := parser.Parse(payload)
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		shipment, err := s.repo.GetShipmentByTrackingNumber(ctx, carrierCode, update.TrackingNumber)
+		if err != nil {
+			return fmt.Errorf("cannot get shipment")
+		}
+
+		if shipment == nil {
+			log.Printf("carrier %s: unknown tracking number %s", carrierCode, update.TrackingNumber)
+			continue
+		}
+
+		// a later event moving a delivered shipment on, e.g. to an exception,
+		// clears its delivery time
+		shipment.Status = update.Status
+		shipment.DeliveredAt = nil
+		if update.Status == entity.ShipmentStatusDelivered {
+			deliveredAt := update.OccurredAt
+			shipment.DeliveredAt = &deliveredAt
+		}
+
+		applied, err := s.repo.UpdateShipmentStatus(ctx, shipment, &entity.ShipmentEvent{
+			Status:      update.Status,
+			Description: update.Description,
+			OccurredAt:  update.OccurredAt,
+		})
+		if err != nil {
+			return fmt.Errorf("cannot update shipment status")
+		}
+
+		if !applied {
+			log.Printf("carrier %s: event %s of %s is older than the shipment status, kept in the history only", carrierCode, update.Status, update.TrackingNumber)
+			continue
+		}
+
+		if update.Status == entity.ShipmentStatusDelivered {
+			if err := s.markOrderDelivered(ctx, shipment.OrderID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// markOrderDelivered moves the order to delivered once every ordered quantity
+// is part of a delivered shipment. Only a shipped order is moved, an order
+// cancelled meanwhile keeps its status.
+func (s *shipment) markOrderDelivered(ctx context.Context, orderID int) error {
+
+	orderDetails, err := s.orderDetailRepo.GetOrderDetailsByOrderID(ctx, orderID)
+	if err != nil {
+		return fmt.Errorf("cannot get order details")
+	}
+
+	delivered, err := s.repo.GetShippedQuantities(ctx, orderID, entity.ShipmentStatusDelivered)
+	if err != nil {
+		return fmt.Errorf("cannot get delivered quantities")
+	}
+
+	for _, detail := range orderDetails {
+		if delivered[detail.ID] < detail.Quantity {
+			return nil
+		}
+	}
+
+	tx, err := s.orderRepo.BeginTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	moved, err := s.orderRepo.UpdateOrderStatusFromWithTransaction(ctx, tx, orderID, entity.OrderStatusShipped, entity.OrderStatusDelivered)
+	if err != nil {
+		return fmt.Errorf("cannot update order status")
+	}
+
+	if !moved {
+		log.Printf("order %d is delivered but no longer %s, status kept", orderID, entity.OrderStatusShipped)
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+type ShippingService interface {
+	Quote(ctx context.Context, request model.ShippingQuoteRequest, userID int) (*model.ShippingQuoteResponse, error)
+	Rate(ctx context.Context, methodID int, cartItems []*entity.CartItem, address *entity.OrderAddress) (*entity.ShippingMethod, float64, error)
+}
+
+type shipping struct {
+	repo        *repositories.ShippingMethodRepository
+	cartRepo    *repositories.CartRepository
+	addressRepo *repositories.AddressRepository
+}
+
+func NewShipping(repo *repositories.ShippingMethodRepository, cartRepo *repositories.CartRepository, addressRepo *repositories.AddressRepository) ShippingService {
+	return &shipping{
+		repo:        repo,
+		cartRepo:    cartRepo,
+		addressRepo: addressRepo,
+	}
+}
+
+// Quote returns the shipping methods available for the user's cart and address with their price.
+func (s *shipping) Quote(ctx context.Context, request model.ShippingQuoteRequest, userID int) (*model.ShippingQuoteResponse, error) {
+
+	address, err := resolveShippingAddress(ctx, s.addressRepo, request.AddressID, request.ShippingAddress, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cartItems, err := s.cartRepo.GetCartItemsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart items")
+	}
+
+	if len(cartItems) == 0 {
+		return nil, invalidRequest("cart is empty")
+	}
+
+	methods, err := s.repo.GetActiveShippingMethods(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get shipping methods")
+	}
+
+	subtotal, weight := cartTotals(cartItems)
+
+	response := &model.ShippingQuoteResponse{
+		Subtotal:    subtotal,
+		TotalWeight: weight,
+		Methods:     []model.ShippingQuote{},
+	}
+
+	for _, method := range methods {
+		if !shipsTo(method, address) {
+			continue
+		}
+
+		price := shippingPrice(method, subtotal, weight)
+		response.Methods = append(response.Methods, model.ShippingQuote{
+			MethodID: method.ID,
+			Code:     method.Code,
+			Name:     method.Name,
+			Type:     method.Type,
+			Price:    price,
+			Total:    subtotal + price,
+		})
+	}
+
+	return response, nil
+}
+
+// Rate validates that the method can deliver to the address and returns its price for the cart.
+func (s *shipping) Rate(ctx context.Context, methodID int, cartItems []*entity.CartItem, address *entity.OrderAddress) (*entity.ShippingMethod, float64, error) {
+
+	if methodID == 0 {
+		return nil, 0, invalidRequest("shipping method is required")
+	}
+
+	method, err := s.repo.GetShippingMethodByID(ctx, methodID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot get shipping method")
+	}
+
+	if method == nil || !method.Active {
+		return nil, 0, invalidRequest("shipping method not found")
+	}
+
+	if !shipsTo(*method, address) {
+		return nil, 0, invalidRequest("shipping method not available for this address")
+	}
+
+	subtotal, weight := cartTotals(cartItems)
+
+	return method, shippingPrice(*method, subtotal, weight), nil
+}
+
+// cartTotals returns the subtotal and weight of the cart lines that can be
+// ordered, leaving out deleted and hidden products.
+func cartTotals(cartItems []*entity.CartItem) (float64, float64) {
+
+	now := time.Now().UTC()
+
+	var subtotal, weight float64
+	for _, item := range cartItems {
+		if item.ProductDeleted || !item.Product.Visible(now) {
+			continue
+		}
+
+		subtotal += item.UnitPrice() * float64(item.Quantity)
+		weight += item.Product.Weight * float64(item.Quantity)
+	}
+
+	return subtotal, weight
+}
+
+func shipsTo(method entity.ShippingMethod, address *entity.OrderAddress) bool {
+
+	if strings.TrimSpace(method.Countries) == "" {
+		return true
+	}
+
+	for _, country := range strings.Split(method.Countries, ",") {
+		if strings.EqualFold(strings.TrimSpace(country), strings.TrimSpace(address.Country)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shippingPrice computes the price of a method for a cart subtotal and weight in kilograms.
+// Weight based rates are charged per started kilogram.
+func shippingPrice(method entity.ShippingMethod, subtotal, weight float64) float64 {
+
+	switch method.Type {
+	case entity.ShippingTypeWeightBased:
+		return method.BaseRate + method.RatePerKg*math.Ceil(weight)
+	case entity.ShippingTypeFreeOverThreshold:
+		if subtotal >= method.FreeThreshold {
+			return 0
+		}
+		return method.BaseRate
+	case entity.ShippingTypeLocalPickup:
+		return 0
+	default:
+		return method.BaseRate
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// thumbnailSizes are the generated thumbnails, by name, with the maximum
+// length of their longest edge in pixels. Larger sizes come first so each
+// thumbnail can be scaled down from the previous one.
+var thumbnailSizes = []struct {
+	Name string
+	Max  int
+}{
+	{"large", 1024},
+	{"medium", 480},
+	{"small", 160},
+}
+
+// thumbnails scales img down to every thumbnail size and encodes the results
+// as JPEG when jpegOutput is set, as PNG otherwise.
+func thumbnails(img image.Image, jpegOutput bool) (map[string][]byte, error) {
+
+	current := toRGBA(img)
+	result := make(map[string][]byte, len(thumbnailSizes))
+	for _, size := range thumbnailSizes {
+		width, height := fit(current.Bounds().Dx(), current.Bounds().Dy(), size.Max)
+		current = scaleDown(current, width, height)
+
+		var buf bytes.Buffer
+		var err error
+		if jpegOutput {
+			err = jpeg.Encode(&buf, current, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, current)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result[size.Name] = buf.Bytes()
+	}
+
+	return result, nil
+}
+
+// fit returns the dimensions of a width x height image whose longest edge is
+// at most limit, keeping the aspect ratio. Images are never enlarged.
+func fit(width, height, limit int) (int, int) {
+
+	if width <= limit && height <= limit {
+		return width, height
+	}
+
+	if width >= height {
+		return limit, max(1, height*limit/width)
+	}
+
+	return max(1, width*limit/height), limit
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	return rgba
+}
+
+// scaleDown resizes src to width x height by averaging the source pixels
+// covered by each destination pixel.
+func scaleDown(src *image.RGBA, width, height int) *image.RGBA {
+
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcWidth == width && srcHeight == height {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					a += int(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / n)
+			dst.Pix[offset+1] = uint8(g / n)
+			dst.Pix[offset+2] = uint8(b / n)
+			dst.Pix[offset+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
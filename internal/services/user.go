@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/aldotp/OnlineStore/internal/config"
 	"github.com/aldotp/OnlineStore/internal/entity"
@@ -18,15 +19,17 @@ type UserService interface {
 }
 
 type user struct {
-	repo   *repositories.UserRepository
-	config *config.BootstrapConfig
+	repo    *repositories.UserRepository
+	config  *config.BootstrapConfig
+	cartSvc CartService
 }
 
 // New User create new instance of User
-func NewUser(repo *repositories.UserRepository, config *config.BootstrapConfig) UserService {
+func NewUser(repo *repositories.UserRepository, config *config.BootstrapConfig, cartSvc CartService) UserService {
 	return &user{
-		repo:   repo,
-		config: config,
+		repo:    repo,
+		config:  config,
+		cartSvc: cartSvc,
 	}
 }
 
@@ -88,6 +91,13 @@ func (u *user) LoginUser(ctx context.Context, request model.LoginRequest) (*mode
 		return nil, err
 	}
 
+	// a failed merge must not prevent the login, the guest cart stays available
+	if request.CartToken != "" {
+		if err := u.cartSvc.MergeGuestCart(ctx, request.CartToken, usr.ID); err != nil {
+			log.Printf("merge guest cart of user %d: %v", usr.ID, err)
+		}
+	}
+
 	return &model.LoginResponse{
 		Token:   token,
 		Expired: expTime,
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+	"github.com/go-redis/redis/v8"
+)
+
+type VariantService interface {
+	SetOptions(ctx context.Context, request model.ProductOptionsRequest) ([]entity.ProductOption, error)
+	StoreVariant(ctx context.Context, request model.VariantRequest) (*entity.ProductVariant, error)
+	UpdateVariant(ctx context.Context, request model.VariantRequest) (*entity.ProductVariant, error)
+	DeleteVariant(ctx context.Context, productID int, variantID int) error
+}
+
+type variant struct {
+	repo        *repositories.ProductVariantRepository
+	productRepo *repositories.ProductRepository
+	redis       *redis.Client
+}
+
+func NewVariant(repo *repositories.ProductVariantRepository, productRepo *repositories.ProductRepository, redis *redis.Client) VariantService {
+	return &variant{
+		repo:        repo,
+		productRepo: productRepo,
+		redis:       redis,
+	}
+}
+
+// SetOptions replaces the options of the product. Existing variants must still
+// have exactly one allowed value for every option.
+func (v *variant) SetOptions(ctx context.Context, request model.ProductOptionsRequest) ([]entity.ProductOption, error) {
+
+	if _, err := v.getProduct(ctx, request.ProductID); err != nil {
+		return nil, err
+	}
+
+	options := make([]entity.ProductOption, 0, len(request.Options))
+	names := make(map[string]bool)
+	for _, option := range request.Options {
+		name := strings.TrimSpace(option.Name)
+		if name == "" {
+			return nil, fmt.Errorf("option name is required")
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf("duplicate option %s", name)
+		}
+		names[name] = true
+
+		values := make([]string, 0, len(option.Values))
+		seen := make(map[string]bool)
+		for _, value := range option.Values {
+			value = strings.TrimSpace(value)
+			if value == "" || seen[value] {
+				return nil, fmt.Errorf("option %s has an empty or duplicate value", name)
+			}
+			seen[value] = true
+			values = append(values, value)
+		}
+
+		if len(values) == 0 {
+			return nil, fmt.Errorf("option %s needs at least one value", name)
+		}
+
+		options = append(options, entity.ProductOption{ProductID: request.ProductID, Name: name, Values: values})
+	}
+
+	variants, err := v.repo.GetVariantsByProductID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get variants")
+	}
+
+	for _, existing := range variants {
+		if err := validateVariantOptions(options, existing.Options); err != nil {
+			return nil, fmt.Errorf("variant %s: %v", existing.SKU, err)
+		}
+	}
+
+	if err := v.repo.ReplaceOptions(ctx, request.ProductID, options); err != nil {
+		return nil, fmt.Errorf("cannot save options")
+	}
+
+	v.invalidateProduct(ctx, request.ProductID)
+
+	return v.repo.GetOptionsByProductID(ctx, request.ProductID)
+}
+
+func (v *variant) StoreVariant(ctx context.Context, request model.VariantRequest) (*entity.ProductVariant, error) {
+
+	if _, err := v.getProduct(ctx, request.ProductID); err != nil {
+		return nil, err
+	}
+
+	variant := &entity.ProductVariant{ProductID: request.ProductID}
+	if err := v.applyRequest(ctx, variant, request); err != nil {
+		return nil, err
+	}
+
+	variant, err := v.repo.StoreVariant(ctx, variant)
+	if err != nil {
+		return nil, fmt.Errorf("cannot store variant")
+	}
+
+	v.invalidateProduct(ctx, request.ProductID)
+
+	return variant, nil
+}
+
+func (v *variant) UpdateVariant(ctx context.Context, request model.VariantRequest) (*entity.ProductVariant, error) {
+
+	variant, err := v.getVariant(ctx, request.ProductID, request.VariantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.applyRequest(ctx, variant, request); err != nil {
+		return nil, err
+	}
+
+	if err := v.repo.UpdateVariant(ctx, variant, request.Stock != nil); err != nil {
+		return nil, fmt.Errorf("cannot update variant")
+	}
+
+	v.invalidateProduct(ctx, request.ProductID)
+
+	return v.repo.GetVariantByID(ctx, variant.ID)
+}
+
+// DeleteVariant removes a variant that was never ordered, together with the cart
+// and wishlist items referencing it.
+func (v *variant) DeleteVariant(ctx context.Context, productID int, variantID int) error {
+
+	if _, err := v.getVariant(ctx, productID, variantID); err != nil {
+		return err
+	}
+
+	deleted, err := v.repo.DeleteVariant(ctx, variantID)
+	if err != nil {
+		return fmt.Errorf("cannot delete variant")
+	}
+
+	if !deleted {
+		return fmt.Errorf("variant has orders")
+	}
+
+	v.invalidateProduct(ctx, productID)
+
+	return nil
+}
+
+// applyRequest validates the request against the product's options and the
+// other variants and copies it into variant.
+func (v *variant) applyRequest(ctx context.Context, variant *entity.ProductVariant, request model.VariantRequest) error {
+
+	sku := strings.TrimSpace(request.SKU)
+	if sku == "" {
+		return fmt.Errorf("sku is required")
+	}
+
+	if request.Price != nil && *request.Price < 0 {
+		return fmt.Errorf("price cannot be negative")
+	}
+
+	if request.Stock != nil && *request.Stock < 0 {
+		return fmt.Errorf("stock cannot be negative")
+	}
+
+	existing, err := v.repo.GetVariantBySKU(ctx, sku)
+	if err != nil {
+		return fmt.Errorf("cannot get variant")
+	}
+
+	if existing != nil && existing.ID != variant.ID {
+		return fmt.Errorf("sku %s is already used", sku)
+	}
+
+	options, err := v.repo.GetOptionsByProductID(ctx, variant.ProductID)
+	if err != nil {
+		return fmt.Errorf("cannot get options")
+	}
+
+	if len(options) == 0 {
+		return fmt.Errorf("product has no options")
+	}
+
+	if err := validateVariantOptions(options, request.Options); err != nil {
+		return err
+	}
+
+	variants, err := v.repo.GetVariantsByProductID(ctx, variant.ProductID)
+	if err != nil {
+		return fmt.Errorf("cannot get variants")
+	}
+
+	key := variantKey(request.Options)
+	for _, other := range variants {
+		if other.ID != variant.ID && variantKey(other.Options) == key {
+			return fmt.Errorf("variant %s has the same options", other.SKU)
+		}
+	}
+
+	variant.SKU = sku
+	variant.Price = request.Price
+	variant.Options = request.Options
+
+	// an update without stock keeps the stock left by the orders
+	if request.Stock != nil {
+		variant.Stock = request.Stock
+	}
+
+	return nil
+}
+
+func (v *variant) getProduct(ctx context.Context, productID int) (*entity.Product, error) {
+
+	product, err := v.productRepo.GetProductByID(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	return product, nil
+}
+
+func (v *variant) getVariant(ctx context.Context, productID int, variantID int) (*entity.ProductVariant, error) {
+
+	variant, err := v.repo.GetVariantByID(ctx, variantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get variant")
+	}
+
+	if variant == nil || variant.ProductID != productID {
+		return nil, fmt.Errorf("variant not found")
+	}
+
+	return variant, nil
+}
+
+func (v *variant) invalidateProduct(ctx context.Context, productID int) {
+	v.redis.Del(ctx, fmt.Sprintf("product:%d", productID))
+	v.redis.Del(ctx, "products")
+}
+
+// validateVariantOptions checks that values holds exactly one allowed value for each option.
+func validateVariantOptions(options []entity.ProductOption, values map[string]string) error {
+
+	if len(values) != len(options) {
+		return fmt.Errorf("a value is required for each of the %d options", len(options))
+	}
+
+	for _, option := range options {
+		value, ok := values[option.Name]
+		if !ok {
+			return fmt.Errorf("missing value for option %s", option.Name)
+		}
+
+		allowed := false
+		for _, candidate := range option.Values {
+			if candidate == value {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("%s is not a value of option %s", value, option.Name)
+		}
+	}
+
+	return nil
+}
+
+// variantKey identifies the combination of option values.
+func variantKey(options map[string]string) string {
+
+	pairs := make([]string, 0, len(options))
+	for name, value := range options {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "\x00")
+}
+
+// resolveVariant returns the variant of the product to put in a cart. Products
+// sold by variant require one, nil is returned for products without variants.
+func resolveVariant(ctx context.Context, repo *repositories.ProductVariantRepository, product *entity.Product, variantID int) (*entity.ProductVariant, error) {
+
+	if variantID == 0 {
+		hasVariants, err := repo.HasVariants(ctx, product.ID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot get variants")
+		}
+
+		if hasVariants {
+			return nil, invalidRequest("variant_id is required for this product")
+		}
+
+		return nil, nil
+	}
+
+	variant, err := repo.GetVariantByID(ctx, variantID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get variant")
+	}
+
+	if variant == nil || variant.ProductID != product.ID {
+		return nil, invalidRequest("variant not found")
+	}
+
+	return variant, nil
+}
+
+// unitPrice is the price of the product, or of the variant when there is one.
+func unitPrice(product *entity.Product, variant *entity.ProductVariant) float64 {
+	if variant != nil {
+		return variant.PriceOf(product)
+	}
+	return product.Price
+}
+
+// inStock reports whether the product, or the variant when there is one, can
+// be ordered.
+func inStock(product *entity.Product, variant *entity.ProductVariant) bool {
+	if variant != nil {
+		return variant.InStock()
+	}
+	return product.InStock()
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aldotp/OnlineStore/internal/entity"
+	"github.com/aldotp/OnlineStore/internal/model"
+	"github.com/aldotp/OnlineStore/internal/repositories"
+)
+
+// SavedForLaterWishlist is the list cart items are moved to when no wishlist is given.
+const SavedForLaterWishlist = "Saved for later"
+
+type WishlistService interface {
+	GetWishlists(ctx context.Context, userID int) ([]*entity.Wishlist, error)
+	GetWishlistByID(ctx context.Context, id int, userID int) (*entity.Wishlist, error)
+	GetSharedWishlist(ctx context.Context, token string) (*entity.Wishlist, error)
+	StoreWishlist(ctx context.Context, request model.WishlistRequest, userID int) (*entity.Wishlist, error)
+	UpdateWishlist(ctx context.Context, request model.WishlistRequest, userID int) (*entity.Wishlist, error)
+	DeleteWishlist(ctx context.Context, id int, userID int) error
+	AddItem(ctx context.Context, request model.WishlistItemRequest, userID int) (*entity.WishlistItem, error)
+	RemoveItem(ctx context.Context, request model.WishlistItemRequest, userID int) error
+	MoveToCart(ctx context.Context, request model.WishlistItemRequest, userID int) error
+	SaveForLater(ctx context.Context, request model.SaveForLaterRequest, userID int) (*entity.WishlistItem, error)
+	NotifyChanges(ctx context.Context) error
+}
+
+type wishlist struct {
+	repo        *repositories.WishlistRepository
+	cartRepo    *repositories.CartRepository
+	productRepo *repositories.ProductRepository
+	variantRepo *repositories.ProductVariantRepository
+	notifier    Notifier
+}
+
+func NewWishlist(repo *repositories.WishlistRepository, cartRepo *repositories.CartRepository, productRepo *repositories.ProductRepository, variantRepo *repositories.ProductVariantRepository, notifier Notifier) WishlistService {
+	return &wishlist{
+		repo:        repo,
+		cartRepo:    cartRepo,
+		productRepo: productRepo,
+		variantRepo: variantRepo,
+		notifier:    notifier,
+	}
+}
+
+func (w *wishlist) GetWishlists(ctx context.Context, userID int) ([]*entity.Wishlist, error) {
+
+	wishlists, err := w.repo.GetWishlistsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get wishlists")
+	}
+
+	return wishlists, nil
+}
+
+func (w *wishlist) GetWishlistByID(ctx context.Context, id int, userID int) (*entity.Wishlist, error) {
+
+	wishlist, err := w.ownWishlist(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.withItems(ctx, wishlist)
+}
+
+func (w *wishlist) GetSharedWishlist(ctx context.Context, token string) (*entity.Wishlist, error) {
+
+	wishlist, err := w.repo.GetWishlistByShareToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get wishlist")
+	}
+
+	if wishlist == nil {
+		return nil, fmt.Errorf("wishlist not found")
+	}
+
+	return w.withItems(ctx, wishlist)
+}
+
+func (w *wishlist) StoreWishlist(ctx context.Context, request model.WishlistRequest, userID int) (*entity.Wishlist, error) {
+
+	name, err := w.validateName(ctx, request.Name, userID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	wishlist := &entity.Wishlist{
+		UserID: userID,
+		Name:   name,
+	}
+
+	if err := setShareToken(wishlist, request.Public); err != nil {
+		return nil, err
+	}
+
+	wishlist, err = w.repo.StoreWishlist(ctx, wishlist)
+	if err != nil {
+		return nil, fmt.Errorf("cannot store wishlist")
+	}
+
+	return wishlist, nil
+}
+
+func (w *wishlist) UpdateWishlist(ctx context.Context, request model.WishlistRequest, userID int) (*entity.Wishlist, error) {
+
+	wishlist, err := w.ownWishlist(ctx, request.WishlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wishlist.Name, err = w.validateName(ctx, request.Name, userID, wishlist.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setShareToken(wishlist, request.Public); err != nil {
+		return nil, err
+	}
+
+	if err := w.repo.UpdateWishlist(ctx, wishlist); err != nil {
+		return nil, fmt.Errorf("cannot update wishlist")
+	}
+
+	return wishlist, nil
+}
+
+func (w *wishlist) DeleteWishlist(ctx context.Context, id int, userID int) error {
+
+	if _, err := w.ownWishlist(ctx, id, userID); err != nil {
+		return err
+	}
+
+	if err := w.repo.DeleteWishlist(ctx, id); err != nil {
+		return fmt.Errorf("cannot delete wishlist")
+	}
+
+	return nil
+}
+
+func (w *wishlist) AddItem(ctx context.Context, request model.WishlistItemRequest, userID int) (*entity.WishlistItem, error) {
+
+	if _, err := w.ownWishlist(ctx, request.WishlistID, userID); err != nil {
+		return nil, err
+	}
+
+	if request.Quantity <= 0 {
+		request.Quantity = 1
+	}
+
+	product, err := w.productRepo.GetProductByID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil || !product.Visible(time.Now().UTC()) {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	// the variant can also be picked when moving the item to the cart
+	var variant *entity.ProductVariant
+	if request.VariantID != 0 {
+		variant, err = resolveVariant(ctx, w.variantRepo, product, request.VariantID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = w.repo.AddWishlistItem(ctx, &entity.WishlistItem{
+		WishlistID: request.WishlistID,
+		ProductID:  product.ID,
+		VariantID:  request.VariantID,
+		Quantity:   request.Quantity,
+		Price:      unitPrice(product, variant),
+		InStock:    inStock(product, variant),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot add product to wishlist")
+	}
+
+	return w.repo.GetWishlistItem(ctx, request.WishlistID, product.ID, request.VariantID)
+}
+
+func (w *wishlist) RemoveItem(ctx context.Context, request model.WishlistItemRequest, userID int) error {
+
+	if _, err := w.ownWishlist(ctx, request.WishlistID, userID); err != nil {
+		return err
+	}
+
+	if err := w.repo.DeleteWishlistItem(ctx, request.WishlistID, request.ProductID, request.VariantID); err != nil {
+		return fmt.Errorf("cannot remove product from wishlist")
+	}
+
+	return nil
+}
+
+// MoveToCart adds the wishlist item to the user's cart and removes it from the
+// wishlist. The item of the requested variant is moved, or the item saved
+// without variant with the requested variant.
+func (w *wishlist) MoveToCart(ctx context.Context, request model.WishlistItemRequest, userID int) error {
+
+	if _, err := w.ownWishlist(ctx, request.WishlistID, userID); err != nil {
+		return err
+	}
+
+	item, err := w.repo.GetWishlistItem(ctx, request.WishlistID, request.ProductID, request.VariantID)
+	if err == nil && item == nil && request.VariantID != 0 {
+		item, err = w.repo.GetWishlistItem(ctx, request.WishlistID, request.ProductID, 0)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot get wishlist item")
+	}
+
+	if item == nil {
+		return fmt.Errorf("product is not in the wishlist")
+	}
+
+	if !item.Product.Visible(time.Now().UTC()) {
+		return fmt.Errorf("product not found")
+	}
+
+	variantID := item.VariantID
+	if variantID == 0 {
+		variantID = request.VariantID
+	}
+
+	variant, err := resolveVariant(ctx, w.variantRepo, &item.Product, variantID)
+	if err != nil {
+		return err
+	}
+	price := unitPrice(&item.Product, variant)
+
+	cart, err := w.cartRepo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("cannot get cart")
+	}
+
+	tx, err := w.cartRepo.BeginTransaction(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	cartItems, err := w.cartRepo.GetCartItemsForUpdateWithTransaction(ctx, tx, cart.ID)
+	if err != nil {
+		return fmt.Errorf("cannot get cart items")
+	}
+
+	if cartItem := cartItems[entity.CartLine{ProductID: item.ProductID, VariantID: variantID}]; cartItem != nil {
+		cartItem.Quantity += item.Quantity
+		cartItem.Price = price
+		err = w.cartRepo.UpdateCartItemWithTransaction(ctx, tx, cartItem)
+	} else {
+		err = w.cartRepo.StoreCartItemWithTransaction(ctx, tx, &entity.CartItem{
+			CartID:    cart.ID,
+			ProductID: item.ProductID,
+			VariantID: variantID,
+			Quantity:  item.Quantity,
+			Price:     price,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("cannot add product to cart")
+	}
+
+	if err := w.repo.DeleteWishlistItemWithTransaction(ctx, tx, item.WishlistID, item.ProductID, item.VariantID); err != nil {
+		return fmt.Errorf("cannot remove product from wishlist")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("cannot commit transaction")
+	}
+
+	return nil
+}
+
+// SaveForLater moves a cart item to the requested wishlist or to the user's
+// "Saved for later" list, which is created on first use.
+func (w *wishlist) SaveForLater(ctx context.Context, request model.SaveForLaterRequest, userID int) (*entity.WishlistItem, error) {
+
+	wishlist, err := w.saveForLaterWishlist(ctx, request.WishlistID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := w.productRepo.GetProductByID(ctx, request.ProductID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get product")
+	}
+
+	if product == nil {
+		return nil, fmt.Errorf("product not found")
+	}
+
+	variant, err := resolveVariant(ctx, w.variantRepo, product, request.VariantID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err := w.cartRepo.GetCartByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart")
+	}
+
+	tx, err := w.cartRepo.BeginTransaction(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	cartItems, err := w.cartRepo.GetCartItemsForUpdateWithTransaction(ctx, tx, cart.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get cart items")
+	}
+
+	cartItem := cartItems[entity.CartLine{ProductID: product.ID, VariantID: request.VariantID}]
+	if cartItem == nil {
+		return nil, fmt.Errorf("product is not in the cart")
+	}
+
+	err = w.repo.AddWishlistItemWithTransaction(ctx, tx, &entity.WishlistItem{
+		WishlistID: wishlist.ID,
+		ProductID:  product.ID,
+		VariantID:  cartItem.VariantID,
+		Quantity:   cartItem.Quantity,
+		Price:      unitPrice(product, variant),
+		InStock:    inStock(product, variant),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot add product to wishlist")
+	}
+
+	if err := w.cartRepo.DeleteCartItemWithTransaction(ctx, tx, cartItem.ID); err != nil {
+		return nil, fmt.Errorf("cannot delete product from cart")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("cannot commit transaction")
+	}
+
+	return w.repo.GetWishlistItem(ctx, wishlist.ID, product.ID, cartItem.VariantID)
+}
+
+// NotifyChanges notifies the owners of wishlist items whose product became
+// cheaper or available again, then records the current price and availability.
+// Items whose notification fails are retried on the next run.
+func (w *wishlist) NotifyChanges(ctx context.Context) error {
+
+	items, owners, err := w.repo.GetChangedWishlistItems(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot get changed wishlist items: %w", err)
+	}
+
+	for _, item := range items {
+		price := unitPrice(&item.Product, item.Variant)
+		available := inStock(&item.Product, item.Variant)
+
+		event := model.WishlistProductEvent{
+			WishlistID:    item.WishlistID,
+			ProductID:     item.ProductID,
+			VariantID:     item.VariantID,
+			ProductName:   item.Product.Name,
+			PreviousPrice: item.Price,
+			Price:         price,
+		}
+
+		var notifications []string
+		if price < item.Price {
+			notifications = append(notifications, model.NotificationPriceDrop)
+		}
+		if !item.InStock && available {
+			notifications = append(notifications, model.NotificationBackInStock)
+		}
+
+		notified := true
+		for _, notification := range notifications {
+			err := w.notifier.Notify(ctx, model.Notification{
+				Type:   notification,
+				UserID: owners[item.WishlistID],
+				Data:   event,
+			})
+			if err != nil {
+				log.Printf("cannot notify wishlist item %d: %v", item.ID, err)
+				notified = false
+			}
+		}
+
+		if !notified {
+			continue
+		}
+
+		if err := w.repo.UpdateWishlistItemSnapshot(ctx, item.ID, price, available); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *wishlist) ownWishlist(ctx context.Context, id int, userID int) (*entity.Wishlist, error) {
+
+	wishlist, err := w.repo.GetWishlistByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get wishlist")
+	}
+
+	if wishlist == nil || wishlist.UserID != userID {
+		return nil, fmt.Errorf("wishlist not found")
+	}
+
+	return wishlist, nil
+}
+
+func (w *wishlist) withItems(ctx context.Context, wishlist *entity.Wishlist) (*entity.Wishlist, error) {
+
+	items, err := w.repo.GetWishlistItems(ctx, wishlist.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get wishlist items")
+	}
+
+	wishlist.Items = items
+	return wishlist, nil
+}
+
+func (w *wishlist) saveForLaterWishlist(ctx context.Context, id int, userID int) (*entity.Wishlist, error) {
+
+	if id != 0 {
+		return w.ownWishlist(ctx, id, userID)
+	}
+
+	wishlist, err := w.repo.GetWishlistByName(ctx, userID, SavedForLaterWishlist)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get wishlist")
+	}
+
+	if wishlist != nil {
+		return wishlist, nil
+	}
+
+	wishlist, err = w.repo.StoreWishlist(ctx, &entity.Wishlist{UserID: userID, Name: SavedForLaterWishlist})
+	if err != nil {
+		return nil, fmt.Errorf("cannot store wishlist")
+	}
+
+	return wishlist, nil
+}
+
+// validateName returns the trimmed name and rejects names used by another wishlist of the user.
+func (w *wishlist) validateName(ctx context.Context, name string, userID int, wishlistID int) (string, error) {
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+
+	if len(name) > 100 {
+		return "", fmt.Errorf("name must be at most 100 characters")
+	}
+
+	existing, err := w.repo.GetWishlistByName(ctx, userID, name)
+	if err != nil {
+		return "", fmt.Errorf("cannot get wishlist")
+	}
+
+	if existing != nil && existing.ID != wishlistID {
+		return "", fmt.Errorf("wishlist %s already exists", name)
+	}
+
+	return name, nil
+}
+
+// setShareToken creates the share link of a public wishlist once and removes it
+// when the wishlist becomes private.
+func setShareToken(wishlist *entity.Wishlist, public bool) error {
+
+	if !public {
+		wishlist.ShareToken = ""
+		return nil
+	}
+
+	if wishlist.ShareToken != "" {
+		return nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	wishlist.ShareToken = token
+	return nil
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Local stores media in a directory served by the API under the base URL.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocal(dir string, baseURL string) *Local {
+	if dir == "" {
+		dir = "media"
+	}
+
+	return &Local{dir: dir, baseURL: baseURL}
+}
+
+// FileSystem serves the files of the directory. Directories are reported as
+// not found so that their content is never listed.
+func (l *Local) FileSystem() http.FileSystem {
+	return filesOnly{http.Dir(l.dir)}
+}
+
+type filesOnly struct {
+	http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+
+	file, err := f.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+
+	return file, nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (l *Local) URL(key string) string {
+	return joinURL(l.baseURL, key)
+}
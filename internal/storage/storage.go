@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Storage keeps uploaded media under slash separated keys such as
+// products/1/abc.jpg and tells where clients can download them.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Config selects and configures the storage backend.
+type Config struct {
+	Driver  string
+	BaseURL string
+
+	LocalDir string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// New returns the storage of cfg.Driver, local storage when it is empty.
+func New(cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case "", DriverLocal:
+		return NewLocal(cfg.LocalDir, cfg.BaseURL), nil
+	case DriverS3:
+		return NewS3(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %s", cfg.Driver)
+	}
+}
+
+func joinURL(base string, key string) string {
+	return strings.TrimRight(base, "/") + "/" + key
+}
+
+// validKey rejects keys that could escape the storage root.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid storage key %q", key)
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid storage key %q", key)
+		}
+	}
+
+	return nil
+}
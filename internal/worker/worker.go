@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a task that runs periodically in the background.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Start runs every job on its own ticker until ctx is cancelled. Jobs without
+// an interval are disabled.
+func Start(ctx context.Context, jobs ...Job) {
+	for _, job := range jobs {
+		if job.Interval <= 0 {
+			log.Printf("worker %s is disabled", job.Name)
+			continue
+		}
+
+		go run(ctx, job)
+	}
+}
+
+func run(ctx context.Context, job Job) {
+
+	log.Printf("worker %s runs every %s", job.Name, job.Interval)
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job.Run(ctx); err != nil {
+				log.Printf("worker %s: %v", job.Name, err)
+			}
+		}
+	}
+}
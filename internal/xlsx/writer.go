@@ -0,0 +1,185 @@
+// Package xlsx writes Office Open XML spreadsheets. Rows are streamed to the
+// underlying writer as they are added, so large sheets are never held in memory.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer writes the sheets of a workbook one after the other. Close must be
+// called to complete the file.
+type Writer struct {
+	zip    *zip.Writer
+	sheet  io.Writer
+	sheets []string
+	rows   int
+	err    error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zip: zip.NewWriter(w)}
+}
+
+// AddSheet ends the current sheet and starts a new one named name.
+func (w *Writer) AddSheet(name string) error {
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	w.sheets = append(w.sheets, name)
+	sheet, err := w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	if err != nil {
+		return w.fail(err)
+	}
+
+	w.sheet = sheet
+	w.rows = 0
+	_, err = io.WriteString(sheet, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return w.fail(err)
+}
+
+// WriteRow appends a row to the current sheet. Numbers are written as numbers,
+// times in RFC 3339 and nil as an empty cell, everything else as text.
+func (w *Writer) WriteRow(values ...any) error {
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.sheet == nil {
+		return errors.New("xlsx: no sheet")
+	}
+
+	w.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(w.rows)
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case time.Time:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, v.Format(time.RFC3339))
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(&b, []byte(fmt.Sprint(v))); err != nil {
+				return w.fail(err)
+			}
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(w.sheet, b.String())
+	return w.fail(err)
+}
+
+// Close ends the last sheet and writes the workbook parts.
+func (w *Writer) Close() error {
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if len(w.sheets) == 0 {
+		if err := w.AddSheet("Sheet1"); err != nil {
+			return err
+		}
+	}
+
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	var contentTypes, workbook, rels strings.Builder
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, name := range w.sheets {
+		id := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, id)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), id, id)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, id, id)
+	}
+
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, data string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+	}
+
+	for _, part := range parts {
+		f, err := w.zip.Create(part.name)
+		if err != nil {
+			return w.fail(err)
+		}
+
+		if _, err := io.WriteString(f, part.data); err != nil {
+			return w.fail(err)
+		}
+	}
+
+	return w.fail(w.zip.Close())
+}
+
+func (w *Writer) endSheet() error {
+
+	if w.sheet == nil {
+		return nil
+	}
+
+	_, err := io.WriteString(w.sheet, `</sheetData></worksheet>`)
+	w.sheet = nil
+	return w.fail(err)
+}
+
+// fail keeps the first error, the file is unusable after it.
+func (w *Writer) fail(err error) error {
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+// columnName returns the letters of the zero based column i: A, B, ..., Z, AA.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}